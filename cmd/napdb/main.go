@@ -1,18 +1,27 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+
+	"github.com/adityaparmar9813/NAP/internal/driver"
 	"github.com/adityaparmar9813/NAP/internal/schema"
-	"github.com/adityaparmar9813/NAP/internal/storage"
-	"github.com/adityaparmar9813/NAP/internal/validator"
 )
 
 func main() {
-	// Initialize the storage and validator implementations
-	storageImpl := storage.NewFileStorage()   // Create an instance of FileStorage
-	validatorImpl := validator.NewValidator() // Create an instance of Validator
+	dataDir := flag.String("data", ".", "directory holding the database")
+	flag.Parse()
+
+	// Open the database, which owns the data directory until it is closed
+	db, err := driver.Open(*dataDir, driver.Options{})
+	if err != nil {
+		fmt.Println("Error opening database:", err)
+		return
+	}
+	defer db.Close()
 
 	// Call the Test function with the required interfaces
-	schema.Test(storageImpl, validatorImpl)
+	schema.Test(db.Storage(), db.Validator())
 
 	// Example of other operations
 	// schema, err := driver.Collection()
@@ -1 +1,254 @@
 package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/adityaparmar9813/NAP/internal/schema"
+	"github.com/adityaparmar9813/NAP/internal/storage"
+	"github.com/adityaparmar9813/NAP/internal/validator"
+)
+
+// Engine selects the storage engine a Database is opened with
+type Engine string
+
+const (
+	EngineFile   Engine = "file"
+	EnginePaged  Engine = "paged"
+	EngineLSM    Engine = "lsm"
+	EngineMemory Engine = "memory"
+)
+
+const lockFileName = "LOCK"
+
+// DefaultExpireInterval is how often expired records are deleted when
+// Options does not set ExpireInterval
+const DefaultExpireInterval = time.Minute
+
+var (
+	// ErrLocked is returned by Open when another process holds the directory
+	ErrLocked = errors.New("database directory is locked by another process")
+	// ErrClosed is returned by operations on a closed Database
+	ErrClosed = errors.New("database is closed")
+)
+
+// Options configures Open. The zero value opens a FileStorage database.
+type Options struct {
+	Engine Engine
+	// Validator checks field types; defaults to validator.NewValidator()
+	Validator validator.ValidatorInterface
+	// PageCacheSize is the number of pages cached per data file by the paged engine
+	PageCacheSize int
+	// LSM tunes the LSM engine
+	LSM storage.LSMOptions
+	// ExpireInterval is how often records past the ExpireAfter of a TTL
+	// index are deleted; a negative interval never deletes them
+	ExpireInterval time.Duration
+	// OnExpire is called after each pass that deleted expired records or
+	// failed, with the number deleted from each collection
+	OnExpire func(removed map[string]int, err error)
+}
+
+// Database is an open NAP database. It owns its root directory, which no
+// other process can open while the Database is open.
+type Database struct {
+	mu        sync.Mutex
+	dir       string
+	storage   storage.StorageInterface
+	validator validator.ValidatorInterface
+	catalog   *schema.Catalog
+	reaper    *schema.Reaper
+	lock      *fileLock
+	closed    bool
+}
+
+// Open opens the database rooted at dir, creating the directory if needed.
+// The memory engine keeps nothing on disk and accepts an empty dir. If the
+// database was not closed by its last user, every index is rebuilt from
+// the records before Open returns.
+func Open(dir string, options Options) (*Database, error) {
+	if options.Engine == "" {
+		options.Engine = EngineFile
+	}
+	if options.Validator == nil {
+		options.Validator = validator.NewValidator()
+	}
+
+	db := &Database{dir: dir, validator: options.Validator}
+
+	if options.Engine == EngineMemory {
+		db.storage = storage.NewMemoryStorage()
+	} else if err := db.openDir(options); err != nil {
+		return nil, err
+	}
+
+	// Load every collection defined by earlier runs, and rebuild their
+	// indexes if the last run crashed
+	catalog, err := schema.LoadCatalog(db.storage)
+	if err == nil {
+		_, err = catalog.Recover()
+	}
+	if err != nil {
+		db.storage.Close()
+		if db.lock != nil {
+			db.lock.release()
+		}
+		return nil, err
+	}
+	db.catalog = catalog
+
+	if options.ExpireInterval == 0 {
+		options.ExpireInterval = DefaultExpireInterval
+	}
+	if options.ExpireInterval > 0 {
+		db.reaper = catalog.StartReaper(options.ExpireInterval, schema.DefaultExpireBatchSize, options.OnExpire)
+	}
+
+	return db, nil
+}
+
+// openDir locks the data directory and opens the storage engine inside it
+func (db *Database) openDir(options Options) error {
+	if db.dir == "" {
+		return fmt.Errorf("data directory is required for the %s engine", options.Engine)
+	}
+	if err := os.MkdirAll(db.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	lock, err := acquireLock(filepath.Join(db.dir, lockFileName))
+	if err != nil {
+		return err
+	}
+
+	db.storage, err = openStorage(db.dir, options)
+	if err != nil {
+		lock.release()
+		return err
+	}
+	db.lock = lock
+
+	return nil
+}
+
+func openStorage(dir string, options Options) (storage.StorageInterface, error) {
+	switch options.Engine {
+	case EngineFile:
+		return storage.OpenFileStorage(dir)
+	case EnginePaged:
+		return storage.NewPagedStorage(dir, options.PageCacheSize), nil
+	case EngineLSM:
+		return storage.NewLSMStorage(filepath.Join(dir, "lsm"), options.LSM)
+	default:
+		return nil, fmt.Errorf("unknown storage engine: %s", options.Engine)
+	}
+}
+
+// Dir returns the database's root directory
+func (db *Database) Dir() string {
+	return db.dir
+}
+
+func (db *Database) Storage() storage.StorageInterface {
+	return db.storage
+}
+
+func (db *Database) Validator() validator.ValidatorInterface {
+	return db.validator
+}
+
+// CreateCollection defines a collection and saves its schema in the
+// database. Recreating a collection with the same fields returns the existing
+// schema; a different definition fails with schema.ErrSchemaConflict.
+func (db *Database) CreateCollection(name string, fields ...schema.Field) (*schema.Schema, error) {
+	if err := db.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	return db.catalog.Create(name, fields...)
+}
+
+// Collection returns the schema of an existing collection
+func (db *Database) Collection(name string) (*schema.Schema, error) {
+	if err := db.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	return db.catalog.Get(name)
+}
+
+// ListCollections returns the name of every collection, sorted
+func (db *Database) ListCollections() ([]string, error) {
+	if err := db.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	return db.catalog.List(), nil
+}
+
+// DropCollection deletes a collection's records and its schema
+func (db *Database) DropCollection(name string) error {
+	if err := db.checkOpen(); err != nil {
+		return err
+	}
+
+	return db.catalog.Drop(name)
+}
+
+// ExpireRecords deletes the expired records of every collection with a TTL
+// index now, without waiting for the next pass, and returns how many were
+// deleted from each collection
+func (db *Database) ExpireRecords(ctx context.Context) (map[string]int, error) {
+	if err := db.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	return db.catalog.ExpireRecords(ctx, time.Now(), schema.DefaultExpireBatchSize)
+}
+
+func (db *Database) checkOpen() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Close syncs and closes the storage engine and releases the directory lock.
+// Closing a Database twice returns ErrClosed.
+func (db *Database) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+	db.closed = true
+
+	if db.reaper != nil {
+		db.reaper.Stop()
+	}
+	err := db.catalog.Close()
+
+	if syncErr := db.storage.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := db.storage.Close(); err == nil {
+		err = closeErr
+	}
+
+	if db.lock != nil {
+		if lockErr := db.lock.release(); err == nil {
+			err = lockErr
+		}
+	}
+
+	return err
+}
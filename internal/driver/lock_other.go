@@ -0,0 +1,34 @@
+//go:build !unix
+
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// fileLock is held by creating the lock file exclusively. Unlike the unix
+// implementation, a crashed process leaves the file behind and it has to be
+// removed by hand.
+type fileLock struct {
+	path string
+	file *os.File
+}
+
+func acquireLock(path string) (*fileLock, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return nil, ErrLocked
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lock file: %w", err)
+	}
+
+	return &fileLock{path: path, file: file}, nil
+}
+
+func (l *fileLock) release() error {
+	l.file.Close()
+	return os.Remove(l.path)
+}
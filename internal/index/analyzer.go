@@ -0,0 +1,175 @@
+package index
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Tokenizer splits text into words
+type Tokenizer interface {
+	Tokenize(text string) []string
+}
+
+// TokenizerFunc adapts a function to the Tokenizer interface
+type TokenizerFunc func(text string) []string
+
+func (f TokenizerFunc) Tokenize(text string) []string {
+	return f(text)
+}
+
+// DefaultTokenizer is the name of the tokenizer text indexes use unless
+// they name another: it splits text at every character that is not a
+// letter or a digit
+const DefaultTokenizer = "standard"
+
+var (
+	tokenizersMu sync.RWMutex
+	tokenizers   = map[string]Tokenizer{
+		DefaultTokenizer: TokenizerFunc(standardTokens),
+		"whitespace":     TokenizerFunc(strings.Fields),
+	}
+)
+
+// RegisterTokenizer makes a tokenizer available to text indexes under name.
+// Register tokenizers before opening the databases whose indexes use them.
+func RegisterTokenizer(name string, tokenizer Tokenizer) {
+	tokenizersMu.Lock()
+	defer tokenizersMu.Unlock()
+
+	tokenizers[name] = tokenizer
+}
+
+func standardTokens(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Languages a text index can analyze text in. English drops stop words and
+// stems words; none only lowercases them.
+const (
+	LanguageEnglish = "english"
+	LanguageNone    = "none"
+)
+
+// englishStopWords are too common in English to tell texts apart
+var englishStopWords = stopWords(`a about above after again against all am an and any are as at be
+	because been before being below between both but by can did do does doing down during each
+	few for from further had has have having he her here hers herself him himself his how i if
+	in into is it its itself just me more most my myself no nor not now of off on once only or
+	other our ours ourselves out over own same she should so some such than that the their
+	theirs them themselves then there these they this those through to too under until up very
+	was we were what when where which while who whom why will with you your yours yourself
+	yourselves`)
+
+func stopWords(list string) map[string]bool {
+	words := make(map[string]bool)
+	for _, word := range strings.Fields(list) {
+		words[word] = true
+	}
+	return words
+}
+
+// Term is a word of analyzed text and its position among the words of the
+// text, stop words included
+type Term struct {
+	Text     string
+	Position int
+}
+
+// Analyzer turns text into the terms a text index holds: it splits the text
+// into words, lowercases them, drops stop words and stems the rest
+type Analyzer struct {
+	tokenizer Tokenizer
+	stopWords map[string]bool
+	stem      func(string) string
+}
+
+// NewAnalyzer returns the analyzer for a registered tokenizer and a
+// language. Empty names select DefaultTokenizer and LanguageEnglish.
+func NewAnalyzer(tokenizer, language string) (*Analyzer, error) {
+	if tokenizer == "" {
+		tokenizer = DefaultTokenizer
+	}
+
+	tokenizersMu.RLock()
+	registered, exists := tokenizers[tokenizer]
+	tokenizersMu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("unknown tokenizer '%s'", tokenizer)
+	}
+
+	analyzer := &Analyzer{tokenizer: registered}
+	switch language {
+	case "", LanguageEnglish:
+		analyzer.stopWords = englishStopWords
+		analyzer.stem = Stem
+	case LanguageNone:
+	default:
+		return nil, fmt.Errorf("unknown language '%s'", language)
+	}
+
+	return analyzer, nil
+}
+
+// Terms returns the terms of text in order
+func (a *Analyzer) Terms(text string) []Term {
+	var terms []Term
+	for position, word := range a.tokenizer.Tokenize(text) {
+		if term, kept := a.term(word); kept {
+			terms = append(terms, Term{Text: term, Position: position})
+		}
+	}
+	return terms
+}
+
+// term lowercases and stems a word, unless it is a stop word
+func (a *Analyzer) term(word string) (string, bool) {
+	word = strings.ToLower(word)
+	if word == "" || a.stopWords[word] {
+		return "", false
+	}
+	if a.stem != nil {
+		word = a.stem(word)
+	}
+	return word, true
+}
+
+// TextQuery is a parsed text search
+type TextQuery struct {
+	// Words match records containing any of them
+	Words []string
+	// Prefixes match records containing a word that starts with any of them
+	Prefixes []string
+	// Phrases must all appear in a record, word for word
+	Phrases []string
+}
+
+// ParseTextQuery reads a text search: words, "quoted phrases" and word*
+// prefixes separated by spaces
+func ParseTextQuery(search string) TextQuery {
+	var query TextQuery
+
+	for i, part := range strings.Split(search, `"`) {
+		if i%2 == 1 {
+			if strings.TrimSpace(part) != "" {
+				query.Phrases = append(query.Phrases, part)
+			}
+			continue
+		}
+
+		for _, word := range strings.Fields(part) {
+			if prefix := strings.TrimSuffix(word, "*"); prefix != word {
+				if prefix != "" {
+					query.Prefixes = append(query.Prefixes, prefix)
+				}
+				continue
+			}
+			query.Words = append(query.Words, word)
+		}
+	}
+
+	return query
+}
@@ -0,0 +1,657 @@
+package index
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/adityaparmar9813/NAP/internal/storage"
+)
+
+// DefaultOrder is the largest number of entries a B+tree node holds before
+// it is split
+const DefaultOrder = 64
+
+// NodeCacheSize is the number of nodes a B+tree keeps in memory
+const NodeCacheSize = 1024
+
+const metaKey = "meta"
+
+// node is a B+tree node. Leaves hold entries and link to the next leaf;
+// internal nodes hold separators, with one more child than separators.
+type node struct {
+	Leaf     bool     `json:"leaf"`
+	Entries  []Entry  `json:"entries"`
+	Children []string `json:"children,omitempty"`
+	Next     string   `json:"next,omitempty"`
+}
+
+type meta struct {
+	Root   string `json:"root"`
+	NextID int    `json:"nextId"`
+	// Descending flags the key fields ordered from largest to smallest
+	Descending []bool `json:"descending,omitempty"`
+	// Multikey is set once a record has been indexed under several keys
+	Multikey bool `json:"multikey"`
+}
+
+// BTree is a persistent B+tree of index entries. Every node is a document in
+// the tree's collection, written through on each change. The most recently
+// used nodes are cached. Changes are made to copies of the cached nodes,
+// which only replace them once written, so a failed write leaves the tree as
+// it was.
+//
+// Deletes do not rebalance the tree: a leaf emptied by deletes stays in
+// place and is filled again by inserts in its key range.
+type BTree struct {
+	mu         sync.RWMutex
+	store      storage.StorageInterface
+	collection string
+	order      int
+	meta       meta
+
+	cacheMu sync.Mutex
+	nodes   *nodeCache
+}
+
+// ErrDuplicateKey is returned by InsertUnique when another record already
+// has the key
+var ErrDuplicateKey = errors.New("duplicate key")
+
+// OpenBTree opens the tree stored in collection, creating an empty one if
+// the collection holds none. descending flags the key fields of a new tree
+// that are ordered from largest to smallest; an existing tree keeps its own
+// order. Every user of a tree must share one BTree, whose lock and cache
+// cover all of them.
+func OpenBTree(store storage.StorageInterface, collection string, descending []bool) (*BTree, error) {
+	return loadBTree(store, collection, descending)
+}
+
+func loadBTree(store storage.StorageInterface, collection string, descending []bool) (*BTree, error) {
+	t := &BTree{
+		store:      store,
+		collection: collection,
+		order:      DefaultOrder,
+		nodes:      newNodeCache(NodeCacheSize),
+	}
+
+	err := store.Get(collection, metaKey, &t.meta)
+	if err == nil {
+		return t, nil
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("failed to load index %s: %w", collection, err)
+	}
+
+	previous := t.meta
+	root := &node{Leaf: true, Entries: []Entry{}}
+	t.meta.Descending = descending
+	t.meta.Root = t.newID()
+	if err := t.write([]nodeChange{{id: t.meta.Root, node: root}}, &previous); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// SetOrder changes the largest number of entries per node. It only affects
+// nodes split from now on, and is meant for tests.
+func (t *BTree) SetOrder(order int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if order >= 3 {
+		t.order = order
+	}
+}
+
+// Multikey reports whether any record has been indexed under several keys,
+// or under a key holding an array
+func (t *BTree) Multikey() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.meta.Multikey
+}
+
+// SetMultikey records that a record has been indexed under several keys
+func (t *BTree) SetMultikey() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.meta.Multikey {
+		return nil
+	}
+	previous := t.meta
+	t.meta.Multikey = true
+	return t.write(nil, &previous)
+}
+
+// Descending reports whether the key field at position is ordered from
+// largest to smallest
+func (t *BTree) Descending(position int) bool {
+	return position < len(t.meta.Descending) && t.meta.Descending[position]
+}
+
+// compareEntries orders entries by key in the tree's order, then by record
+// ID
+func (t *BTree) compareEntries(a, b Entry) int {
+	if order := compareDirected(a.Key, b.Key, t.meta.Descending); order != 0 {
+		return order
+	}
+	return strings.Compare(a.ID, b.ID)
+}
+
+func (t *BTree) newID() string {
+	t.meta.NextID++
+	return "n" + strconv.Itoa(t.meta.NextID)
+}
+
+// load returns a node. Callers must not change it: changes go to a clone,
+// which write caches in its place.
+func (t *BTree) load(id string) (*node, error) {
+	t.cacheMu.Lock()
+	defer t.cacheMu.Unlock()
+
+	if n, cached := t.nodes.get(id); cached {
+		return n, nil
+	}
+
+	n := &node{}
+	if err := t.store.Get(t.collection, id, n); err != nil {
+		return nil, fmt.Errorf("failed to load index node %s: %w", id, err)
+	}
+	t.nodes.put(id, n)
+
+	return n, nil
+}
+
+// clone copies a node so that it can be changed
+func (n *node) clone() *node {
+	c := *n
+	c.Entries = append(make([]Entry, 0, len(n.Entries)+1), n.Entries...)
+	if n.Children != nil {
+		c.Children = append(make([]string, 0, len(n.Children)+1), n.Children...)
+	}
+	return &c
+}
+
+// nodeChange is a node written by an operation, and the version it replaces
+// or nil for a new node
+type nodeChange struct {
+	id       string
+	node     *node
+	previous *node
+}
+
+// write persists the nodes of an operation, new ones first and then changed
+// ones in the order given, from the leaf up. The metadata follows when
+// previousMeta holds its version from before the operation. Only once all
+// of it is saved are the new nodes cached; if a write fails, the nodes
+// already saved are put back and the metadata is restored.
+func (t *BTree) write(changes []nodeChange, previousMeta *meta) error {
+	ordered := make([]nodeChange, 0, len(changes))
+	for _, change := range changes {
+		if change.previous == nil {
+			ordered = append(ordered, change)
+		}
+	}
+	for _, change := range changes {
+		if change.previous != nil {
+			ordered = append(ordered, change)
+		}
+	}
+
+	var err error
+	written := 0
+	for _, change := range ordered {
+		if err = t.store.Put(t.collection, change.id, change.node); err != nil {
+			err = fmt.Errorf("failed to save index node %s: %w", change.id, err)
+			break
+		}
+		written++
+	}
+	if err == nil && previousMeta != nil {
+		if err = t.store.Put(t.collection, metaKey, t.meta); err != nil {
+			err = fmt.Errorf("failed to save index %s: %w", t.collection, err)
+		}
+	}
+	if err != nil {
+		t.undo(ordered[:written], previousMeta)
+		return err
+	}
+
+	t.cacheMu.Lock()
+	defer t.cacheMu.Unlock()
+	for _, change := range ordered {
+		t.nodes.put(change.id, change.node)
+	}
+	return nil
+}
+
+// undo puts back the nodes a failed write had saved. A node that cannot be
+// put back is dropped from the cache, so that it is read again as stored.
+func (t *BTree) undo(written []nodeChange, previousMeta *meta) {
+	if previousMeta != nil {
+		t.meta = *previousMeta
+	}
+
+	t.cacheMu.Lock()
+	defer t.cacheMu.Unlock()
+	for _, change := range written {
+		if change.previous == nil {
+			// Nothing refers to a new node
+			_ = t.store.Delete(t.collection, change.id)
+			continue
+		}
+		if err := t.store.Put(t.collection, change.id, change.previous); err != nil {
+			t.nodes.remove(change.id)
+		}
+	}
+}
+
+// pathStep is an internal node visited on the way to a leaf, and the child
+// that was followed
+type pathStep struct {
+	id    string
+	node  *node
+	child int
+}
+
+// findLeaf descends to the leaf where entry belongs
+func (t *BTree) findLeaf(entry Entry) (string, *node, []pathStep, error) {
+	id := t.meta.Root
+	var path []pathStep
+
+	for {
+		n, err := t.load(id)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		if n.Leaf {
+			return id, n, path, nil
+		}
+
+		// Follow the first child whose separator is greater than entry
+		child := sort.Search(len(n.Entries), func(i int) bool {
+			return t.compareEntries(n.Entries[i], entry) > 0
+		})
+		path = append(path, pathStep{id: id, node: n, child: child})
+		id = n.Children[child]
+	}
+}
+
+// Insert adds an entry. Inserting an entry that is already present does
+// nothing.
+func (t *BTree) Insert(key []interface{}, id string) error {
+	normalized, err := normalizeKey(key)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.insert(Entry{Key: normalized, ID: id})
+}
+
+// InsertUnique adds an entry unless another record already has the same
+// key, in which case it returns ErrDuplicateKey. The check and the insert
+// are atomic.
+func (t *BTree) InsertUnique(key []interface{}, id string) error {
+	normalized, err := normalizeKey(key)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ids, err := t.lookup(normalized)
+	if err != nil {
+		return err
+	}
+	for _, existing := range ids {
+		if existing != id {
+			return ErrDuplicateKey
+		}
+	}
+
+	return t.insert(Entry{Key: normalized, ID: id})
+}
+
+// Lookup returns the records indexed under exactly key
+func (t *BTree) Lookup(key []interface{}) ([]string, error) {
+	normalized, err := normalizeKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.lookup(normalized)
+}
+
+func (t *BTree) lookup(key []interface{}) ([]string, error) {
+	var ids []string
+	err := t.scan(key, func(found []interface{}, id string) error {
+		if CompareKeys(found, key) != 0 {
+			return storage.ErrStopScan
+		}
+		ids = append(ids, id)
+		return nil
+	})
+	return ids, err
+}
+
+func (t *BTree) insert(entry Entry) error {
+	leafID, leaf, path, err := t.findLeaf(entry)
+	if err != nil {
+		return err
+	}
+
+	position := sort.Search(len(leaf.Entries), func(i int) bool {
+		return t.compareEntries(leaf.Entries[i], entry) >= 0
+	})
+	if position < len(leaf.Entries) && t.compareEntries(leaf.Entries[position], entry) == 0 {
+		return nil
+	}
+
+	previous := t.meta
+	metaChanged := false
+	for _, value := range entry.Key {
+		if _, isArray := value.([]interface{}); isArray && !t.meta.Multikey {
+			t.meta.Multikey = true
+			metaChanged = true
+		}
+	}
+
+	updated := leaf.clone()
+	updated.Entries = insertEntry(updated.Entries, position, entry)
+	changes := []nodeChange{{id: leafID, node: updated, previous: leaf}}
+
+	// Split overflowing nodes from the leaf upwards
+	currentID, current := leafID, updated
+	for len(current.Entries) > t.order {
+		separator, rightID, right := t.split(current)
+		changes = append(changes, nodeChange{id: rightID, node: right})
+		metaChanged = true
+
+		if len(path) == 0 {
+			rootID := t.newID()
+			root := &node{Entries: []Entry{separator}, Children: []string{currentID, rightID}}
+			changes = append(changes, nodeChange{id: rootID, node: root})
+			t.meta.Root = rootID
+			break
+		}
+
+		step := path[len(path)-1]
+		path = path[:len(path)-1]
+		parent := step.node.clone()
+		parent.Entries = insertEntry(parent.Entries, step.child, separator)
+		parent.Children = insertChild(parent.Children, step.child+1, rightID)
+		changes = append(changes, nodeChange{id: step.id, node: parent, previous: step.node})
+		currentID, current = step.id, parent
+	}
+
+	if !metaChanged {
+		return t.write(changes, nil)
+	}
+	return t.write(changes, &previous)
+}
+
+// split moves the upper half of n, a node not yet written, into a new node
+// and returns the separator to insert into the parent
+func (t *BTree) split(n *node) (Entry, string, *node) {
+	middle := len(n.Entries) / 2
+	rightID := t.newID()
+	right := &node{Leaf: n.Leaf}
+
+	var separator Entry
+	if n.Leaf {
+		right.Entries = append([]Entry{}, n.Entries[middle:]...)
+		n.Entries = n.Entries[:middle:middle]
+		right.Next = n.Next
+		n.Next = rightID
+		separator = right.Entries[0]
+	} else {
+		separator = n.Entries[middle]
+		right.Entries = append([]Entry{}, n.Entries[middle+1:]...)
+		right.Children = append([]string{}, n.Children[middle+1:]...)
+		n.Entries = n.Entries[:middle:middle]
+		n.Children = n.Children[: middle+1 : middle+1]
+	}
+
+	return separator, rightID, right
+}
+
+func insertEntry(entries []Entry, position int, entry Entry) []Entry {
+	entries = append(entries, Entry{})
+	copy(entries[position+1:], entries[position:])
+	entries[position] = entry
+	return entries
+}
+
+func insertChild(children []string, position int, child string) []string {
+	children = append(children, "")
+	copy(children[position+1:], children[position:])
+	children[position] = child
+	return children
+}
+
+// Delete removes an entry. Deleting an entry that is not present does
+// nothing.
+func (t *BTree) Delete(key []interface{}, id string) error {
+	normalized, err := normalizeKey(key)
+	if err != nil {
+		return err
+	}
+	entry := Entry{Key: normalized, ID: id}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	leafID, leaf, _, err := t.findLeaf(entry)
+	if err != nil {
+		return err
+	}
+
+	position := sort.Search(len(leaf.Entries), func(i int) bool {
+		return t.compareEntries(leaf.Entries[i], entry) >= 0
+	})
+	if position == len(leaf.Entries) || t.compareEntries(leaf.Entries[position], entry) != 0 {
+		return nil
+	}
+
+	updated := leaf.clone()
+	updated.Entries = append(updated.Entries[:position], updated.Entries[position+1:]...)
+	return t.write([]nodeChange{{id: leafID, node: updated, previous: leaf}}, nil)
+}
+
+// Scan calls fn with every entry from the first one whose key is at least
+// from, in the tree's order. A nil from starts at the first entry. Returning
+// storage.ErrStopScan from fn ends the scan early without an error. fn must
+// not modify the tree.
+func (t *BTree) Scan(from []interface{}, fn func(key []interface{}, id string) error) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.scan(from, fn)
+}
+
+// ScanFrom calls fn with every entry from the one for key and id onwards, in
+// the tree's order. Unlike Scan it holds the tree's lock only while it reads
+// each leaf, so fn may take its time or change the tree; the scan carries on
+// after the last entry it returned.
+func (t *BTree) ScanFrom(key []interface{}, id string, fn func(key []interface{}, id string) error) error {
+	start := Entry{Key: key, ID: id}
+	inclusive := true
+
+	for {
+		entries, more, err := t.readLeaf(start, inclusive)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if err := fn(entry.Key, entry.ID); err != nil {
+				if errors.Is(err, storage.ErrStopScan) {
+					return nil
+				}
+				return err
+			}
+		}
+
+		if !more {
+			return nil
+		}
+		start, inclusive = entries[len(entries)-1], false
+	}
+}
+
+// readLeaf returns the entries of the first leaf holding any entry from
+// start onwards, and whether later leaves follow
+func (t *BTree) readLeaf(start Entry, inclusive bool) ([]Entry, bool, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	_, leaf, _, err := t.findLeaf(start)
+	if err != nil {
+		return nil, false, err
+	}
+	position := sort.Search(len(leaf.Entries), func(i int) bool {
+		order := t.compareEntries(leaf.Entries[i], start)
+		return order > 0 || (inclusive && order == 0)
+	})
+
+	for position == len(leaf.Entries) {
+		if leaf.Next == "" {
+			return nil, false, nil
+		}
+		if leaf, err = t.load(leaf.Next); err != nil {
+			return nil, false, err
+		}
+		position = 0
+	}
+
+	entries := append([]Entry(nil), leaf.Entries[position:]...)
+	return entries, leaf.Next != "", nil
+}
+
+func (t *BTree) scan(from []interface{}, fn func(key []interface{}, id string) error) error {
+	// from is only compared, never stored, so it needs no normalizing and
+	// may hold values JSON cannot, such as an infinite lower bound
+	start := Entry{Key: from}
+
+	_, leaf, _, err := t.findLeaf(start)
+	if err != nil {
+		return err
+	}
+	position := sort.Search(len(leaf.Entries), func(i int) bool {
+		return t.compareEntries(leaf.Entries[i], start) >= 0
+	})
+
+	for {
+		for _, entry := range leaf.Entries[position:] {
+			if err := fn(entry.Key, entry.ID); err != nil {
+				if errors.Is(err, storage.ErrStopScan) {
+					return nil
+				}
+				return err
+			}
+		}
+
+		if leaf.Next == "" {
+			return nil
+		}
+		if leaf, err = t.load(leaf.Next); err != nil {
+			return err
+		}
+		position = 0
+	}
+}
+
+// Drop deletes every node of the tree
+func (t *BTree) Drop() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return DropCollection(t.store, t.collection)
+}
+
+// DropCollection deletes every document of an index collection
+func DropCollection(store storage.StorageInterface, collection string) error {
+	var keys []string
+	err := store.Scan(collection, func(key string, data []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read index %s: %w", collection, err)
+	}
+
+	for _, key := range keys {
+		if err := store.Delete(collection, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("failed to delete index node %s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// nodeCache is an LRU cache of clean nodes
+type nodeCache struct {
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+type cachedNode struct {
+	id   string
+	node *node
+}
+
+func newNodeCache(capacity int) *nodeCache {
+	return &nodeCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (c *nodeCache) get(id string) (*node, bool) {
+	elem, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cachedNode).node, true
+}
+
+func (c *nodeCache) put(id string, n *node) {
+	if elem, ok := c.entries[id]; ok {
+		elem.Value.(*cachedNode).node = n
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[id] = c.order.PushFront(&cachedNode{id: id, node: n})
+
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedNode).id)
+	}
+}
+
+func (c *nodeCache) remove(id string) {
+	if elem, ok := c.entries[id]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, id)
+	}
+}
@@ -0,0 +1,359 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/adityaparmar9813/NAP/internal/storage"
+)
+
+// DefaultBucketLoad is the average number of entries per bucket above which
+// a hash index grows by another bucket
+const DefaultBucketLoad = 16
+
+// initialBuckets is the number of buckets of an empty hash index
+const initialBuckets = 4
+
+// bucket holds the entries whose hashes map to it
+type bucket struct {
+	Entries []hashEntry `json:"entries"`
+}
+
+type hashEntry struct {
+	Entry
+	Hash uint64 `json:"h"`
+}
+
+type hashMeta struct {
+	// Level doubles the number of buckets addressed by a hash
+	Level int `json:"level"`
+	// Next is the bucket split next
+	Next  int `json:"next"`
+	Count int `json:"count"`
+	// Multikey is set once a record has been indexed under several keys
+	Multikey bool `json:"multikey"`
+}
+
+// HashIndex is a persistent linear hash table of index entries. It finds the
+// records with a key in constant time, but cannot return keys in order.
+// Every bucket is a document in the index's collection, written through on
+// each change, and is created when it first receives an entry.
+//
+// The table grows one bucket at a time: whenever the average load passes
+// DefaultBucketLoad, the next bucket in turn is split in two, so no insert
+// ever rehashes more than one bucket.
+type HashIndex struct {
+	mu         sync.RWMutex
+	store      storage.StorageInterface
+	collection string
+	load       int
+	meta       hashMeta
+
+	cacheMu sync.Mutex
+	buckets map[int]*bucket
+}
+
+// OpenHashIndex opens the hash index stored in collection, creating an empty
+// one if the collection holds none. Every user of an index must share one
+// HashIndex, whose lock and cache cover all of them.
+func OpenHashIndex(store storage.StorageInterface, collection string) (*HashIndex, error) {
+	h := &HashIndex{
+		store:      store,
+		collection: collection,
+		load:       DefaultBucketLoad,
+		buckets:    make(map[int]*bucket),
+	}
+
+	err := store.Get(collection, metaKey, &h.meta)
+	if errors.Is(err, storage.ErrNotFound) {
+		err = h.write(nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index %s: %w", collection, err)
+	}
+
+	return h, nil
+}
+
+// SetBucketLoad changes the average number of entries per bucket above
+// which the table grows. It is meant for tests.
+func (h *HashIndex) SetBucketLoad(load int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if load >= 1 {
+		h.load = load
+	}
+}
+
+// Buckets returns the number of buckets in the table
+func (h *HashIndex) Buckets() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.bucketCount()
+}
+
+func (h *HashIndex) bucketCount() int {
+	return initialBuckets<<h.meta.Level + h.meta.Next
+}
+
+// Multikey reports whether any record has been indexed under several keys
+func (h *HashIndex) Multikey() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.meta.Multikey
+}
+
+// SetMultikey records that a record has been indexed under several keys
+func (h *HashIndex) SetMultikey() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.meta.Multikey {
+		return nil
+	}
+	h.meta.Multikey = true
+	return h.write(nil)
+}
+
+// hashKey hashes the JSON of a normalized key
+func hashKey(key []interface{}) (uint64, error) {
+	data, err := storage.StructToJSON(key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert index key to JSON: %w", err)
+	}
+
+	sum := fnv.New64a()
+	sum.Write(data)
+	return sum.Sum64(), nil
+}
+
+// address returns the bucket holding hash. Buckets before Next have already
+// been split, so they are addressed with one more bit.
+func (h *HashIndex) address(hash uint64) int {
+	size := uint64(initialBuckets << h.meta.Level)
+	address := hash % size
+	if address < uint64(h.meta.Next) {
+		address = hash % (2 * size)
+	}
+	return int(address)
+}
+
+func bucketKey(address int) string {
+	return "b" + strconv.Itoa(address)
+}
+
+func (h *HashIndex) loadBucket(address int) (*bucket, error) {
+	h.cacheMu.Lock()
+	defer h.cacheMu.Unlock()
+
+	if b, cached := h.buckets[address]; cached {
+		return b, nil
+	}
+
+	b := &bucket{}
+	err := h.store.Get(h.collection, bucketKey(address), b)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("failed to load index bucket %d: %w", address, err)
+	}
+	h.buckets[address] = b
+
+	return b, nil
+}
+
+// write persists changed buckets, then the table's metadata
+func (h *HashIndex) write(changed map[int]*bucket) error {
+	for address, b := range changed {
+		if err := h.store.Put(h.collection, bucketKey(address), b); err != nil {
+			return fmt.Errorf("failed to save index bucket %d: %w", address, err)
+		}
+	}
+	if err := h.store.Put(h.collection, metaKey, h.meta); err != nil {
+		return fmt.Errorf("failed to save index %s: %w", h.collection, err)
+	}
+	return nil
+}
+
+// prepare normalizes and hashes a key
+func prepare(key []interface{}) ([]interface{}, uint64, error) {
+	normalized, err := normalizeKey(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	hash, err := hashKey(normalized)
+	if err != nil {
+		return nil, 0, err
+	}
+	return normalized, hash, nil
+}
+
+// Insert adds an entry. Inserting an entry that already exists does nothing.
+func (h *HashIndex) Insert(key []interface{}, id string) error {
+	normalized, hash, err := prepare(key)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.insert(hashEntry{Entry: Entry{Key: normalized, ID: id}, Hash: hash})
+}
+
+// InsertUnique adds an entry unless another record already has the same
+// key, in which case it returns ErrDuplicateKey. The check and the insert
+// are atomic.
+func (h *HashIndex) InsertUnique(key []interface{}, id string) error {
+	normalized, hash, err := prepare(key)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ids, err := h.lookup(normalized, hash)
+	if err != nil {
+		return err
+	}
+	for _, existing := range ids {
+		if existing != id {
+			return ErrDuplicateKey
+		}
+	}
+
+	return h.insert(hashEntry{Entry: Entry{Key: normalized, ID: id}, Hash: hash})
+}
+
+func (h *HashIndex) insert(entry hashEntry) error {
+	address := h.address(entry.Hash)
+	b, err := h.loadBucket(address)
+	if err != nil {
+		return err
+	}
+
+	for _, existing := range b.Entries {
+		if existing.ID == entry.ID && CompareKeys(existing.Key, entry.Key) == 0 {
+			return nil
+		}
+	}
+
+	b.Entries = append(b.Entries, entry)
+	h.meta.Count++
+	changed := map[int]*bucket{address: b}
+
+	if h.meta.Count > h.load*h.bucketCount() {
+		if err := h.split(changed); err != nil {
+			return err
+		}
+	}
+
+	return h.write(changed)
+}
+
+// split moves the entries of bucket Next that address a new bucket once the
+// level gains a bit
+func (h *HashIndex) split(changed map[int]*bucket) error {
+	size := initialBuckets << h.meta.Level
+	from, err := h.loadBucket(h.meta.Next)
+	if err != nil {
+		return err
+	}
+
+	kept := []hashEntry{}
+	moved := &bucket{Entries: []hashEntry{}}
+	for _, entry := range from.Entries {
+		if int(entry.Hash%uint64(2*size)) == h.meta.Next {
+			kept = append(kept, entry)
+		} else {
+			moved.Entries = append(moved.Entries, entry)
+		}
+	}
+	from.Entries = kept
+
+	h.cacheMu.Lock()
+	h.buckets[h.meta.Next+size] = moved
+	h.cacheMu.Unlock()
+	changed[h.meta.Next] = from
+	changed[h.meta.Next+size] = moved
+
+	h.meta.Next++
+	if h.meta.Next == size {
+		h.meta.Level++
+		h.meta.Next = 0
+	}
+
+	return nil
+}
+
+// Lookup returns the records indexed under exactly key, in ID order
+func (h *HashIndex) Lookup(key []interface{}) ([]string, error) {
+	normalized, hash, err := prepare(key)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.lookup(normalized, hash)
+}
+
+func (h *HashIndex) lookup(key []interface{}, hash uint64) ([]string, error) {
+	b, err := h.loadBucket(h.address(hash))
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, entry := range b.Entries {
+		if entry.Hash == hash && CompareKeys(entry.Key, key) == 0 {
+			ids = append(ids, entry.ID)
+		}
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+// Delete removes an entry. Deleting a missing entry does nothing. Buckets
+// are not merged again when entries are deleted.
+func (h *HashIndex) Delete(key []interface{}, id string) error {
+	normalized, hash, err := prepare(key)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	address := h.address(hash)
+	b, err := h.loadBucket(address)
+	if err != nil {
+		return err
+	}
+
+	for i, entry := range b.Entries {
+		if entry.ID == id && CompareKeys(entry.Key, normalized) == 0 {
+			b.Entries = append(b.Entries[:i:i], b.Entries[i+1:]...)
+			h.meta.Count--
+			return h.write(map[int]*bucket{address: b})
+		}
+	}
+
+	return nil
+}
+
+// Drop deletes every bucket of the index
+func (h *HashIndex) Drop() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return DropCollection(h.store, h.collection)
+}
@@ -1,7 +1,88 @@
-package main
+// Package index implements the persistent secondary indexes of a collection.
+// Index nodes are stored as documents in a system collection of the same
+// storage engine as the records they point to. Each node is written on its
+// own, with no log tying it to the record write that caused it, so a crash
+// can leave an index out of step with its records; the schema package
+// rebuilds the indexes after an unclean shutdown.
+package index
 
-import "fmt"
+import (
+	"fmt"
 
-func main() {
-	fmt.Println("Working")
-}
\ No newline at end of file
+	"github.com/adityaparmar9813/NAP/internal/storage"
+	"github.com/adityaparmar9813/NAP/internal/validator"
+)
+
+// Entry is one key of an index and the record it points to. A key holds one
+// value per indexed field.
+type Entry struct {
+	Key []interface{} `json:"k"`
+	ID  string        `json:"id"`
+}
+
+// IndexInterface is implemented by every kind of index: a persistent set of
+// entries that finds the records indexed under a key
+type IndexInterface interface {
+	Insert(key []interface{}, id string) error
+	InsertUnique(key []interface{}, id string) error
+	Delete(key []interface{}, id string) error
+	Lookup(key []interface{}) ([]string, error)
+	Multikey() bool
+	SetMultikey() error
+	Drop() error
+}
+
+// CompareKeys orders index keys field by field with validator.CompareOrder.
+// A key that is a prefix of another sorts first, so a prefix can be used to
+// seek to every key that starts with it. Trees with descending fields order
+// those fields the other way round.
+func CompareKeys(a, b []interface{}) int {
+	return compareDirected(a, b, nil)
+}
+
+// compareLengths orders a key before the longer keys it may be a prefix of
+func compareLengths(a, b []interface{}) int {
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return 0
+}
+
+// compareDirected is CompareKeys with the order of the fields flagged in
+// descending reversed
+func compareDirected(a, b []interface{}, descending []bool) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		order := validator.CompareOrder(a[i], b[i])
+		if i < len(descending) && descending[i] {
+			order = -order
+		}
+		if order != 0 {
+			return order
+		}
+	}
+	return compareLengths(a, b)
+}
+
+// normalizeKey round-trips key through JSON, so that keys compare the same
+// before and after they are persisted
+func normalizeKey(key []interface{}) ([]interface{}, error) {
+	data, err := storage.StructToJSON(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert index key to JSON: %w", err)
+	}
+
+	var normalized []interface{}
+	if err := storage.JSONToStruct(data, &normalized); err != nil {
+		return nil, err
+	}
+
+	return normalized, nil
+}
+
+// Collection is the system collection holding the nodes of an index
+func Collection(collection, name string) string {
+	return "_index." + collection + "." + name
+}
@@ -0,0 +1,348 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/adityaparmar9813/NAP/internal/storage"
+)
+
+// BM25 parameters: k1 limits how much repeating a term raises the score,
+// and b how much a long text lowers it
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+const statsKey = "stats"
+
+// ErrNotSearchable is returned when a text index is asked to look up an
+// exact key
+var ErrNotSearchable = errors.New("text indexes only answer text searches")
+
+// textStats are the totals BM25 weighs terms and text lengths against
+type textStats struct {
+	Documents int `json:"documents"`
+	Terms     int `json:"terms"`
+}
+
+// textDocument holds where each term of a record appears, to match phrases
+type textDocument struct {
+	Positions map[string][]int `json:"positions"`
+}
+
+// TextIndex is a persistent inverted index of the words in records. Its
+// posting lists are a B+tree of [term, frequency, length] keys, one for
+// each term of each record, where length is the number of terms in the
+// record. The positions of a record's terms are kept beside the tree for
+// phrase searches.
+type TextIndex struct {
+	mu         sync.RWMutex
+	store      storage.StorageInterface
+	collection string
+	analyzer   *Analyzer
+	tree       *BTree
+	stats      textStats
+}
+
+// OpenTextIndex opens the text index stored in collection, creating an
+// empty one if the collection holds none. Every user of an index must share
+// one TextIndex, whose lock covers all of them.
+func OpenTextIndex(store storage.StorageInterface, collection string, analyzer *Analyzer) (*TextIndex, error) {
+	tree, err := loadBTree(store, collection, nil)
+	if err != nil {
+		return nil, err
+	}
+	t := &TextIndex{store: store, collection: collection, analyzer: analyzer, tree: tree}
+
+	err = store.Get(collection, statsKey, &t.stats)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("failed to load index %s: %w", collection, err)
+	}
+
+	return t, nil
+}
+
+// analyze returns the terms of the strings in key. Positions continue from
+// one string to the next with a gap, so that phrases do not span strings.
+func (t *TextIndex) analyze(key []interface{}) map[string][]int {
+	positions := make(map[string][]int)
+	offset := 0
+	for _, value := range key {
+		text, isText := value.(string)
+		if !isText {
+			continue
+		}
+
+		terms := t.analyzer.Terms(text)
+		last := 0
+		for _, term := range terms {
+			positions[term.Text] = append(positions[term.Text], offset+term.Position)
+			last = term.Position
+		}
+		offset += last + 2
+	}
+	return positions
+}
+
+func termCount(positions map[string][]int) int {
+	count := 0
+	for _, occurrences := range positions {
+		count += len(occurrences)
+	}
+	return count
+}
+
+func documentKey(id string) string {
+	return "d" + id
+}
+
+// Insert indexes the words of the strings in key for a record. Inserting a
+// record that is already indexed does nothing.
+func (t *TextIndex) Insert(key []interface{}, id string) error {
+	positions := t.analyze(key)
+	if len(positions) == 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var existing textDocument
+	err := t.store.Get(t.collection, documentKey(id), &existing)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("failed to load index document %s: %w", id, err)
+	}
+
+	length := termCount(positions)
+	for term, occurrences := range positions {
+		if err := t.tree.Insert([]interface{}{term, len(occurrences), length}, id); err != nil {
+			return err
+		}
+	}
+	if err := t.store.Put(t.collection, documentKey(id), textDocument{Positions: positions}); err != nil {
+		return fmt.Errorf("failed to save index document %s: %w", id, err)
+	}
+
+	t.stats.Documents++
+	t.stats.Terms += length
+	return t.writeStats()
+}
+
+// InsertUnique fails: text indexes cannot be unique
+func (t *TextIndex) InsertUnique(key []interface{}, id string) error {
+	return ErrNotSearchable
+}
+
+// Lookup fails: text indexes are searched with Search
+func (t *TextIndex) Lookup(key []interface{}) ([]string, error) {
+	return nil, ErrNotSearchable
+}
+
+// Delete removes the words of the strings in key for a record. Deleting a
+// record that is not indexed does nothing.
+func (t *TextIndex) Delete(key []interface{}, id string) error {
+	positions := t.analyze(key)
+	if len(positions) == 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	err := t.store.Delete(t.collection, documentKey(id))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete index document %s: %w", id, err)
+	}
+
+	length := termCount(positions)
+	for term, occurrences := range positions {
+		if err := t.tree.Delete([]interface{}{term, len(occurrences), length}, id); err != nil {
+			return err
+		}
+	}
+
+	t.stats.Documents--
+	t.stats.Terms -= length
+	return t.writeStats()
+}
+
+func (t *TextIndex) writeStats() error {
+	if err := t.store.Put(t.collection, statsKey, t.stats); err != nil {
+		return fmt.Errorf("failed to save index %s: %w", t.collection, err)
+	}
+	return nil
+}
+
+// Multikey is always false: every record has a single entry per term
+func (t *TextIndex) Multikey() bool {
+	return false
+}
+
+// SetMultikey does nothing
+func (t *TextIndex) SetMultikey() error {
+	return nil
+}
+
+// Drop deletes the posting lists and positions of the index
+func (t *TextIndex) Drop() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return DropCollection(t.store, t.collection)
+}
+
+// posting is an entry of a term's posting list
+type posting struct {
+	id                string
+	frequency, length float64
+}
+
+// postings returns the posting lists of the terms from the first one at
+// least from, by term. keep reports whether a term's postings are wanted
+// and whether to read any further.
+func (t *TextIndex) postings(from string, keep func(term string) (bool, bool)) (map[string][]posting, error) {
+	lists := make(map[string][]posting)
+	err := t.tree.Scan([]interface{}{from}, func(key []interface{}, id string) error {
+		term, _ := key[0].(string)
+		matches, more := keep(term)
+		if !more {
+			return storage.ErrStopScan
+		}
+		if matches {
+			frequency, _ := key[1].(float64)
+			length, _ := key[2].(float64)
+			lists[term] = append(lists[term], posting{id: id, frequency: frequency, length: length})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index %s: %w", t.collection, err)
+	}
+	return lists, nil
+}
+
+// Search returns the BM25 score of every record matching query. Records
+// match any of the query's words and prefixes; when the query has phrases,
+// only records containing all of them match.
+func (t *TextIndex) Search(query TextQuery) (map[string]float64, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	terms := make(map[string]bool)
+	for _, word := range query.Words {
+		for _, term := range t.analyzer.Terms(word) {
+			terms[term.Text] = true
+		}
+	}
+	var phrases [][]Term
+	for _, phrase := range query.Phrases {
+		analyzed := t.analyzer.Terms(phrase)
+		for _, term := range analyzed {
+			terms[term.Text] = true
+		}
+		if len(analyzed) > 0 {
+			phrases = append(phrases, analyzed)
+		}
+	}
+
+	lists := make(map[string][]posting)
+	for term := range terms {
+		found, err := t.postings(term, func(found string) (bool, bool) {
+			return true, found == term
+		})
+		if err != nil {
+			return nil, err
+		}
+		lists[term] = found[term]
+	}
+	// Prefixes are matched against stems, so they are only lowercased
+	for _, prefix := range query.Prefixes {
+		prefix = strings.ToLower(prefix)
+		found, err := t.postings(prefix, func(term string) (bool, bool) {
+			return true, strings.HasPrefix(term, prefix)
+		})
+		if err != nil {
+			return nil, err
+		}
+		for term, list := range found {
+			lists[term] = list
+		}
+	}
+
+	scores := t.score(lists)
+	for _, phrase := range phrases {
+		for id := range scores {
+			contains, err := t.containsPhrase(id, phrase)
+			if err != nil {
+				return nil, err
+			}
+			if !contains {
+				delete(scores, id)
+			}
+		}
+	}
+
+	return scores, nil
+}
+
+// score adds up the BM25 weight of each term for each record
+func (t *TextIndex) score(lists map[string][]posting) map[string]float64 {
+	scores := make(map[string]float64)
+	if t.stats.Documents == 0 {
+		return scores
+	}
+
+	documents := float64(t.stats.Documents)
+	averageLength := float64(t.stats.Terms) / documents
+	for _, list := range lists {
+		frequency := float64(len(list))
+		idf := math.Log(1 + (documents-frequency+0.5)/(frequency+0.5))
+		for _, p := range list {
+			norm := bm25K1 * (1 - bm25B + bm25B*p.length/averageLength)
+			scores[p.id] += idf * p.frequency * (bm25K1 + 1) / (p.frequency + norm)
+		}
+	}
+	return scores
+}
+
+// containsPhrase reports whether the terms of phrase appear in a record at
+// the same distances from each other as in the phrase
+func (t *TextIndex) containsPhrase(id string, phrase []Term) (bool, error) {
+	var document textDocument
+	if err := t.store.Get(t.collection, documentKey(id), &document); err != nil {
+		return false, fmt.Errorf("failed to load index document %s: %w", id, err)
+	}
+
+	for _, start := range document.Positions[phrase[0].Text] {
+		matched := true
+		for _, term := range phrase[1:] {
+			if !containsInt(document.Positions[term.Text], start+term.Position-phrase[0].Position) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,926 @@
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/adityaparmar9813/NAP/internal/storage"
+	"github.com/adityaparmar9813/NAP/internal/validator"
+)
+
+// Aggregate runs a pipeline of stages over the collection and returns the
+// documents that come out of the last stage. Each stage is a document with a
+// single key naming it:
+//
+//	$match     criteria, as accepted by GetRecord; only the first stage may
+//	           search the text index with $text
+//	$project   fields to include (1) or exclude (0), or expressions to compute
+//	$addFields expressions to compute, keeping every other field
+//	$group     {"_id": <expression>, <field>: {<accumulator>: <expression>}}
+//	           with the accumulators $sum, $avg, $min, $max, $push and $count
+//	$sort      {<field>: 1 or -1}, or a list of them for several keys
+//	$skip      number of documents to drop
+//	$limit     number of documents to keep
+//	$unwind    "$<field>", or {"path": "$<field>", "includeArrayIndex": <field>,
+//	           "preserveNullAndEmptyArrays": <bool>}
+//	$lookup    {"from": <collection>, "localField": <field>,
+//	           "foreignField": <field>, "as": <field>} stores the documents of
+//	           another collection whose foreignField equals localField
+//
+// Expressions are field references such as "$address.city", literal values,
+// documents of expressions, and the operators $literal, $add, $subtract,
+// $multiply, $divide, $concat and $ifNull.
+func (s *Schema) Aggregate(ctx context.Context, pipeline []map[string]interface{}, store storage.StorageInterface) ([]map[string]interface{}, error) {
+	stages, err := compilePipeline(pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the scan can use the text index
+	for i, stage := range stages {
+		if _, isText := stage.criteria["$text"]; isText && i > 0 {
+			return nil, fmt.Errorf("$text is only allowed in the first $match stage")
+		}
+	}
+
+	// Leading $match stages filter the scan itself
+	criteria := map[string]interface{}{}
+	var filters []interface{}
+	for len(stages) > 0 && stages[0].match != nil {
+		filters = append(filters, stages[0].criteria)
+		stages = stages[1:]
+	}
+	if len(filters) == 1 {
+		criteria = filters[0].(map[string]interface{})
+	} else if len(filters) > 1 {
+		criteria = map[string]interface{}{"$and": filters}
+		// $text stays a top-level condition
+		if search, isText := filters[0].(map[string]interface{})["$text"]; isText {
+			first := make(map[string]interface{})
+			for key, condition := range filters[0].(map[string]interface{}) {
+				if key != "$text" {
+					first[key] = condition
+				}
+			}
+			filters[0] = first
+			criteria["$text"] = search
+		}
+	}
+
+	docs, err := s.readAll(ctx, criteria, store)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stage := range stages {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if stage.lookup != nil {
+			docs, err = stage.lookup.run(ctx, docs, s.state().catalog, store)
+		} else {
+			docs, err = stage.run(docs)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", stage.name, err)
+		}
+	}
+
+	return docs, nil
+}
+
+// readAll streams every record matching criteria into a slice
+func (s *Schema) readAll(ctx context.Context, criteria map[string]interface{}, store storage.StorageInterface) ([]map[string]interface{}, error) {
+	cursor, err := s.Find(ctx, criteria, store)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	var docs []map[string]interface{}
+	for cursor.Next(ctx) {
+		docs = append(docs, cursor.current)
+	}
+
+	return docs, cursor.Err()
+}
+
+type pipelineStage struct {
+	name string
+	run  func(docs []map[string]interface{}) ([]map[string]interface{}, error)
+
+	// match and criteria are set for $match stages
+	match    *validator.Query
+	criteria map[string]interface{}
+
+	// lookup is set, instead of run, for $lookup stages, which read from
+	// storage
+	lookup *lookupStage
+}
+
+var stageCompilers = map[string]func(spec interface{}) (*pipelineStage, error){
+	"$match":     compileMatchStage,
+	"$project":   compileProjectStage,
+	"$addFields": compileAddFieldsStage,
+	"$group":     compileGroupStage,
+	"$sort":      compileSortStage,
+	"$skip":      compileSkipStage,
+	"$limit":     compileLimitStage,
+	"$unwind":    compileUnwindStage,
+	"$lookup":    compileLookupStage,
+}
+
+func compilePipeline(pipeline []map[string]interface{}) ([]*pipelineStage, error) {
+	stages := make([]*pipelineStage, 0, len(pipeline))
+	for i, spec := range pipeline {
+		if len(spec) != 1 {
+			return nil, fmt.Errorf("stage %d must have exactly one key", i)
+		}
+
+		for name, value := range spec {
+			compile, known := stageCompilers[name]
+			if !known {
+				return nil, fmt.Errorf("stage %d: unknown stage '%s'", i, name)
+			}
+
+			stage, err := compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("stage %d: %s: %w", i, name, err)
+			}
+			stage.name = name
+			stages = append(stages, stage)
+		}
+	}
+
+	return stages, nil
+}
+
+func compileMatchStage(spec interface{}) (*pipelineStage, error) {
+	criteria, ok := spec.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expects criteria")
+	}
+
+	query, err := validator.Compile(criteria)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pipelineStage{
+		match:    query,
+		criteria: criteria,
+		run: func(docs []map[string]interface{}) ([]map[string]interface{}, error) {
+			kept := docs[:0]
+			for _, doc := range docs {
+				if query.Matches(doc) {
+					kept = append(kept, doc)
+				}
+			}
+			return kept, nil
+		},
+	}, nil
+}
+
+// isProjectionFlag reports whether a $project value includes or excludes a
+// field rather than computing it
+func isProjectionFlag(value interface{}) bool {
+	_, err := projectionFlag(value)
+	return err == nil
+}
+
+func compileProjectStage(spec interface{}) (*pipelineStage, error) {
+	fields, ok := spec.(map[string]interface{})
+	if !ok || len(fields) == 0 {
+		return nil, fmt.Errorf("expects a non-empty document")
+	}
+
+	flags := make(map[string]interface{})
+	computed := make(map[string]interface{})
+	for field, value := range fields {
+		if isProjectionFlag(value) {
+			flags[field] = value
+		} else {
+			computed[field] = value
+		}
+	}
+
+	for field, value := range flags {
+		if include, _ := projectionFlag(value); !include && field != "uuid" && len(computed) > 0 {
+			return nil, fmt.Errorf("cannot exclude '%s' while computing fields", field)
+		}
+	}
+	if err := checkExpressions(computed); err != nil {
+		return nil, err
+	}
+
+	p, err := compileProjection(flags)
+	if err != nil {
+		return nil, err
+	}
+	if len(computed) > 0 && (p == nil || !p.include) {
+		// Computed fields imply an inclusion projection, which keeps the
+		// uuid unless it was excluded
+		p = &projection{fields: projectionNode{}, include: true, excludeUUID: p != nil && p.excludeUUID}
+	}
+
+	return &pipelineStage{
+		run: func(docs []map[string]interface{}) ([]map[string]interface{}, error) {
+			for i, doc := range docs {
+				projected := p.apply(doc)
+				if p != nil && p.include {
+					projected = copyDocument(projected)
+				}
+				if err := setComputedFields(projected, doc, computed); err != nil {
+					return nil, err
+				}
+				docs[i] = projected
+			}
+			return docs, nil
+		},
+	}, nil
+}
+
+func compileAddFieldsStage(spec interface{}) (*pipelineStage, error) {
+	fields, ok := spec.(map[string]interface{})
+	if !ok || len(fields) == 0 {
+		return nil, fmt.Errorf("expects a non-empty document")
+	}
+	if err := checkExpressions(fields); err != nil {
+		return nil, err
+	}
+
+	return &pipelineStage{
+		run: func(docs []map[string]interface{}) ([]map[string]interface{}, error) {
+			for i, doc := range docs {
+				updated := copyDocument(doc)
+				if err := setComputedFields(updated, doc, fields); err != nil {
+					return nil, err
+				}
+				docs[i] = updated
+			}
+			return docs, nil
+		},
+	}, nil
+}
+
+// setComputedFields evaluates each expression against source and stores the
+// result in target
+func setComputedFields(target, source map[string]interface{}, fields map[string]interface{}) error {
+	paths := make([]string, 0, len(fields))
+	for path := range fields {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		value, err := evaluate(fields[path], source)
+		if err != nil {
+			return fmt.Errorf("field '%s': %w", path, err)
+		}
+		if err := setPath(target, path, value); err != nil {
+			return fmt.Errorf("field '%s': %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// copyDocument deep-copies the documents and arrays in doc, so that stages
+// may change their output without touching documents shared with others
+func copyDocument(doc map[string]interface{}) map[string]interface{} {
+	return copyValue(doc).(map[string]interface{})
+}
+
+func copyValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(typed))
+		for key, element := range typed {
+			copied[key] = copyValue(element)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(typed))
+		for i, element := range typed {
+			copied[i] = copyValue(element)
+		}
+		return copied
+	default:
+		return value
+	}
+}
+
+// groupAccumulators create the state for one accumulator of one group
+var groupAccumulators = map[string]func() accumulator{
+	"$sum":   func() accumulator { return &sumAccumulator{} },
+	"$avg":   func() accumulator { return &avgAccumulator{} },
+	"$min":   func() accumulator { return &extremeAccumulator{want: -1} },
+	"$max":   func() accumulator { return &extremeAccumulator{want: 1} },
+	"$push":  func() accumulator { return &pushAccumulator{values: []interface{}{}} },
+	"$count": func() accumulator { return &sumAccumulator{} },
+}
+
+type accumulator interface {
+	add(value interface{})
+	result() interface{}
+}
+
+type sumAccumulator struct {
+	total float64
+}
+
+// add ignores values that are not numbers, as MongoDB does
+func (a *sumAccumulator) add(value interface{}) {
+	if number, ok := validator.ToFloat(value); ok {
+		a.total += number
+	}
+}
+
+func (a *sumAccumulator) result() interface{} {
+	return a.total
+}
+
+type avgAccumulator struct {
+	total float64
+	count int
+}
+
+func (a *avgAccumulator) add(value interface{}) {
+	if number, ok := validator.ToFloat(value); ok {
+		a.total += number
+		a.count++
+	}
+}
+
+func (a *avgAccumulator) result() interface{} {
+	if a.count == 0 {
+		return nil
+	}
+	return a.total / float64(a.count)
+}
+
+// extremeAccumulator keeps the smallest (want -1) or largest (want 1) value,
+// ignoring nulls and missing fields
+type extremeAccumulator struct {
+	want  int
+	value interface{}
+}
+
+func (a *extremeAccumulator) add(value interface{}) {
+	if value == nil {
+		return
+	}
+	if a.value == nil || validator.CompareOrder(value, a.value) == a.want {
+		a.value = value
+	}
+}
+
+func (a *extremeAccumulator) result() interface{} {
+	return a.value
+}
+
+type pushAccumulator struct {
+	values []interface{}
+}
+
+func (a *pushAccumulator) add(value interface{}) {
+	a.values = append(a.values, value)
+}
+
+func (a *pushAccumulator) result() interface{} {
+	return a.values
+}
+
+type groupField struct {
+	name        string
+	accumulator string
+	expression  interface{}
+}
+
+type group struct {
+	id           interface{}
+	accumulators []accumulator
+}
+
+func compileGroupStage(spec interface{}) (*pipelineStage, error) {
+	fields, ok := spec.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expects a document")
+	}
+
+	idExpression, hasID := fields["_id"]
+	if !hasID {
+		return nil, fmt.Errorf("a group specification must include an _id")
+	}
+	if err := checkExpression(idExpression); err != nil {
+		return nil, fmt.Errorf("_id: %w", err)
+	}
+
+	var groupFields []groupField
+	for name, value := range fields {
+		if name == "_id" {
+			continue
+		}
+		if strings.Contains(name, ".") {
+			return nil, fmt.Errorf("field '%s' cannot contain '.'", name)
+		}
+
+		operator, ok := value.(map[string]interface{})
+		if !ok || len(operator) != 1 {
+			return nil, fmt.Errorf("field '%s' must be an accumulator", name)
+		}
+		for accumulator, expression := range operator {
+			if _, known := groupAccumulators[accumulator]; !known {
+				return nil, fmt.Errorf("field '%s': unknown accumulator '%s'", name, accumulator)
+			}
+			if accumulator == "$count" {
+				if options, ok := expression.(map[string]interface{}); !ok || len(options) != 0 {
+					return nil, fmt.Errorf("field '%s': $count takes an empty document", name)
+				}
+				expression = 1
+			}
+			if err := checkExpression(expression); err != nil {
+				return nil, fmt.Errorf("field '%s': %w", name, err)
+			}
+			groupFields = append(groupFields, groupField{name: name, accumulator: accumulator, expression: expression})
+		}
+	}
+	sort.Slice(groupFields, func(i, j int) bool { return groupFields[i].name < groupFields[j].name })
+
+	return &pipelineStage{
+		run: func(docs []map[string]interface{}) ([]map[string]interface{}, error) {
+			// Groups come out in the order their first document came in
+			var order []*group
+			groups := make(map[string]*group)
+
+			for _, doc := range docs {
+				id, err := evaluate(idExpression, doc)
+				if err != nil {
+					return nil, fmt.Errorf("_id: %w", err)
+				}
+				key, err := groupKey(id)
+				if err != nil {
+					return nil, err
+				}
+
+				g, exists := groups[key]
+				if !exists {
+					g = &group{id: id}
+					for _, field := range groupFields {
+						g.accumulators = append(g.accumulators, groupAccumulators[field.accumulator]())
+					}
+					groups[key] = g
+					order = append(order, g)
+				}
+
+				for i, field := range groupFields {
+					value, err := evaluate(field.expression, doc)
+					if err != nil {
+						return nil, fmt.Errorf("field '%s': %w", field.name, err)
+					}
+					g.accumulators[i].add(value)
+				}
+			}
+
+			results := make([]map[string]interface{}, 0, len(order))
+			for _, g := range order {
+				result := map[string]interface{}{"_id": g.id}
+				for i, field := range groupFields {
+					result[field.name] = g.accumulators[i].result()
+				}
+				results = append(results, result)
+			}
+			return results, nil
+		},
+	}, nil
+}
+
+// groupKey identifies a group id. Numbers are normalized so that 1 and 1.0
+// fall in the same group.
+func groupKey(id interface{}) (string, error) {
+	data, err := json.Marshal(normalizeNumbers(id))
+	if err != nil {
+		return "", fmt.Errorf("failed to encode group id: %w", err)
+	}
+	return string(data), nil
+}
+
+func normalizeNumbers(value interface{}) interface{} {
+	if number, ok := validator.ToFloat(value); ok {
+		return number
+	}
+
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		normalized := make(map[string]interface{}, len(typed))
+		for key, element := range typed {
+			normalized[key] = normalizeNumbers(element)
+		}
+		return normalized
+	case []interface{}:
+		normalized := make([]interface{}, len(typed))
+		for i, element := range typed {
+			normalized[i] = normalizeNumbers(element)
+		}
+		return normalized
+	}
+
+	return value
+}
+
+func compileSortStage(spec interface{}) (*pipelineStage, error) {
+	fields, err := parseSortSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pipelineStage{
+		run: func(docs []map[string]interface{}) ([]map[string]interface{}, error) {
+			keys := make([][]interface{}, len(docs))
+			for i, doc := range docs {
+				keys[i] = sortKeys(doc, fields)
+			}
+
+			indexes := make([]int, len(docs))
+			for i := range indexes {
+				indexes[i] = i
+			}
+			sort.SliceStable(indexes, func(i, j int) bool {
+				return comparePositions(keys[indexes[i]], "", keys[indexes[j]], "", fields) < 0
+			})
+
+			sorted := make([]map[string]interface{}, len(docs))
+			for i, index := range indexes {
+				sorted[i] = docs[index]
+			}
+			return sorted, nil
+		},
+	}, nil
+}
+
+// parseSortSpec reads the keys of a $sort stage. Go maps are unordered, so
+// several keys must be given as a list of single-key documents or as
+// []SortField.
+func parseSortSpec(spec interface{}) ([]SortField, error) {
+	var keys []map[string]interface{}
+
+	switch typed := spec.(type) {
+	case []SortField:
+		if len(typed) == 0 {
+			return nil, fmt.Errorf("expects at least one key")
+		}
+		return typed, nil
+	case map[string]interface{}:
+		if len(typed) > 1 {
+			return nil, fmt.Errorf("list several sort keys as an array of documents to fix their order")
+		}
+		keys = []map[string]interface{}{typed}
+	case []interface{}:
+		for _, item := range typed {
+			key, ok := item.(map[string]interface{})
+			if !ok || len(key) != 1 {
+				return nil, fmt.Errorf("expects single-key documents")
+			}
+			keys = append(keys, key)
+		}
+	default:
+		return nil, fmt.Errorf("expects a document")
+	}
+
+	var fields []SortField
+	for _, key := range keys {
+		for field, direction := range key {
+			number, _ := validator.ToFloat(direction)
+			switch number {
+			case 1:
+				fields = append(fields, SortField{Field: field, Order: Ascending})
+			case -1:
+				fields = append(fields, SortField{Field: field, Order: Descending})
+			default:
+				return nil, fmt.Errorf("sort direction for '%s' must be 1 or -1", field)
+			}
+		}
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("expects at least one key")
+	}
+
+	return fields, nil
+}
+
+// countOperand reads the non-negative count taken by $skip and $limit
+func countOperand(spec interface{}) (int, error) {
+	number, ok := validator.ToFloat(spec)
+	if !ok || number < 0 || number != float64(int(number)) {
+		return 0, fmt.Errorf("expects a non-negative integer")
+	}
+	return int(number), nil
+}
+
+func compileSkipStage(spec interface{}) (*pipelineStage, error) {
+	skip, err := countOperand(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pipelineStage{
+		run: func(docs []map[string]interface{}) ([]map[string]interface{}, error) {
+			if skip >= len(docs) {
+				return nil, nil
+			}
+			return docs[skip:], nil
+		},
+	}, nil
+}
+
+func compileLimitStage(spec interface{}) (*pipelineStage, error) {
+	limit, err := countOperand(spec)
+	if err != nil {
+		return nil, err
+	}
+	if limit == 0 {
+		return nil, fmt.Errorf("expects a positive integer")
+	}
+
+	return &pipelineStage{
+		run: func(docs []map[string]interface{}) ([]map[string]interface{}, error) {
+			if limit < len(docs) {
+				return docs[:limit], nil
+			}
+			return docs, nil
+		},
+	}, nil
+}
+
+func compileUnwindStage(spec interface{}) (*pipelineStage, error) {
+	var path, indexField string
+	preserve := false
+
+	switch typed := spec.(type) {
+	case string:
+		path = typed
+	case map[string]interface{}:
+		for key, value := range typed {
+			var ok bool
+			switch key {
+			case "path":
+				path, ok = value.(string)
+			case "includeArrayIndex":
+				indexField, ok = value.(string)
+				ok = ok && indexField != "" && !strings.HasPrefix(indexField, "$")
+			case "preserveNullAndEmptyArrays":
+				preserve, ok = value.(bool)
+			}
+			if !ok {
+				return nil, fmt.Errorf("invalid option '%s'", key)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("expects a field path or a document")
+	}
+
+	if !strings.HasPrefix(path, "$") || len(path) < 2 {
+		return nil, fmt.Errorf("path must be a field path starting with '$'")
+	}
+	path = path[1:]
+
+	return &pipelineStage{
+		run: func(docs []map[string]interface{}) ([]map[string]interface{}, error) {
+			var unwound []map[string]interface{}
+			for _, doc := range docs {
+				value, exists := fieldValue(doc, path)
+				array, isArray := value.([]interface{})
+
+				if !isArray && exists && value != nil {
+					// A value that is not an array unwinds to itself
+					kept := doc
+					if indexField != "" {
+						kept = copyDocument(doc)
+						kept[indexField] = nil
+					}
+					unwound = append(unwound, kept)
+					continue
+				}
+				if len(array) == 0 {
+					if preserve {
+						kept := doc
+						if indexField != "" {
+							kept = copyDocument(doc)
+							kept[indexField] = nil
+						}
+						unwound = append(unwound, kept)
+					}
+					continue
+				}
+
+				for i, element := range array {
+					expanded := copyDocument(doc)
+					if err := setPath(expanded, path, copyValue(element)); err != nil {
+						return nil, err
+					}
+					if indexField != "" {
+						expanded[indexField] = float64(i)
+					}
+					unwound = append(unwound, expanded)
+				}
+			}
+			return unwound, nil
+		},
+	}, nil
+}
+
+// expressionOperators evaluate operator expressions over their evaluated
+// arguments. $literal and $ifNull are handled in evaluate.
+var expressionOperators = map[string]func(args []interface{}) (interface{}, error){
+	"$add": func(args []interface{}) (interface{}, error) {
+		return arithmeticExpression(args, 0, func(total, value float64) (float64, error) { return total + value, nil })
+	},
+	"$multiply": func(args []interface{}) (interface{}, error) {
+		return arithmeticExpression(args, 1, func(total, value float64) (float64, error) { return total * value, nil })
+	},
+	"$subtract": func(args []interface{}) (interface{}, error) {
+		return binaryExpression(args, func(a, b float64) (float64, error) { return a - b, nil })
+	},
+	"$divide": func(args []interface{}) (interface{}, error) {
+		return binaryExpression(args, func(a, b float64) (float64, error) {
+			if b == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			return a / b, nil
+		})
+	},
+	"$concat": func(args []interface{}) (interface{}, error) {
+		var builder strings.Builder
+		for _, arg := range args {
+			if arg == nil {
+				return nil, nil
+			}
+			text, ok := arg.(string)
+			if !ok {
+				return nil, fmt.Errorf("$concat only supports strings, got %v", arg)
+			}
+			builder.WriteString(text)
+		}
+		return builder.String(), nil
+	},
+}
+
+// checkExpressions reports the first invalid expression among fields
+func checkExpressions(fields map[string]interface{}) error {
+	for field, expression := range fields {
+		if err := checkExpression(expression); err != nil {
+			return fmt.Errorf("field '%s': %w", field, err)
+		}
+	}
+	return nil
+}
+
+// checkExpression rejects unknown operators before a pipeline runs
+func checkExpression(expression interface{}) error {
+	switch typed := expression.(type) {
+	case map[string]interface{}:
+		for key, value := range typed {
+			if !strings.HasPrefix(key, "$") {
+				if err := checkExpression(value); err != nil {
+					return err
+				}
+				continue
+			}
+			if len(typed) != 1 {
+				return fmt.Errorf("an operator expression must have a single key")
+			}
+			if key == "$literal" {
+				return nil
+			}
+			if _, known := expressionOperators[key]; !known && key != "$ifNull" {
+				return fmt.Errorf("unknown expression operator '%s'", key)
+			}
+			return checkExpression(value)
+		}
+	case []interface{}:
+		for _, element := range typed {
+			if err := checkExpression(element); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// evaluate computes an expression against doc
+func evaluate(expression interface{}, doc map[string]interface{}) (interface{}, error) {
+	switch typed := expression.(type) {
+	case string:
+		if strings.HasPrefix(typed, "$") && len(typed) > 1 {
+			value, _ := fieldValue(doc, typed[1:])
+			return value, nil
+		}
+		return typed, nil
+	case []interface{}:
+		values := make([]interface{}, len(typed))
+		for i, element := range typed {
+			value, err := evaluate(element, doc)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	case map[string]interface{}:
+		if len(typed) == 1 {
+			for key, operand := range typed {
+				if strings.HasPrefix(key, "$") {
+					return evaluateOperator(key, operand, doc)
+				}
+			}
+		}
+
+		result := make(map[string]interface{}, len(typed))
+		for key, element := range typed {
+			value, err := evaluate(element, doc)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = value
+		}
+		return result, nil
+	default:
+		return expression, nil
+	}
+}
+
+func evaluateOperator(operator string, operand interface{}, doc map[string]interface{}) (interface{}, error) {
+	if operator == "$literal" {
+		return operand, nil
+	}
+
+	args, ok := operand.([]interface{})
+	if !ok {
+		args = []interface{}{operand}
+	}
+
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		value, err := evaluate(arg, doc)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+
+	if operator == "$ifNull" {
+		// The first argument that is not null, or the last one
+		for _, value := range values[:len(values)-1] {
+			if value != nil {
+				return value, nil
+			}
+		}
+		return values[len(values)-1], nil
+	}
+
+	result, err := expressionOperators[operator](values)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operator, err)
+	}
+	return result, nil
+}
+
+// arithmeticExpression folds numeric arguments. A null argument makes the
+// result null.
+func arithmeticExpression(args []interface{}, start float64, fold func(total, value float64) (float64, error)) (interface{}, error) {
+	total := start
+	for _, arg := range args {
+		if arg == nil {
+			return nil, nil
+		}
+		number, ok := validator.ToFloat(arg)
+		if !ok {
+			return nil, fmt.Errorf("expects numbers, got %v", arg)
+		}
+		var err error
+		if total, err = fold(total, number); err != nil {
+			return nil, err
+		}
+	}
+	return total, nil
+}
+
+func binaryExpression(args []interface{}, apply func(a, b float64) (float64, error)) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("expects two arguments")
+	}
+	if args[0] == nil || args[1] == nil {
+		return nil, nil
+	}
+
+	a, ok := validator.ToFloat(args[0])
+	b, ok2 := validator.ToFloat(args[1])
+	if !ok || !ok2 {
+		return nil, fmt.Errorf("expects numbers, got %v and %v", args[0], args[1])
+	}
+
+	return apply(a, b)
+}
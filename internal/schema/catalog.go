@@ -0,0 +1,240 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/adityaparmar9813/NAP/internal/index"
+	"github.com/adityaparmar9813/NAP/internal/storage"
+)
+
+var (
+	// ErrSchemaConflict is returned when a collection already exists with a
+	// different definition
+	ErrSchemaConflict = errors.New("collection already exists with a different schema")
+	// ErrCollectionNotFound is returned for collections missing from the catalog
+	ErrCollectionNotFound = errors.New("collection not found")
+)
+
+// stateCollection holds a marker that is present while a process has the
+// storage engine open, so that the next one can tell it did not close
+// cleanly
+const stateCollection = "_state"
+
+const openMarker = "open"
+
+// Catalog holds every schema persisted in a storage engine, so collections
+// defined by an earlier run are available without redefining them in code.
+// It hands out one Schema per collection, whose state every write and query
+// of the collection goes through.
+type Catalog struct {
+	mu      sync.RWMutex
+	storage storage.StorageInterface
+	schemas map[string]*Schema
+}
+
+// collection is the state of a collection that all its users share: the
+// lock serializing its writes, the index definitions in use and the open
+// index structures. The Catalog keeps one per collection; a Schema built
+// outside a Catalog has its own.
+type collection struct {
+	// mu serializes writes to the collection
+	mu sync.Mutex
+	// catalog holds the collection, or is nil
+	catalog *Catalog
+
+	// indexMu guards definitions and indexes
+	indexMu     sync.RWMutex
+	definitions []Index
+	indexes     map[string]index.IndexInterface
+}
+
+func newCollection(catalog *Catalog, definitions []Index) *collection {
+	return &collection{
+		catalog:     catalog,
+		definitions: append([]Index(nil), definitions...),
+		indexes:     make(map[string]index.IndexInterface),
+	}
+}
+
+// state returns the state of the collection the schema describes
+func (s *Schema) state() *collection {
+	s.sharedOnce.Do(func() {
+		if s.shared == nil {
+			s.indexMu.RLock()
+			s.shared = newCollection(nil, s.Indexes)
+			s.indexMu.RUnlock()
+		}
+	})
+	return s.shared
+}
+
+// adopt makes the catalog's state the state of a schema it holds
+func (c *Catalog) adopt(schema *Schema) {
+	schema.shared = newCollection(c, schema.Indexes)
+	c.schemas[schema.Name] = schema
+}
+
+// LoadCatalog reads every schema definition saved in store
+func LoadCatalog(store storage.StorageInterface) (*Catalog, error) {
+	catalog := &Catalog{
+		storage: store,
+		schemas: make(map[string]*Schema),
+	}
+
+	err := store.Scan(storage.SchemaCollection, func(key string, data []byte) error {
+		schema := NewSchema(key)
+		if err := storage.JSONToStruct(data, schema); err != nil {
+			return fmt.Errorf("failed to load schema '%s': %w", key, err)
+		}
+		if schema.Name != key {
+			return fmt.Errorf("schema '%s' is saved under the name '%s'", schema.Name, key)
+		}
+
+		catalog.adopt(schema)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return catalog, nil
+}
+
+// Create defines a collection. Creating a collection that already exists
+// with the same fields returns the existing schema; a different definition
+// is rejected with ErrSchemaConflict.
+func (c *Catalog) Create(name string, fields ...Field) (*Schema, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	schema, err := BuildSchema(name, c.storage, fields...)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing, exists := c.schemas[name]; exists {
+		return existing, nil
+	}
+	c.adopt(schema)
+
+	return schema, nil
+}
+
+// Get returns the schema of a collection
+func (c *Catalog) Get(name string) (*Schema, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	schema, exists := c.schemas[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrCollectionNotFound, name)
+	}
+
+	return schema, nil
+}
+
+// List returns the names of every collection, sorted
+func (c *Catalog) List() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	names := make([]string, 0, len(c.schemas))
+	for name := range c.schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Drop deletes every record in a collection, its indexes and then its schema
+func (c *Catalog) Drop(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	schema, exists := c.schemas[name]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrCollectionNotFound, name)
+	}
+
+	var keys []string
+	err := c.storage.Scan(name, func(key string, data []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read collection: %w", err)
+	}
+
+	for _, key := range keys {
+		if err := c.storage.Delete(name, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("failed to delete record %s: %w", key, err)
+		}
+	}
+
+	if err := schema.dropIndexes(c.storage); err != nil {
+		return err
+	}
+
+	if err := c.storage.Delete(storage.SchemaCollection, name); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("failed to delete schema: %w", err)
+	}
+	delete(c.schemas, name)
+
+	return nil
+}
+
+// Recover marks the storage engine as open. If it was already marked, the
+// last process to use it did not Close the catalog, and records and index
+// entries it was writing may disagree: every index is then rebuilt, and
+// Recover reports true.
+func (c *Catalog) Recover() (bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var marker struct{}
+	err := c.storage.Get(stateCollection, openMarker, &marker)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return false, fmt.Errorf("failed to read database state: %w", err)
+	}
+	crashed := err == nil
+
+	if crashed {
+		for _, schema := range c.schemas {
+			if err := schema.RebuildIndexes(c.storage); err != nil {
+				return true, fmt.Errorf("failed to rebuild the indexes of '%s': %w", schema.Name, err)
+			}
+		}
+	}
+
+	if err := c.storage.Put(stateCollection, openMarker, marker); err != nil {
+		return crashed, fmt.Errorf("failed to save database state: %w", err)
+	}
+	if err := c.storage.Sync(); err != nil {
+		return crashed, err
+	}
+	return crashed, nil
+}
+
+// Close makes every write durable and then clears the mark Recover set, so
+// that the next Recover trusts the indexes
+func (c *Catalog) Close() error {
+	if err := c.storage.Sync(); err != nil {
+		return err
+	}
+
+	err := c.storage.Delete(stateCollection, openMarker)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("failed to save database state: %w", err)
+	}
+	return nil
+}
+
+// sameDefinition reports whether two schemas describe the same collection
+func (s *Schema) sameDefinition(other *Schema) bool {
+	return s.Name == other.Name && reflect.DeepEqual(s.Fields, other.Fields)
+}
@@ -0,0 +1,289 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/adityaparmar9813/NAP/internal/index"
+	"github.com/adityaparmar9813/NAP/internal/storage"
+	"github.com/adityaparmar9813/NAP/internal/validator"
+)
+
+// Count returns the number of records matching criteria. When an index
+// answers criteria exactly, only the index is read.
+func (s *Schema) Count(criteria map[string]interface{}, store storage.StorageInterface) (int, error) {
+	plan, err := s.planQuery(criteria, nil, store)
+	if err != nil {
+		return 0, err
+	}
+	if plan != nil && plan.covered {
+		ids, err := plan.recordIDs()
+		return len(ids), err
+	}
+
+	count := 0
+	err = s.scanMatches(criteria, plan, nil, store, func(map[string]interface{}) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Exists reports whether any record matches criteria. It stops reading at
+// the first match.
+func (s *Schema) Exists(criteria map[string]interface{}, store storage.StorageInterface) (bool, error) {
+	plan, err := s.planQuery(criteria, nil, store)
+	if err != nil {
+		return false, err
+	}
+	if plan != nil && plan.covered {
+		return plan.any()
+	}
+
+	found := false
+	err = s.scanMatches(criteria, plan, nil, store, func(map[string]interface{}) error {
+		found = true
+		return storage.ErrStopScan
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return found, nil
+}
+
+// Distinct returns the distinct values of field, which may be a dotted path,
+// among the records matching criteria. The elements of an array count as
+// values of their own, records without the field are skipped, and the
+// values are returned in sort order. An index on field answers Distinct
+// when criteria is empty or only constrains field.
+func (s *Schema) Distinct(field string, criteria map[string]interface{}, store storage.StorageInterface) ([]interface{}, error) {
+	if field == "" {
+		return nil, fmt.Errorf("field must not be empty")
+	}
+
+	plan, err := s.planQuery(criteria, nil, store)
+	if err != nil {
+		return nil, err
+	}
+	if values, answered, err := s.distinctFromIndex(field, criteria, plan, store); answered || err != nil {
+		return values, err
+	}
+
+	seen := make(map[string]bool)
+	values := []interface{}{}
+	add := func(value interface{}) error {
+		key, err := groupKey(value)
+		if err != nil {
+			return err
+		}
+		if !seen[key] {
+			seen[key] = true
+			values = append(values, value)
+		}
+		return nil
+	}
+
+	segments := strings.Split(field, ".")
+	err = s.scanMatches(criteria, plan, segments[:1], store, func(record map[string]interface{}) error {
+		values, _ := validator.ResolvePath(record, field)
+		for _, value := range values {
+			array, isArray := value.([]interface{})
+			if !isArray {
+				array = []interface{}{value}
+			}
+			for _, element := range array {
+				if err := add(element); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(values, func(i, j int) bool {
+		return validator.CompareOrder(values[i], values[j]) < 0
+	})
+	return values, nil
+}
+
+// distinctFromIndex answers Distinct from an index whose first field is
+// field, if there is one that selects exactly the records criteria matches.
+// Only records indexed as null are read, to tell a null from a missing field.
+func (s *Schema) distinctFromIndex(field string, criteria map[string]interface{}, plan *queryPlan, store storage.StorageInterface) ([]interface{}, bool, error) {
+	if len(criteria) == 0 {
+		plan = nil
+		for _, definition := range s.definedIndexes() {
+			if definition.Fields[0] != field || definition.partial() || definition.ExpireAfter > 0 {
+				continue
+			}
+			opened, err := s.openIndex(definition, store)
+			if err != nil {
+				return nil, false, err
+			}
+			tree, isTree := opened.(*index.BTree)
+			if isTree && !tree.Multikey() {
+				plan = &queryPlan{index: definition, tree: tree, ranges: []keyRange{{}}, covered: true}
+				break
+			}
+		}
+	}
+	if plan == nil || !plan.covered || plan.tree == nil || plan.index.Fields[0] != field || plan.tree.Multikey() {
+		return nil, false, nil
+	}
+
+	values := []interface{}{}
+	seen := make(map[string]bool)
+	var nullIDs []string
+	for _, r := range plan.ranges {
+		err := r.scan(plan.tree, nil, "", func(key []interface{}, id string) error {
+			value := key[0]
+			if value == nil {
+				nullIDs = append(nullIDs, id)
+				return nil
+			}
+			distinct, err := groupKey(value)
+			if err != nil {
+				return err
+			}
+			if !seen[distinct] {
+				seen[distinct] = true
+				values = append(values, value)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read index '%s': %w", plan.index.Name, err)
+		}
+	}
+
+	for _, id := range nullIDs {
+		record, err := s.loadRecord(id, store)
+		if errors.Is(err, ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if values, _ := validator.ResolvePath(record.doc, field); len(values) > 0 {
+			values = append([]interface{}{nil}, values...)
+			break
+		}
+	}
+
+	sort.SliceStable(values, func(i, j int) bool {
+		return validator.CompareOrder(values[i], values[j]) < 0
+	})
+	return values, true, nil
+}
+
+// scanMatches calls fn with each record matching criteria, reading the
+// records plan selects or the whole collection. Only the fields that
+// criteria and extra refer to are decoded, and records are not decoded at
+// all when there is nothing to match.
+func (s *Schema) scanMatches(criteria map[string]interface{}, plan *queryPlan, extra []string, store storage.StorageInterface, fn func(record map[string]interface{}) error) error {
+	query, err := validator.Compile(criteria)
+	if err != nil {
+		return fmt.Errorf("invalid criteria: %w", err)
+	}
+
+	fields, partial := criteriaFields(criteria)
+	for _, field := range extra {
+		fields[field] = true
+	}
+
+	err = scanRecords(s.Name, plan, nil, store, func(key string, data []byte) error {
+		if partial && len(fields) == 0 {
+			return fn(nil)
+		}
+
+		record, err := decodeFields(data, fields, partial)
+		if err != nil {
+			return fmt.Errorf("failed to load record %s: %w", key, err)
+		}
+		if !query.Matches(record) {
+			return nil
+		}
+		return fn(record)
+	})
+	if err != nil && !errors.Is(err, storage.ErrStopScan) {
+		return fmt.Errorf("failed to read collection: %w", err)
+	}
+
+	return nil
+}
+
+// criteriaFields returns the top-level fields criteria refers to. partial is
+// false when criteria uses an operator whose fields cannot be told apart, and
+// whole records must be decoded.
+func criteriaFields(criteria map[string]interface{}) (fields map[string]bool, partial bool) {
+	fields = make(map[string]bool)
+	for key, condition := range criteria {
+		switch key {
+		case "$and", "$or", "$nor":
+			clauses, ok := condition.([]interface{})
+			if !ok {
+				return fields, false
+			}
+			for _, clause := range clauses {
+				nested, ok := clause.(map[string]interface{})
+				if !ok {
+					return fields, false
+				}
+				nestedFields, nestedPartial := criteriaFields(nested)
+				if !nestedPartial {
+					return fields, false
+				}
+				for field := range nestedFields {
+					fields[field] = true
+				}
+			}
+		case "$text":
+			// Answered by the text index
+		default:
+			if strings.HasPrefix(key, "$") {
+				return fields, false
+			}
+			fields[strings.SplitN(key, ".", 2)[0]] = true
+		}
+	}
+	return fields, true
+}
+
+// decodeFields decodes only the listed top-level fields of a record, or the
+// whole record when partial is false
+func decodeFields(data []byte, fields map[string]bool, partial bool) (map[string]interface{}, error) {
+	record := make(map[string]interface{})
+	if !partial {
+		err := storage.JSONToStruct(data, &record)
+		return record, err
+	}
+
+	var raw map[string]json.RawMessage
+	if err := storage.JSONToStruct(data, &raw); err != nil {
+		return nil, err
+	}
+	for field := range fields {
+		encoded, exists := raw[field]
+		if !exists {
+			continue
+		}
+		var value interface{}
+		if err := storage.JSONToStruct(encoded, &value); err != nil {
+			return nil, err
+		}
+		record[field] = value
+	}
+
+	return record, nil
+}
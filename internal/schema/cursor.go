@@ -0,0 +1,344 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/adityaparmar9813/NAP/internal/storage"
+	"github.com/adityaparmar9813/NAP/internal/validator"
+)
+
+// DefaultBatchSize is the number of records a cursor reads ahead when
+// FindOptions does not set BatchSize
+const DefaultBatchSize = 100
+
+// ErrCursorClosed is returned by Decode once the cursor has been closed
+var ErrCursorClosed = errors.New("cursor is closed")
+
+// Cursor streams the results of Find. Records are read from storage in
+// batches as Next asks for them, so only about two batches are held in
+// memory at once. Always Close a cursor that has not been exhausted.
+type Cursor struct {
+	batches chan []map[string]interface{}
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+
+	// scanErr is set by the producer before batches is closed
+	scanErr error
+
+	batch   []map[string]interface{}
+	current map[string]interface{}
+	err     error
+	closed  bool
+}
+
+// Find returns a cursor over the records matching criteria. Unsorted results
+// stream in UUID order, or in the order of the index the query reads;
+// sorting has to read every match before the first one can be returned. An
+// index in sort order avoids that. ctx bounds the lifetime of the whole
+// cursor.
+func (s *Schema) Find(ctx context.Context, criteria map[string]interface{}, store storage.StorageInterface, options ...*FindOptions) (*Cursor, error) {
+	return s.find(ctx, criteria, store, mergeFindOptions(options), false)
+}
+
+// find is Find for GetPage when paging is set: the TextScore of $text
+// results is kept on the records, and unsorted results come in UUID order
+// so that a page token can mark a position in them
+func (s *Schema) find(ctx context.Context, criteria map[string]interface{}, store storage.StorageInterface, findOptions FindOptions, paging bool) (*Cursor, error) {
+	if findOptions.Skip < 0 || findOptions.Limit < 0 || findOptions.BatchSize < 0 {
+		return nil, fmt.Errorf("skip, limit and batch size must not be negative")
+	}
+	for _, field := range findOptions.Sort {
+		if field.Field == "" {
+			return nil, fmt.Errorf("sort field must not be empty")
+		}
+		if field.Order != 0 && field.Order != Ascending && field.Order != Descending {
+			return nil, fmt.Errorf("invalid sort order %d for '%s'", field.Order, field.Field)
+		}
+		if _, isText := criteria["$text"]; field.Field == TextScore && !isText {
+			return nil, fmt.Errorf("sorting on %s needs a $text search", TextScore)
+		}
+	}
+	for i, populate := range findOptions.Populate {
+		checked, err := checkPopulate(populate)
+		if err != nil {
+			return nil, err
+		}
+		findOptions.Populate[i] = checked
+	}
+	projection, err := compileProjection(findOptions.Projection)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := validator.Compile(criteria)
+	if err != nil {
+		return nil, fmt.Errorf("invalid criteria: %w", err)
+	}
+
+	plan, err := s.planQuery(criteria, findOptions.Sort, store)
+	if err != nil {
+		return nil, err
+	}
+	if plan != nil && (paging || findOptions.After != "") {
+		plan.keyOrder = true
+	}
+
+	var after *pageToken
+	if findOptions.After != "" {
+		fingerprint, err := queryFingerprint(criteria, findOptions.Sort)
+		if err != nil {
+			return nil, err
+		}
+		if after, err = decodePageToken(findOptions.After, fingerprint, findOptions.Sort); err != nil {
+			return nil, err
+		}
+	}
+
+	batchSize := findOptions.BatchSize
+	if batchSize == 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	cursor := &Cursor{
+		batches: make(chan []map[string]interface{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	producer := &cursorProducer{
+		ctx:        ctx,
+		cursor:     cursor,
+		catalog:    s.state().catalog,
+		store:      store,
+		options:    findOptions,
+		projection: projection,
+		after:      after,
+		plan:       plan,
+		batchSize:  batchSize,
+		keepScore:  paging,
+	}
+	go producer.run(s.Name, query, store)
+
+	return cursor, nil
+}
+
+// cursorProducer scans storage on behalf of a cursor
+type cursorProducer struct {
+	ctx        context.Context
+	cursor     *Cursor
+	catalog    *Catalog
+	store      storage.StorageInterface
+	options    FindOptions
+	projection *projection
+	after      *pageToken
+	plan       *queryPlan
+	batchSize  int
+	keepScore  bool
+
+	skipped int
+	sent    int
+	batch   []map[string]interface{}
+}
+
+func (p *cursorProducer) run(collection string, query *validator.Query, store storage.StorageInterface) {
+	defer close(p.cursor.stopped)
+	defer close(p.cursor.batches)
+
+	err := p.scan(collection, query, store)
+	if err == nil {
+		err = p.flush()
+	}
+	if errors.Is(err, errCursorStopped) {
+		err = nil
+	}
+	p.cursor.scanErr = err
+}
+
+// errCursorStopped ends a scan early once the cursor needs no more records
+var errCursorStopped = errors.New("cursor stopped")
+
+func (p *cursorProducer) scan(collection string, query *validator.Query, store storage.StorageInterface) error {
+	// An index read in sort order already returns the records sorted
+	sorted := len(p.options.Sort) > 0 && (p.plan == nil || !p.plan.ordered)
+	var matches []storedRecord
+
+	err := scanRecords(collection, p.plan, p.after, store, func(key string, data []byte) error {
+		if err := p.ctx.Err(); err != nil {
+			return err
+		}
+
+		var record map[string]interface{}
+		if err := storage.JSONToStruct(data, &record); err != nil {
+			return fmt.Errorf("failed to load record %s: %w", key, err)
+		}
+		if !query.Matches(record) {
+			return nil
+		}
+		if p.plan != nil && p.plan.scores != nil {
+			record[TextScore] = p.plan.scores[key]
+		}
+		// The scan seeks to the token's position when the records come in
+		// its order, but has to skip it and any records sorted in memory
+		if p.after != nil && !p.after.precedes(storedRecord{key: key, doc: record}, p.options.Sort) {
+			return nil
+		}
+
+		if sorted {
+			matches = append(matches, storedRecord{key: key, doc: record})
+			return nil
+		}
+		return p.emit(record)
+	})
+	if errors.Is(err, errCursorStopped) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read collection: %w", err)
+	}
+
+	if sorted {
+		sortRecords(matches, p.options.Sort)
+		for i := range matches {
+			if err := p.emit(matches[i].doc); err != nil {
+				return err
+			}
+			matches[i].doc = nil
+		}
+	}
+
+	return nil
+}
+
+// emit applies skip and limit to a matching record and queues it
+func (p *cursorProducer) emit(record map[string]interface{}) error {
+	if p.skipped < p.options.Skip {
+		p.skipped++
+		return nil
+	}
+
+	p.batch = append(p.batch, record)
+	p.sent++
+
+	if len(p.batch) == p.batchSize {
+		if err := p.flush(); err != nil {
+			return err
+		}
+	}
+
+	if p.options.Limit > 0 && p.sent == p.options.Limit {
+		if err := p.flush(); err != nil {
+			return err
+		}
+		return errCursorStopped
+	}
+
+	return nil
+}
+
+// flush populates and projects the queued records and hands them to the
+// cursor. Populating a whole batch at once reads each joined collection once
+// per batch rather than once per record.
+func (p *cursorProducer) flush() error {
+	batch := p.batch
+	p.batch = nil
+	if len(batch) == 0 {
+		return nil
+	}
+
+	for _, populate := range p.options.Populate {
+		if err := populateRecords(p.ctx, batch, populate, p.catalog, p.store); err != nil {
+			return err
+		}
+	}
+	for i, record := range batch {
+		batch[i] = p.projection.apply(record)
+		if !p.keepScore {
+			delete(batch[i], TextScore)
+		}
+	}
+
+	return p.send(batch)
+}
+
+func (p *cursorProducer) send(batch []map[string]interface{}) error {
+	select {
+	case p.cursor.batches <- batch:
+		return nil
+	case <-p.cursor.done:
+		return errCursorStopped
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	}
+}
+
+// Next advances to the next record, reading another batch from storage when
+// needed. It returns false when the results are exhausted, ctx is done or an
+// error occurred; check Err to tell these apart.
+func (c *Cursor) Next(ctx context.Context) bool {
+	c.current = nil
+	if c.closed || c.err != nil {
+		return false
+	}
+
+	for len(c.batch) == 0 {
+		select {
+		case batch, ok := <-c.batches:
+			if !ok {
+				c.err = c.scanErr
+				return false
+			}
+			c.batch = batch
+		case <-ctx.Done():
+			c.err = ctx.Err()
+			return false
+		}
+	}
+
+	c.current = c.batch[0]
+	c.batch[0] = nil
+	c.batch = c.batch[1:]
+
+	return true
+}
+
+// Decode stores the current record in the value pointed to by v, which may
+// be a map or a struct with JSON tags
+func (c *Cursor) Decode(v interface{}) error {
+	if c.closed {
+		return ErrCursorClosed
+	}
+	if c.current == nil {
+		return fmt.Errorf("no current record: call Next first")
+	}
+
+	data, err := storage.StructToJSON(c.current)
+	if err != nil {
+		return fmt.Errorf("failed to convert record to JSON: %w", err)
+	}
+
+	return storage.JSONToStruct(data, v)
+}
+
+// Err returns the error that stopped the cursor, if any
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+// Close stops reading from storage and releases the cursor's resources. It
+// is safe to call more than once.
+func (c *Cursor) Close() error {
+	c.once.Do(func() {
+		close(c.done)
+	})
+	<-c.stopped
+
+	c.closed = true
+	c.batch = nil
+	c.current = nil
+
+	return nil
+}
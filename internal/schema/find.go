@@ -0,0 +1,371 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/adityaparmar9813/NAP/internal/storage"
+	"github.com/adityaparmar9813/NAP/internal/validator"
+)
+
+// SortOrder is the direction of a sort key
+type SortOrder int
+
+const (
+	Ascending  SortOrder = 1
+	Descending SortOrder = -1
+)
+
+// SortField sorts results by a field, which may be a dotted path. The zero
+// Order sorts ascending.
+type SortField struct {
+	Field string
+	Order SortOrder
+}
+
+// FindOptions shape the results of Find and GetRecord
+type FindOptions struct {
+	// Projection either includes fields, {"name": 1, "address.city": 1}, or
+	// excludes them, {"password": 0}. The uuid is included unless it is
+	// excluded explicitly. {"score": {"$meta": "textScore"}} adds the
+	// TextScore of a $text search as a top-level field.
+	Projection map[string]interface{}
+	// Sort orders results by each field in turn. Records that compare equal
+	// keep their UUID order.
+	Sort  []SortField
+	Skip  int
+	Limit int
+	// BatchSize is the number of records a cursor reads ahead. It defaults
+	// to DefaultBatchSize.
+	BatchSize int
+	// After is a token from GetPage. Only records that come after the one
+	// the token was taken from, in the same sort order, are returned.
+	After string
+	// Populate replaces references to other collections with the documents
+	// they refer to, before the projection is applied
+	Populate []Populate
+}
+
+// mergeFindOptions combines options, with later ones overriding the fields
+// they set
+func mergeFindOptions(options []*FindOptions) FindOptions {
+	var merged FindOptions
+	for _, option := range options {
+		if option == nil {
+			continue
+		}
+		if option.Projection != nil {
+			merged.Projection = option.Projection
+		}
+		if option.Sort != nil {
+			merged.Sort = option.Sort
+		}
+		if option.Skip != 0 {
+			merged.Skip = option.Skip
+		}
+		if option.Limit != 0 {
+			merged.Limit = option.Limit
+		}
+		if option.BatchSize != 0 {
+			merged.BatchSize = option.BatchSize
+		}
+		if option.After != "" {
+			merged.After = option.After
+		}
+		if option.Populate != nil {
+			merged.Populate = option.Populate
+		}
+	}
+	return merged
+}
+
+// GetRecord returns the records matching criteria, in the order Find
+// returns them. Use Find to stream large results instead.
+func (s *Schema) GetRecord(criteria map[string]interface{}, store storage.StorageInterface, options ...*FindOptions) ([]map[string]interface{}, error) {
+	ctx := context.Background()
+
+	cursor, err := s.Find(ctx, criteria, store, options...)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	var matchingRecords []map[string]interface{}
+	for cursor.Next(ctx) {
+		matchingRecords = append(matchingRecords, cursor.current)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return matchingRecords, nil
+}
+
+// sortRecords orders records by fields, falling back to key order
+func sortRecords(records []storedRecord, fields []SortField) {
+	keys := make(map[string][]interface{}, len(records))
+	for _, record := range records {
+		keys[record.key] = sortKeys(record.doc, fields)
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		return comparePositions(keys[a.key], a.key, keys[b.key], b.key, fields) < 0
+	})
+}
+
+// sortKeys returns the values a record sorts by, one per field
+func sortKeys(doc map[string]interface{}, fields []SortField) []interface{} {
+	keys := make([]interface{}, len(fields))
+	for i, field := range fields {
+		keys[i] = sortValue(doc, field.Field, field.Order == Descending)
+	}
+	return keys
+}
+
+// comparePositions orders two records in the result order given by fields,
+// from their sort keys and storage keys
+func comparePositions(keys1 []interface{}, key1 string, keys2 []interface{}, key2 string, fields []SortField) int {
+	for i, field := range fields {
+		order := validator.CompareOrder(keys1[i], keys2[i])
+		if field.Order == Descending {
+			order = -order
+		}
+		if order != 0 {
+			return order
+		}
+	}
+	return strings.Compare(key1, key2)
+}
+
+// sortValue is the value a record sorts by. As in MongoDB, an array sorts by
+// its smallest element ascending and its largest descending.
+func sortValue(doc map[string]interface{}, path string, descending bool) interface{} {
+	value, exists := fieldValue(doc, path)
+	if !exists {
+		return nil
+	}
+
+	array, isArray := value.([]interface{})
+	if !isArray || len(array) == 0 {
+		return value
+	}
+
+	selected := array[0]
+	for _, element := range array[1:] {
+		order := validator.CompareOrder(element, selected)
+		if (descending && order > 0) || (!descending && order < 0) {
+			selected = element
+		}
+	}
+	return selected
+}
+
+// projectionNode is one level of a projection. A nil child marks a field
+// that is projected whole.
+type projectionNode map[string]projectionNode
+
+type projection struct {
+	fields  projectionNode
+	include bool
+	// scoreFields are set to the TextScore of each record
+	scoreFields []string
+	// excludeUUID drops the uuid, which is kept out of fields so that it can
+	// be excluded from an inclusion projection
+	excludeUUID bool
+}
+
+func compileProjection(spec map[string]interface{}) (*projection, error) {
+	if len(spec) == 0 {
+		return nil, nil
+	}
+
+	p := &projection{fields: projectionNode{}}
+	mode := 0
+
+	// Score fields are added to either kind of projection, so they take
+	// no part in choosing one
+	paths := make([]string, 0, len(spec))
+	for path, value := range spec {
+		if !isScoreProjection(value) {
+			paths = append(paths, path)
+			continue
+		}
+		if path == "" || strings.ContainsAny(path, ".$") {
+			return nil, fmt.Errorf("invalid projection path '%s' for the text score", path)
+		}
+		p.scoreFields = append(p.scoreFields, path)
+	}
+	sort.Strings(paths)
+	sort.Strings(p.scoreFields)
+
+	for _, path := range paths {
+		include, err := projectionFlag(spec[path])
+		if err != nil {
+			return nil, fmt.Errorf("projection of '%s': %w", path, err)
+		}
+
+		if path == "uuid" && !include {
+			p.excludeUUID = true
+		}
+		if path == "uuid" && len(paths) > 1 {
+			continue
+		}
+
+		flag := -1
+		if include {
+			flag = 1
+		}
+		if mode != 0 && mode != flag {
+			return nil, fmt.Errorf("projection cannot mix inclusion and exclusion")
+		}
+		mode = flag
+
+		if err := p.fields.add(strings.Split(path, "."), path); err != nil {
+			return nil, err
+		}
+	}
+
+	p.include = mode == 1
+	return p, nil
+}
+
+// isScoreProjection reports whether a projection value is {"$meta": "textScore"}
+func isScoreProjection(value interface{}) bool {
+	meta, isDocument := value.(map[string]interface{})
+	return isDocument && len(meta) == 1 && meta["$meta"] == "textScore"
+}
+
+func projectionFlag(value interface{}) (bool, error) {
+	switch flag := value.(type) {
+	case bool:
+		return flag, nil
+	case int:
+		if flag == 0 || flag == 1 {
+			return flag == 1, nil
+		}
+	case float64:
+		if flag == 0 || flag == 1 {
+			return flag == 1, nil
+		}
+	}
+	return false, fmt.Errorf("expected 0, 1 or a boolean, got %v", value)
+}
+
+func (n projectionNode) add(segments []string, path string) error {
+	for _, segment := range segments {
+		if segment == "" {
+			return fmt.Errorf("invalid projection path '%s'", path)
+		}
+	}
+
+	node := n
+	for i, segment := range segments {
+		child, exists := node[segment]
+		last := i == len(segments)-1
+
+		if exists && (child == nil || last) {
+			return fmt.Errorf("projection path '%s' collides with another path", path)
+		}
+		if last {
+			node[segment] = nil
+			return nil
+		}
+		if !exists {
+			child = projectionNode{}
+			node[segment] = child
+		}
+		node = child
+	}
+
+	return nil
+}
+
+// apply returns the projected copy of doc. A nil projection returns doc.
+func (p *projection) apply(doc map[string]interface{}) map[string]interface{} {
+	if p == nil {
+		return doc
+	}
+
+	var projected map[string]interface{}
+	if p.include {
+		projected = includeFields(doc, p.fields)
+		if id, exists := doc["uuid"]; exists && !p.excludeUUID {
+			projected["uuid"] = id
+		}
+	} else {
+		projected = excludeFields(doc, p.fields)
+		if p.excludeUUID {
+			delete(projected, "uuid")
+		}
+	}
+
+	if score, exists := doc[TextScore]; exists {
+		for _, field := range p.scoreFields {
+			projected[field] = score
+		}
+	}
+	return projected
+}
+
+func includeFields(doc map[string]interface{}, fields projectionNode) map[string]interface{} {
+	projected := make(map[string]interface{}, len(fields))
+	for name, child := range fields {
+		value, exists := doc[name]
+		if !exists {
+			continue
+		}
+		if child == nil {
+			projected[name] = value
+			continue
+		}
+
+		switch nested := value.(type) {
+		case map[string]interface{}:
+			projected[name] = includeFields(nested, child)
+		case []interface{}:
+			// Project each document in the array; other elements are dropped
+			elements := make([]interface{}, 0, len(nested))
+			for _, element := range nested {
+				if document, isDocument := element.(map[string]interface{}); isDocument {
+					elements = append(elements, includeFields(document, child))
+				}
+			}
+			projected[name] = elements
+		}
+	}
+	return projected
+}
+
+func excludeFields(doc map[string]interface{}, fields projectionNode) map[string]interface{} {
+	projected := make(map[string]interface{}, len(doc))
+	for name, value := range doc {
+		child, listed := fields[name]
+		if !listed {
+			projected[name] = value
+			continue
+		}
+		if child == nil {
+			continue
+		}
+
+		switch nested := value.(type) {
+		case map[string]interface{}:
+			projected[name] = excludeFields(nested, child)
+		case []interface{}:
+			elements := make([]interface{}, 0, len(nested))
+			for _, element := range nested {
+				if document, isDocument := element.(map[string]interface{}); isDocument {
+					element = excludeFields(document, child)
+				}
+				elements = append(elements, element)
+			}
+			projected[name] = elements
+		default:
+			projected[name] = value
+		}
+	}
+	return projected
+}
@@ -0,0 +1,655 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/adityaparmar9813/NAP/internal/index"
+	"github.com/adityaparmar9813/NAP/internal/storage"
+	"github.com/adityaparmar9813/NAP/internal/validator"
+)
+
+var (
+	// ErrIndexExists is returned when an index name is already used by a
+	// different definition
+	ErrIndexExists = errors.New("index already exists with a different definition")
+	// ErrIndexNotFound is returned for indexes the collection does not have
+	ErrIndexNotFound = errors.New("index not found")
+)
+
+// UniqueIndexPrefix starts the name of the index enforcing a unique field
+const UniqueIndexPrefix = "unique_"
+
+// IndexType selects the structure an index is kept in
+type IndexType string
+
+const (
+	// BTreeIndex keeps keys in order, for equality, ranges and sorts. It is
+	// the default.
+	BTreeIndex IndexType = "btree"
+	// HashIndex finds records with equal keys in constant time, and only
+	// answers equality and $in on every field
+	HashIndex IndexType = "hash"
+	// TextIndex indexes the words of string fields for $text searches. A
+	// collection has at most one.
+	TextIndex IndexType = "text"
+)
+
+// ErrNoTextIndex is returned for $text searches on a collection without a
+// text index
+var ErrNoTextIndex = errors.New("$text needs a text index")
+
+// Index describes a secondary index on one or more fields, which may be
+// dotted paths. Queries with equality conditions on the leading fields and
+// an optional range on the next one read the index instead of the whole
+// collection, and sorts in the order of the index need no sorting in
+// memory. A record whose field holds an array is indexed under each of its
+// elements.
+type Index struct {
+	Name   string
+	Fields []string
+	// Type is the structure of the index, a B+tree by default
+	Type IndexType `json:",omitempty"`
+	// Orders gives the direction of each field, ascending by default
+	Orders []SortOrder `json:",omitempty"`
+	// Unique rejects two records with the same values for all the fields
+	Unique bool
+	// Filter limits the index to the records matching it, making it a
+	// partial index. Queries only use it when they imply the filter.
+	Filter map[string]interface{} `json:",omitempty"`
+	// Sparse leaves out records missing every indexed field. Queries only
+	// use it when they require one of the fields to have a value.
+	Sparse bool `json:",omitempty"`
+	// ExpireAfter makes a TTL index on a single date field: records are
+	// deleted by ExpireRecords once their date is this long past. TTL
+	// indexes are not used to answer queries.
+	ExpireAfter time.Duration `json:",omitempty"`
+	// Tokenizer names the registered index.Tokenizer a text index splits
+	// text with, index.DefaultTokenizer by default
+	Tokenizer string `json:",omitempty"`
+	// Language selects the stop words and stemming of a text index:
+	// index.LanguageEnglish by default, or index.LanguageNone
+	Language string `json:",omitempty"`
+}
+
+// partial reports whether the index may leave records out
+func (d Index) partial() bool {
+	return d.Filter != nil || d.Sparse
+}
+
+// descending flags the fields the index orders from largest to smallest
+func (d Index) descending() []bool {
+	flags := make([]bool, len(d.Fields))
+	for i, order := range d.Orders {
+		flags[i] = order == Descending
+	}
+	return flags
+}
+
+// DuplicateKeyError is returned when a write would give two records the
+// same key in a unique index
+type DuplicateKeyError struct {
+	Index  string
+	Fields []string
+	Values []interface{}
+}
+
+func (e *DuplicateKeyError) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		value, err := json.Marshal(e.Values[i])
+		if err != nil {
+			value = []byte(fmt.Sprint(e.Values[i]))
+		}
+		parts[i] = fmt.Sprintf("%s: %s", field, value)
+	}
+	return fmt.Sprintf("duplicate key in unique index '%s': {%s}", e.Index, strings.Join(parts, ", "))
+}
+
+// CreateIndex builds an index over the existing records and saves its
+// definition with the schema. Creating an index that already exists with
+// the same definition does nothing.
+func (s *Schema) CreateIndex(definition Index, store storage.StorageInterface) error {
+	if err := checkIndex(definition); err != nil {
+		return err
+	}
+	if definition.Filter != nil {
+		// Store the filter as it will be loaded, so that creating the index
+		// again is recognized as the same definition
+		filter, err := normalizeDocument(definition.Filter)
+		if err != nil {
+			return fmt.Errorf("index '%s': %w", definition.Name, err)
+		}
+		definition.Filter = filter
+	}
+	if err := storage.ValidateName(index.Collection(s.Name, definition.Name)); err != nil {
+		return fmt.Errorf("invalid index name: %w", err)
+	}
+
+	s.state().mu.Lock()
+	defer s.state().mu.Unlock()
+
+	for _, existing := range s.definedIndexes() {
+		if existing.Name != definition.Name {
+			if existing.Type == TextIndex && definition.Type == TextIndex {
+				return fmt.Errorf("%w: collection already has text index '%s'", ErrIndexExists, existing.Name)
+			}
+			continue
+		}
+		if reflect.DeepEqual(existing, definition) {
+			return nil
+		}
+		return fmt.Errorf("%w: %s", ErrIndexExists, definition.Name)
+	}
+
+	if err := s.buildIndex(definition, store); err != nil {
+		return err
+	}
+
+	state := s.state()
+	state.indexMu.Lock()
+	defer state.indexMu.Unlock()
+	state.definitions = append(state.definitions[:len(state.definitions):len(state.definitions)], definition)
+
+	return s.saveIndexes(state.definitions, store)
+}
+
+// buildIndex fills an index from the records of the collection. It starts
+// from an empty structure, so it also repairs an index left half-written.
+func (s *Schema) buildIndex(definition Index, store storage.StorageInterface) error {
+	state := s.state()
+	state.indexMu.Lock()
+	delete(state.indexes, definition.Name)
+	state.indexMu.Unlock()
+
+	collection := index.Collection(s.Name, definition.Name)
+	if err := index.DropCollection(store, collection); err != nil {
+		return err
+	}
+
+	tree, err := openStructure(definition, collection, store)
+	if err != nil {
+		return err
+	}
+
+	err = store.Scan(s.Name, func(key string, data []byte) error {
+		var record map[string]interface{}
+		if err := storage.JSONToStruct(data, &record); err != nil {
+			return fmt.Errorf("failed to load record %s: %w", key, err)
+		}
+		return insertIndexKeys(tree, definition, record, key)
+	})
+	if err != nil {
+		if dropErr := tree.Drop(); dropErr != nil {
+			return fmt.Errorf("failed to build index '%s': %v (and failed to clean up: %v)", definition.Name, err, dropErr)
+		}
+		return fmt.Errorf("failed to build index '%s': %w", definition.Name, err)
+	}
+
+	state.indexMu.Lock()
+	state.indexes[definition.Name] = tree
+	state.indexMu.Unlock()
+
+	return nil
+}
+
+// RebuildIndexes builds every index of the collection again from its
+// records. Records and index entries are written one after the other, so
+// after a crash an index may miss records or point to deleted ones;
+// rebuilding brings it back in line with the records.
+func (s *Schema) RebuildIndexes(store storage.StorageInterface) error {
+	s.state().mu.Lock()
+	defer s.state().mu.Unlock()
+
+	for _, definition := range s.definedIndexes() {
+		if err := s.buildIndex(definition, store); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DropIndex deletes an index and removes it from the schema
+func (s *Schema) DropIndex(name string, store storage.StorageInterface) error {
+	s.state().mu.Lock()
+	defer s.state().mu.Unlock()
+
+	state := s.state()
+	state.indexMu.Lock()
+	position := -1
+	for i, definition := range state.definitions {
+		if definition.Name == name {
+			position = i
+		}
+	}
+	if position < 0 {
+		state.indexMu.Unlock()
+		return fmt.Errorf("%w: %s", ErrIndexNotFound, name)
+	}
+	state.definitions = append(state.definitions[:position:position], state.definitions[position+1:]...)
+	delete(state.indexes, name)
+	err := s.saveIndexes(state.definitions, store)
+	state.indexMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return index.DropCollection(store, index.Collection(s.Name, name))
+}
+
+// dropIndexes deletes the data of every index of the collection
+func (s *Schema) dropIndexes(store storage.StorageInterface) error {
+	for _, definition := range s.definedIndexes() {
+		if err := index.DropCollection(store, index.Collection(s.Name, definition.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkIndex(definition Index) error {
+	if definition.Name == "" {
+		return fmt.Errorf("index name must not be empty")
+	}
+	if len(definition.Fields) == 0 {
+		return fmt.Errorf("index '%s' must have at least one field", definition.Name)
+	}
+
+	seen := make(map[string]bool)
+	for _, field := range definition.Fields {
+		for _, segment := range strings.Split(field, ".") {
+			if segment == "" || strings.HasPrefix(segment, "$") {
+				return fmt.Errorf("index '%s': invalid field '%s'", definition.Name, field)
+			}
+		}
+		if seen[field] {
+			return fmt.Errorf("index '%s': field '%s' is listed twice", definition.Name, field)
+		}
+		seen[field] = true
+	}
+
+	switch definition.Type {
+	case "", BTreeIndex:
+	case HashIndex:
+		if len(definition.Orders) > 0 {
+			return fmt.Errorf("hash index '%s' cannot have orders", definition.Name)
+		}
+	case TextIndex:
+		if definition.Unique || len(definition.Orders) > 0 || definition.ExpireAfter != 0 {
+			return fmt.Errorf("text index '%s' cannot be unique, ordered or expire records", definition.Name)
+		}
+		if _, err := index.NewAnalyzer(definition.Tokenizer, definition.Language); err != nil {
+			return fmt.Errorf("text index '%s': %w", definition.Name, err)
+		}
+	default:
+		return fmt.Errorf("index '%s' has unknown type '%s'", definition.Name, definition.Type)
+	}
+	if definition.ExpireAfter < 0 {
+		return fmt.Errorf("index '%s': expireAfter must not be negative", definition.Name)
+	}
+	if definition.ExpireAfter > 0 && (len(definition.Fields) != 1 || definition.Type == HashIndex || definition.Unique || len(definition.Orders) > 0) {
+		return fmt.Errorf("TTL index '%s' must be a plain B+tree index on a single field", definition.Name)
+	}
+	if definition.Filter != nil {
+		if _, err := validator.Compile(definition.Filter); err != nil {
+			return fmt.Errorf("index '%s': invalid filter: %w", definition.Name, err)
+		}
+		if _, isText := definition.Filter["$text"]; isText {
+			return fmt.Errorf("index '%s': a filter cannot use $text", definition.Name)
+		}
+	}
+	if len(definition.Orders) > len(definition.Fields) {
+		return fmt.Errorf("index '%s' has more orders than fields", definition.Name)
+	}
+	for i, order := range definition.Orders {
+		if order != 0 && order != Ascending && order != Descending {
+			return fmt.Errorf("index '%s': invalid order %d for '%s'", definition.Name, order, definition.Fields[i])
+		}
+	}
+
+	return nil
+}
+
+// definedIndexes returns a copy of the index definitions
+func (s *Schema) definedIndexes() []Index {
+	state := s.state()
+	state.indexMu.RLock()
+	defer state.indexMu.RUnlock()
+
+	return append([]Index(nil), state.definitions...)
+}
+
+// saveIndexes makes definitions the indexes of the schema and saves it
+func (s *Schema) saveIndexes(definitions []Index, store storage.StorageInterface) error {
+	s.indexMu.Lock()
+	s.Indexes = append([]Index(nil), definitions...)
+	s.indexMu.Unlock()
+
+	if err := store.Put(storage.SchemaCollection, s.Name, s); err != nil {
+		return fmt.Errorf("failed to save schema: %w", err)
+	}
+	return nil
+}
+
+// openIndex returns the structure of an index. Open indexes are kept with
+// the state of the collection, so this only reads storage on first use and
+// every Schema of the collection shares the structure's lock and cache.
+func (s *Schema) openIndex(definition Index, store storage.StorageInterface) (index.IndexInterface, error) {
+	state := s.state()
+	state.indexMu.Lock()
+	defer state.indexMu.Unlock()
+
+	if tree, isOpen := state.indexes[definition.Name]; isOpen {
+		return tree, nil
+	}
+	tree, err := openStructure(definition, index.Collection(s.Name, definition.Name), store)
+	if err != nil {
+		return nil, err
+	}
+	state.indexes[definition.Name] = tree
+
+	return tree, nil
+}
+
+// openStructure opens the hash table or B+tree stored in collection
+func openStructure(definition Index, collection string, store storage.StorageInterface) (index.IndexInterface, error) {
+	switch definition.Type {
+	case HashIndex:
+		return index.OpenHashIndex(store, collection)
+	case TextIndex:
+		analyzer, err := index.NewAnalyzer(definition.Tokenizer, definition.Language)
+		if err != nil {
+			return nil, err
+		}
+		return index.OpenTextIndex(store, collection, analyzer)
+	}
+	return index.OpenBTree(store, collection, definition.descending())
+}
+
+// indexKeys returns the keys a record is indexed under and whether any field
+// held an array. Fields are read the way criteria read them, so a path may
+// index into an array or reach a field of every document in one. A missing
+// field is indexed as null, an empty array as itself, and every other array
+// under each of its elements. Keys of records with several array fields
+// combine every element of each. Records left out of a partial or sparse
+// index have no keys, TTL indexes hold dates and text indexes the strings to
+// search.
+func indexKeys(definition Index, record map[string]interface{}) ([][]interface{}, bool) {
+	if definition.Filter != nil && !validator.MatchesCriteria(record, definition.Filter) {
+		return nil, false
+	}
+	if definition.ExpireAfter > 0 {
+		return expiryKeys(definition, record)
+	}
+	if definition.Type == TextIndex {
+		return textKeys(definition, record), false
+	}
+
+	keys := [][]interface{}{make([]interface{}, len(definition.Fields))}
+	multikey := false
+	present := false
+
+	for i, field := range definition.Fields {
+		values, throughArray := validator.ResolvePath(record, field)
+		if len(values) == 0 {
+			continue
+		}
+		present = true
+
+		elements, fromArray := fieldElements(values)
+		if !throughArray && !fromArray {
+			for _, key := range keys {
+				key[i] = values[0]
+			}
+			continue
+		}
+		multikey = true
+
+		expanded := make([][]interface{}, 0, len(keys)*len(elements))
+		for _, key := range keys {
+			for _, element := range elements {
+				elementKey := append([]interface{}(nil), key...)
+				elementKey[i] = element
+				expanded = append(expanded, elementKey)
+			}
+		}
+		keys = expanded
+	}
+
+	if definition.Sparse && !present {
+		return nil, false
+	}
+	return keys, multikey
+}
+
+// fieldElements returns the values a field is indexed under, each value a
+// path reaches or the elements of those that are non-empty arrays, and
+// whether any were array elements
+func fieldElements(values []interface{}) ([]interface{}, bool) {
+	elements := make([]interface{}, 0, len(values))
+	fromArray := false
+	for _, value := range values {
+		if array, isArray := value.([]interface{}); isArray && len(array) > 0 {
+			elements = append(elements, array...)
+			fromArray = true
+			continue
+		}
+		elements = append(elements, value)
+	}
+	return elements, fromArray
+}
+
+func insertIndexKeys(tree index.IndexInterface, definition Index, record map[string]interface{}, recordID string) error {
+	keys, multikey := indexKeys(definition, record)
+	if multikey {
+		if err := tree.SetMultikey(); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range keys {
+		if !definition.Unique {
+			if err := tree.Insert(key, recordID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		err := tree.InsertUnique(key, recordID)
+		if errors.Is(err, index.ErrDuplicateKey) {
+			return &DuplicateKeyError{Index: definition.Name, Fields: definition.Fields, Values: key}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteIndexKeys(tree index.IndexInterface, definition Index, record map[string]interface{}, recordID string) error {
+	keys, _ := indexKeys(definition, record)
+	for _, key := range keys {
+		if err := tree.Delete(key, recordID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexRecord adds a new record to every index. If an index fails, the
+// entries already added are removed again.
+func (s *Schema) indexRecord(record map[string]interface{}, recordID string, store storage.StorageInterface) error {
+	definitions := s.definedIndexes()
+	for i, definition := range definitions {
+		err := s.changeIndex(definition, store, func(tree index.IndexInterface) error {
+			return insertIndexKeys(tree, definition, record, recordID)
+		})
+		if err != nil {
+			s.unindexRecord(definitions[:i+1], record, recordID, store)
+			return indexError(definition, err)
+		}
+	}
+	return nil
+}
+
+// unindexRecord removes a record from indexes, ignoring failures. It undoes
+// a partial indexRecord.
+func (s *Schema) unindexRecord(definitions []Index, record map[string]interface{}, recordID string, store storage.StorageInterface) {
+	for _, definition := range definitions {
+		_ = s.changeIndex(definition, store, func(tree index.IndexInterface) error {
+			return deleteIndexKeys(tree, definition, record, recordID)
+		})
+	}
+}
+
+// reindexRecords moves the index entries of updated records from their old
+// keys to their new ones. Every unique index is checked before any entry
+// changes, and old entries are removed before new ones are added, so that
+// records may swap keys. If an index fails, the indexes already changed are
+// moved back. Callers hold the collection's lock, so no other write can take
+// a key between the check and the change.
+func (s *Schema) reindexRecords(original, updated []storedRecord, store storage.StorageInterface) error {
+	definitions := s.definedIndexes()
+	changed := make([][]int, len(definitions))
+	for d, definition := range definitions {
+		for i := range updated {
+			before, _ := indexKeys(definition, original[i].doc)
+			after, _ := indexKeys(definition, updated[i].doc)
+			if !reflect.DeepEqual(before, after) {
+				changed[d] = append(changed[d], i)
+			}
+		}
+	}
+
+	for d, definition := range definitions {
+		if !definition.Unique || len(changed[d]) == 0 {
+			continue
+		}
+		tree, err := s.openIndex(definition, store)
+		if err != nil {
+			return err
+		}
+		if err := checkUnique(tree, definition, updated, changed[d]); err != nil {
+			return err
+		}
+	}
+
+	for d, definition := range definitions {
+		if len(changed[d]) == 0 {
+			continue
+		}
+
+		err := s.changeIndex(definition, store, func(tree index.IndexInterface) error {
+			for _, i := range changed[d] {
+				if err := deleteIndexKeys(tree, definition, original[i].doc, original[i].key); err != nil {
+					return err
+				}
+			}
+			for _, i := range changed[d] {
+				if err := insertIndexKeys(tree, definition, updated[i].doc, updated[i].key); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			s.restoreIndexes(definitions[:d+1], changed, original, updated, store)
+			return indexError(definition, err)
+		}
+	}
+
+	return nil
+}
+
+// restoreIndexes points indexes back at the original records, ignoring
+// failures. It undoes a partial reindexRecords.
+func (s *Schema) restoreIndexes(definitions []Index, changed [][]int, original, updated []storedRecord, store storage.StorageInterface) {
+	for d, definition := range definitions {
+		if len(changed[d]) == 0 {
+			continue
+		}
+		_ = s.changeIndex(definition, store, func(tree index.IndexInterface) error {
+			for _, i := range changed[d] {
+				_ = deleteIndexKeys(tree, definition, updated[i].doc, updated[i].key)
+			}
+			for _, i := range changed[d] {
+				_ = insertIndexKeys(tree, definition, original[i].doc, original[i].key)
+			}
+			return nil
+		})
+	}
+}
+
+// checkUnique reports whether the changed records would take a key held by
+// another record, or the same key as each other
+func checkUnique(tree index.IndexInterface, definition Index, updated []storedRecord, changed []int) error {
+	moving := make(map[string]bool, len(changed))
+	for _, i := range changed {
+		moving[updated[i].key] = true
+	}
+
+	claimed := make(map[string]string)
+	for _, i := range changed {
+		keys, _ := indexKeys(definition, updated[i].doc)
+		for _, key := range keys {
+			duplicate := &DuplicateKeyError{Index: definition.Name, Fields: definition.Fields, Values: key}
+
+			encoded, err := groupKey(key)
+			if err != nil {
+				return err
+			}
+			if other, taken := claimed[encoded]; taken && other != updated[i].key {
+				return duplicate
+			}
+			claimed[encoded] = updated[i].key
+
+			ids, err := tree.Lookup(key)
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				// A record whose key changes too gives its old key up
+				if id != updated[i].key && !moving[id] {
+					return duplicate
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// indexError reports a failure to change an index. Duplicate keys are
+// returned as they are.
+func indexError(definition Index, err error) error {
+	var duplicate *DuplicateKeyError
+	if errors.As(err, &duplicate) {
+		return err
+	}
+	return fmt.Errorf("failed to update index '%s': %w", definition.Name, err)
+}
+
+// removeRecordFromIndexes deletes a record's entries from every index
+func (s *Schema) removeRecordFromIndexes(record map[string]interface{}, recordID string, store storage.StorageInterface) error {
+	for _, definition := range s.definedIndexes() {
+		err := s.changeIndex(definition, store, func(tree index.IndexInterface) error {
+			return deleteIndexKeys(tree, definition, record, recordID)
+		})
+		if err != nil {
+			return indexError(definition, err)
+		}
+	}
+	return nil
+}
+
+func (s *Schema) changeIndex(definition Index, store storage.StorageInterface, change func(tree index.IndexInterface) error) error {
+	tree, err := s.openIndex(definition, store)
+	if err != nil {
+		return err
+	}
+	return change(tree)
+}
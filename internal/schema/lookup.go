@@ -0,0 +1,322 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/adityaparmar9813/NAP/internal/storage"
+	"github.com/adityaparmar9813/NAP/internal/validator"
+)
+
+// Populate replaces a reference to another collection with the document it
+// refers to. A field holding an array of references is replaced by the
+// documents in the same order; references without a match are dropped.
+type Populate struct {
+	// Field holds the reference, and may be a dotted path
+	Field string
+	// From is the collection the reference points into
+	From string
+	// ForeignField is matched against the reference. It defaults to "uuid".
+	ForeignField string
+	// As is where the document is stored. It defaults to Field.
+	As string
+}
+
+// join finds the documents of another collection whose foreign field equals
+// given values. It reads the foreign collection, or an index on the foreign
+// field, once for a whole set of values rather than once per document.
+type join struct {
+	from         string
+	foreignField string
+}
+
+// foreignRecord is a document of the joined collection with its position in
+// that collection, so that matches keep the collection's order
+type foreignRecord struct {
+	position int
+	doc      map[string]interface{}
+}
+
+// foreignSchema returns the schema of a joined collection. A catalog's own
+// is used when there is one, so that the join reads its indexes through the
+// structures the collection's writes go through.
+func foreignSchema(name string, catalog *Catalog, store storage.StorageInterface) (*Schema, error) {
+	if catalog != nil {
+		return catalog.Get(name)
+	}
+
+	foreign := NewSchema(name)
+	if err := store.Get(storage.SchemaCollection, name, foreign); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrCollectionNotFound, name)
+		}
+		return nil, fmt.Errorf("failed to load schema '%s': %w", name, err)
+	}
+	return foreign, nil
+}
+
+// fetch returns the foreign documents matching values, grouped by the key
+// of the value they match
+func (j join) fetch(ctx context.Context, values []interface{}, catalog *Catalog, store storage.StorageInterface) (map[string][]foreignRecord, error) {
+	foreign, err := foreignSchema(j.from, catalog, store)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(values))
+	for _, value := range values {
+		key, err := groupKey(value)
+		if err != nil {
+			return nil, err
+		}
+		wanted[key] = true
+	}
+
+	matches := make(map[string][]foreignRecord)
+	if len(wanted) == 0 {
+		return matches, nil
+	}
+
+	// An index on the foreign field limits the read to the documents that
+	// can match
+	plan, err := foreign.planQuery(map[string]interface{}{
+		j.foreignField: map[string]interface{}{"$in": values},
+	}, nil, store)
+	if err != nil {
+		return nil, err
+	}
+
+	position := 0
+	err = scanRecords(j.from, plan, nil, store, func(key string, data []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var doc map[string]interface{}
+		if err := storage.JSONToStruct(data, &doc); err != nil {
+			return fmt.Errorf("failed to load record %s: %w", key, err)
+		}
+		record := foreignRecord{position: position, doc: doc}
+		position++
+
+		keys, err := joinKeys(doc, j.foreignField)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if wanted[key] {
+				matches[key] = append(matches[key], record)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read collection '%s': %w", j.from, err)
+	}
+
+	return matches, nil
+}
+
+// joinValues returns the values a document joins on, reading path the way
+// criteria do, so "items.productId" joins on the productId of every item.
+// Each element of an array joins separately, and a missing field joins as
+// null.
+func joinValues(doc map[string]interface{}, path string) []interface{} {
+	values, _ := validator.ResolvePath(doc, path)
+	if len(values) == 0 {
+		return []interface{}{nil}
+	}
+
+	joined := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		if array, isArray := value.([]interface{}); isArray {
+			joined = append(joined, array...)
+			continue
+		}
+		joined = append(joined, value)
+	}
+	return joined
+}
+
+// joinKeys returns the keys of the values a document joins on, without
+// repeats
+func joinKeys(doc map[string]interface{}, path string) ([]string, error) {
+	values := joinValues(doc, path)
+	keys := make([]string, 0, len(values))
+	seen := make(map[string]bool, len(values))
+	for _, value := range values {
+		key, err := groupKey(value)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// lookupStage joins each document with the foreign documents matching it
+// and stores them as an array in as
+type lookupStage struct {
+	join
+	localField string
+	as         string
+}
+
+func compileLookupStage(spec interface{}) (*pipelineStage, error) {
+	options, ok := spec.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expects a document")
+	}
+
+	fields := map[string]string{}
+	for _, name := range []string{"from", "localField", "foreignField", "as"} {
+		value, ok := options[name].(string)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("'%s' must be a non-empty string", name)
+		}
+		if name != "from" && strings.HasPrefix(value, "$") {
+			return nil, fmt.Errorf("'%s' must be a field name without '$'", name)
+		}
+		fields[name] = value
+	}
+	if len(options) != len(fields) {
+		return nil, fmt.Errorf("expects only from, localField, foreignField and as")
+	}
+
+	return &pipelineStage{
+		lookup: &lookupStage{
+			join:       join{from: fields["from"], foreignField: fields["foreignField"]},
+			localField: fields["localField"],
+			as:         fields["as"],
+		},
+	}, nil
+}
+
+func (l *lookupStage) run(ctx context.Context, docs []map[string]interface{}, catalog *Catalog, store storage.StorageInterface) ([]map[string]interface{}, error) {
+	var values []interface{}
+	for _, doc := range docs {
+		values = append(values, joinValues(doc, l.localField)...)
+	}
+
+	matches, err := l.fetch(ctx, values, catalog, store)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, doc := range docs {
+		keys, err := joinKeys(doc, l.localField)
+		if err != nil {
+			return nil, err
+		}
+
+		// A document matching several of the local values is joined once,
+		// and the matches keep the order of the foreign collection
+		var joined []foreignRecord
+		seen := make(map[int]bool)
+		for _, key := range keys {
+			for _, record := range matches[key] {
+				if !seen[record.position] {
+					seen[record.position] = true
+					joined = append(joined, record)
+				}
+			}
+		}
+		sort.Slice(joined, func(a, b int) bool { return joined[a].position < joined[b].position })
+
+		array := make([]interface{}, len(joined))
+		for j, record := range joined {
+			array[j] = copyDocument(record.doc)
+		}
+
+		updated := copyDocument(doc)
+		if err := setPath(updated, l.as, array); err != nil {
+			return nil, err
+		}
+		docs[i] = updated
+	}
+
+	return docs, nil
+}
+
+// checkPopulate validates a Populate option and fills in its defaults
+func checkPopulate(populate Populate) (Populate, error) {
+	if populate.Field == "" || populate.From == "" {
+		return populate, fmt.Errorf("populate needs a field and a collection")
+	}
+	if populate.ForeignField == "" {
+		populate.ForeignField = "uuid"
+	}
+	if populate.As == "" {
+		populate.As = populate.Field
+	}
+	return populate, nil
+}
+
+// populateRecords resolves the references of records in place
+func populateRecords(ctx context.Context, records []map[string]interface{}, populate Populate, catalog *Catalog, store storage.StorageInterface) error {
+	var references []interface{}
+	for _, record := range records {
+		value, _ := fieldValue(record, populate.Field)
+		if array, isArray := value.([]interface{}); isArray {
+			references = append(references, array...)
+		} else if value != nil {
+			references = append(references, value)
+		}
+	}
+	if len(references) == 0 {
+		return nil
+	}
+
+	matches, err := join{from: populate.From, foreignField: populate.ForeignField}.fetch(ctx, references, catalog, store)
+	if err != nil {
+		return fmt.Errorf("failed to populate '%s': %w", populate.Field, err)
+	}
+
+	// resolve returns the first document a reference matches, or nil
+	resolve := func(reference interface{}) (interface{}, error) {
+		key, err := groupKey(reference)
+		if err != nil {
+			return nil, err
+		}
+		if found := matches[key]; len(found) > 0 {
+			return copyDocument(found[0].doc), nil
+		}
+		return nil, nil
+	}
+
+	for _, record := range records {
+		value, _ := fieldValue(record, populate.Field)
+		if value == nil {
+			continue
+		}
+
+		var resolved interface{}
+		if array, isArray := value.([]interface{}); isArray {
+			documents := make([]interface{}, 0, len(array))
+			for _, reference := range array {
+				doc, err := resolve(reference)
+				if err != nil {
+					return err
+				}
+				if doc != nil {
+					documents = append(documents, doc)
+				}
+			}
+			resolved = documents
+		} else if resolved, err = resolve(value); err != nil {
+			return err
+		}
+
+		if err := setPath(record, populate.As, resolved); err != nil {
+			return fmt.Errorf("failed to populate '%s': %w", populate.Field, err)
+		}
+	}
+
+	return nil
+}
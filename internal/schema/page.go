@@ -0,0 +1,145 @@
+package schema
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/adityaparmar9813/NAP/internal/storage"
+)
+
+// ErrInvalidPageToken is returned for page tokens that are malformed or
+// were issued for a different query
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// pageToken marks a position in a result order. It holds the sort keys and
+// UUID of the last record on a page rather than an offset, so the next page
+// starts in the right place even after records are inserted or deleted.
+type pageToken struct {
+	Query []byte        `json:"q"`
+	Keys  []interface{} `json:"k"`
+	UUID  string        `json:"u"`
+}
+
+// queryFingerprint identifies the criteria and sort order a token belongs to
+func queryFingerprint(criteria map[string]interface{}, fields []SortField) ([]byte, error) {
+	data, err := json.Marshal(struct {
+		Criteria map[string]interface{}
+		Sort     []SortField
+	}{criteria, normalizeSort(fields)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode query: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	return sum[:8], nil
+}
+
+// normalizeSort spells out the default ascending order
+func normalizeSort(fields []SortField) []SortField {
+	normalized := make([]SortField, len(fields))
+	for i, field := range fields {
+		if field.Order == 0 {
+			field.Order = Ascending
+		}
+		normalized[i] = field
+	}
+	return normalized
+}
+
+func encodePageToken(fingerprint []byte, record storedRecord, fields []SortField) (string, error) {
+	data, err := json.Marshal(pageToken{
+		Query: fingerprint,
+		Keys:  sortKeys(record.doc, fields),
+		UUID:  record.key,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode page token: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodePageToken(token string, fingerprint []byte, fields []SortField) (*pageToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+
+	var decoded pageToken
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, ErrInvalidPageToken
+	}
+	if string(decoded.Query) != string(fingerprint) || len(decoded.Keys) != len(fields) || decoded.UUID == "" {
+		return nil, ErrInvalidPageToken
+	}
+
+	return &decoded, nil
+}
+
+// precedes reports whether a record comes after the token's position
+func (t *pageToken) precedes(record storedRecord, fields []SortField) bool {
+	return comparePositions(sortKeys(record.doc, fields), record.key, t.Keys, t.UUID, fields) > 0
+}
+
+// GetPage returns one page of the records matching criteria, with Limit as
+// the page size, and a token for the next page. Pass the token back as
+// FindOptions.After with the same criteria and sort to continue. The token
+// is empty on the last page.
+func (s *Schema) GetPage(criteria map[string]interface{}, store storage.StorageInterface, options ...*FindOptions) ([]map[string]interface{}, string, error) {
+	findOptions := mergeFindOptions(options)
+	if findOptions.Limit <= 0 {
+		return nil, "", fmt.Errorf("GetPage needs a positive Limit as the page size")
+	}
+	projection, err := compileProjection(findOptions.Projection)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Read one record more than the page to know whether another page
+	// follows, and read whole records with their TextScore because the
+	// token needs their sort keys
+	pageSize := findOptions.Limit
+	findOptions.Limit = pageSize + 1
+	findOptions.Projection = nil
+
+	ctx := context.Background()
+	cursor, err := s.find(ctx, criteria, store, findOptions, true)
+	if err != nil {
+		return nil, "", err
+	}
+	defer cursor.Close()
+
+	var records []map[string]interface{}
+	for cursor.Next(ctx) {
+		records = append(records, cursor.current)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if len(records) > pageSize {
+		records = records[:pageSize]
+
+		fingerprint, err := queryFingerprint(criteria, findOptions.Sort)
+		if err != nil {
+			return nil, "", err
+		}
+		last := records[pageSize-1]
+		next, err = encodePageToken(fingerprint, storedRecord{key: last["uuid"].(string), doc: last}, findOptions.Sort)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	for i, record := range records {
+		records[i] = projection.apply(record)
+		delete(records[i], TextScore)
+	}
+
+	return records, next, nil
+}
@@ -0,0 +1,859 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/adityaparmar9813/NAP/internal/index"
+	"github.com/adityaparmar9813/NAP/internal/storage"
+	"github.com/adityaparmar9813/NAP/internal/validator"
+)
+
+// maxPrefixes caps the number of equality prefixes a plan combines from $in
+// lists on several fields
+const maxPrefixes = 1000
+
+// queryPlan reads the records a query may match from an index instead of
+// scanning the whole collection. Candidates are still matched against the
+// full query.
+type queryPlan struct {
+	index  Index
+	tree   *index.BTree
+	ranges []keyRange
+	// hash and keys are set instead of tree and ranges to look up keys in a
+	// hash index
+	hash *index.HashIndex
+	keys [][]interface{}
+	// ids lists the records to read directly, instead of an index, when the
+	// query asks for records by uuid
+	ids []string
+	// covered is set when the ranges select exactly the records the query
+	// matches, so that counting them needs no records at all
+	covered bool
+	// ordered is set when the index returns records in the order the query
+	// sorts them, so that they need no sorting in memory
+	ordered bool
+	// sort is the order an ordered plan returns records in
+	sort []SortField
+	// keyOrder is set when records the query does not sort still have to
+	// come in key order, as they do for pages of results
+	keyOrder bool
+	// scores holds the TextScore of each record a text search found
+	scores map[string]float64
+}
+
+// valueRange is a range of values of one field. Ranges never mix kinds of
+// values: a range without an upper bound ends with the last value of the
+// same kind as sample, as a query's comparison would.
+type valueRange struct {
+	lower, upper                   interface{}
+	hasLower, hasUpper             bool
+	lowerInclusive, upperInclusive bool
+	sample                         interface{}
+}
+
+func pointRange(value interface{}) valueRange {
+	return valueRange{
+		lower: value, upper: value,
+		hasLower: true, hasUpper: true,
+		lowerInclusive: true, upperInclusive: true,
+		sample: value,
+	}
+}
+
+func (r valueRange) point() bool {
+	return r.hasLower && r.hasUpper && validator.CompareOrder(r.lower, r.upper) == 0
+}
+
+// sameKind reports whether two values are compared by the query operators
+func sameKind(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	_, ok := validator.Compare(a, b)
+	return ok
+}
+
+// kindMinimum is the smallest value of the kind of sample
+func kindMinimum(sample interface{}) interface{} {
+	switch sample.(type) {
+	case nil:
+		return nil
+	case string:
+		return ""
+	case bool:
+		return false
+	}
+	return math.Inf(-1)
+}
+
+// intersect narrows r to the values also in other
+func (r valueRange) intersect(other valueRange) (valueRange, bool) {
+	if !sameKind(r.sample, other.sample) {
+		return valueRange{}, false
+	}
+
+	if other.hasLower {
+		order := 1
+		if r.hasLower {
+			order = validator.CompareOrder(other.lower, r.lower)
+		}
+		if order > 0 {
+			r.lower, r.hasLower, r.lowerInclusive = other.lower, true, other.lowerInclusive
+		} else if order == 0 {
+			r.lowerInclusive = r.lowerInclusive && other.lowerInclusive
+		}
+	}
+	if other.hasUpper {
+		order := -1
+		if r.hasUpper {
+			order = validator.CompareOrder(other.upper, r.upper)
+		}
+		if order < 0 {
+			r.upper, r.hasUpper, r.upperInclusive = other.upper, true, other.upperInclusive
+		} else if order == 0 {
+			r.upperInclusive = r.upperInclusive && other.upperInclusive
+		}
+	}
+
+	if r.hasLower && r.hasUpper {
+		order := validator.CompareOrder(r.lower, r.upper)
+		if order > 0 || (order == 0 && !(r.lowerInclusive && r.upperInclusive)) {
+			return valueRange{}, false
+		}
+	}
+
+	return r, true
+}
+
+// covers reports whether every value in other is also in r
+func (r valueRange) covers(other valueRange) bool {
+	if !sameKind(r.sample, other.sample) {
+		return false
+	}
+
+	if r.hasLower {
+		if !other.hasLower {
+			return false
+		}
+		order := validator.CompareOrder(other.lower, r.lower)
+		if order < 0 || (order == 0 && other.lowerInclusive && !r.lowerInclusive) {
+			return false
+		}
+	}
+	if r.hasUpper {
+		if !other.hasUpper {
+			return false
+		}
+		order := validator.CompareOrder(other.upper, r.upper)
+		if order > 0 || (order == 0 && other.upperInclusive && !r.upperInclusive) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// locate places value before (-1), inside (0) or after (1) the range, in
+// ascending order
+func (r valueRange) locate(value interface{}) int {
+	if !sameKind(value, r.sample) {
+		return validator.CompareOrder(value, r.sample)
+	}
+	if r.hasLower {
+		order := validator.CompareOrder(value, r.lower)
+		if order < 0 || (order == 0 && !r.lowerInclusive) {
+			return -1
+		}
+	}
+	if r.hasUpper {
+		order := validator.CompareOrder(value, r.upper)
+		if order > 0 || (order == 0 && !r.upperInclusive) {
+			return 1
+		}
+	}
+	return 0
+}
+
+// keyRange selects the index entries whose leading fields equal prefix and,
+// when bound is set, whose next field is in bound. An empty keyRange selects
+// every entry.
+type keyRange struct {
+	prefix []interface{}
+	bound  *valueRange
+	// descending is set when the bound field is ordered from largest to
+	// smallest
+	descending bool
+}
+
+// scan calls fn with the entries of tree in r, in the tree's order. When
+// from is set the scan starts at the entry for from and fromID instead of at
+// the start of r.
+func (r keyRange) scan(tree *index.BTree, from []interface{}, fromID string, fn func(key []interface{}, id string) error) error {
+	if from == nil {
+		from = append([]interface{}{}, r.prefix...)
+		if r.bound != nil {
+			switch {
+			case !r.descending && r.bound.hasLower:
+				from = append(from, r.bound.lower)
+			case !r.descending:
+				from = append(from, kindMinimum(r.bound.sample))
+			case r.bound.hasUpper:
+				from = append(from, r.bound.upper)
+			}
+		}
+	}
+
+	position := len(r.prefix)
+	return tree.ScanFrom(from, fromID, func(key []interface{}, id string) error {
+		for i, value := range r.prefix {
+			if validator.CompareOrder(key[i], value) != 0 {
+				return storage.ErrStopScan
+			}
+		}
+		if r.bound == nil {
+			return fn(key, id)
+		}
+
+		location := r.bound.locate(key[position])
+		if r.descending {
+			location = -location
+		}
+		switch {
+		case location < 0:
+			return nil
+		case location > 0:
+			return storage.ErrStopScan
+		}
+		return fn(key, id)
+	})
+}
+
+// recordIDs returns the records the plan selects, in key order
+func (p *queryPlan) recordIDs() ([]string, error) {
+	if p.hash != nil {
+		return p.lookupIDs()
+	}
+	if p.tree == nil {
+		return p.ids, nil
+	}
+
+	seen := make(map[string]bool)
+	var ids []string
+	err := p.scanIndex(nil, func(id string) error {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// scanIndex calls fn with the id of every entry in the plan's ranges, in
+// index order. The index is read as fn asks for more, so a large range is
+// never held in memory. An ordered plan starts at after's position when it
+// is set.
+func (p *queryPlan) scanIndex(after *pageToken, fn func(id string) error) error {
+	var from []interface{}
+	fromID := ""
+	if after != nil && p.ordered {
+		from, fromID = p.seek(after), after.UUID
+	}
+
+	var fnErr error
+	for _, r := range p.ranges {
+		err := r.scan(p.tree, from, fromID, func(key []interface{}, id string) error {
+			if err := fn(id); err != nil {
+				fnErr = err
+				return storage.ErrStopScan
+			}
+			return nil
+		})
+		if fnErr != nil {
+			return fnErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read index '%s': %w", p.index.Name, err)
+		}
+	}
+	return nil
+}
+
+// seek returns the index key of the position a page token marks. Only an
+// ordered plan has one, in its single range.
+func (p *queryPlan) seek(token *pageToken) []interface{} {
+	prefix := p.ranges[0].prefix
+	key := append([]interface{}{}, prefix...)
+	for _, field := range p.index.Fields[len(prefix):] {
+		for i, sortField := range p.sort {
+			if sortField.Field == field {
+				key = append(key, token.Keys[i])
+			}
+		}
+	}
+	return key
+}
+
+// scanIDs calls fn with every record the plan selects, once each. Records
+// come in index order, unless the plan is neither ordered nor allowed to
+// leave key order. The scan starts at after's position when it is set and
+// the records come in its order.
+func (p *queryPlan) scanIDs(after *pageToken, fn func(id string) error) error {
+	if p.tree == nil || (p.keyOrder && !p.ordered) {
+		ids, err := p.recordIDs()
+		if err != nil {
+			return err
+		}
+		if after != nil && len(after.Keys) == 0 {
+			ids = ids[sort.SearchStrings(ids, after.UUID):]
+		}
+		for _, id := range ids {
+			if err := fn(id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Only a multikey index or several ranges can list a record twice
+	var seen map[string]bool
+	if p.tree.Multikey() || len(p.ranges) > 1 {
+		seen = make(map[string]bool)
+	}
+	return p.scanIndex(after, func(id string) error {
+		if seen != nil {
+			if seen[id] {
+				return nil
+			}
+			seen[id] = true
+		}
+		return fn(id)
+	})
+}
+
+// lookupIDs looks the plan's keys up in its hash index
+func (p *queryPlan) lookupIDs() ([]string, error) {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, key := range p.keys {
+		found, err := p.hash.Lookup(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read index '%s': %w", p.index.Name, err)
+		}
+		for _, id := range found {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// any reports whether the plan selects any record
+func (p *queryPlan) any() (bool, error) {
+	if p.tree == nil {
+		ids, err := p.recordIDs()
+		return len(ids) > 0, err
+	}
+
+	found := false
+	for _, r := range p.ranges {
+		err := r.scan(p.tree, nil, "", func(key []interface{}, id string) error {
+			found = true
+			return storage.ErrStopScan
+		})
+		if err != nil {
+			return false, fmt.Errorf("failed to read index '%s': %w", p.index.Name, err)
+		}
+		if found {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// scanRecords calls fn with the key and JSON of every record plan selects,
+// or of every record in the collection when plan is nil, in the plan's
+// order or in key order. When after is set and the records come in its
+// order, the scan seeks to its position instead of reading the records
+// before it. Returning storage.ErrStopScan from fn ends the scan early
+// without an error.
+func scanRecords(collection string, plan *queryPlan, after *pageToken, store storage.StorageInterface, fn func(key string, data []byte) error) error {
+	if plan == nil {
+		start := ""
+		if after != nil && len(after.Keys) == 0 {
+			start = after.UUID
+		}
+		return store.ScanFrom(collection, start, fn)
+	}
+
+	err := plan.scanIDs(after, func(id string) error {
+		var data json.RawMessage
+		err := store.Get(collection, id, &data)
+		if errors.Is(err, storage.ErrNotFound) {
+			// Deleted since the index was read
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load record %s: %w", id, err)
+		}
+
+		return fn(id, data)
+	})
+	if errors.Is(err, storage.ErrStopScan) {
+		return nil
+	}
+	return err
+}
+
+// planQuery picks an index for criteria and an optional sort. Indexes are
+// ranked by how many leading fields they match for equality, then by
+// whether the next field has a range, then by whether they are hash
+// indexes or return records in sort order. It returns nil when no index
+// applies and the collection has to be scanned.
+func (s *Schema) planQuery(criteria map[string]interface{}, sortFields []SortField, store storage.StorageInterface) (*queryPlan, error) {
+	// Only the text index knows which records a $text search matches
+	if search, isText := criteria["$text"]; isText {
+		return s.planText(search, store)
+	}
+
+	conditions := make(map[string][]interface{})
+	complete := collectConditions(criteria, conditions)
+
+	// Records are stored under their uuid, so they can be read directly
+	if ranges, constrained, _ := fieldRanges(conditions["uuid"], false); constrained && allPoints(ranges) {
+		return &queryPlan{ids: pointIDs(ranges)}, nil
+	}
+
+	var best *queryPlan
+	bestScore := 0
+	for _, definition := range s.definedIndexes() {
+		implied, applies := impliedFields(definition, conditions)
+		if !applies || definition.ExpireAfter > 0 {
+			continue
+		}
+
+		opened, err := s.openIndex(definition, store)
+		if err != nil {
+			return nil, err
+		}
+
+		var plan *queryPlan
+		score := 0
+		switch structure := opened.(type) {
+		case *index.BTree:
+			plan, score = planIndex(definition, structure, conditions, implied, complete, sortFields)
+		case *index.HashIndex:
+			plan, score = planHash(definition, structure, conditions, implied, complete)
+		}
+		if plan != nil && score > bestScore {
+			best, bestScore = plan, score
+		}
+	}
+
+	return best, nil
+}
+
+// planIndex matches conditions against the fields of an index, in order:
+// equality on each leading field, then a range on the next one. Every entry
+// already meets the conditions on the implied fields.
+func planIndex(definition Index, tree *index.BTree, conditions map[string][]interface{}, implied map[string]bool, complete bool, sortFields []SortField) (*queryPlan, int) {
+	multikey := tree.Multikey()
+	prefixes := [][]interface{}{{}}
+	var bounds []valueRange
+	consumed := copyFields(implied)
+	exact := true
+
+	position := 0
+	for ; position < len(definition.Fields); position++ {
+		field := definition.Fields[position]
+		ranges, constrained, fieldExact := fieldRanges(conditions[field], multikey)
+		if !constrained {
+			break
+		}
+
+		if allPoints(ranges) {
+			if len(prefixes)*len(ranges) > maxPrefixes {
+				break
+			}
+			prefixes = extendPrefixes(prefixes, ranges)
+			consumed[field] = true
+			exact = exact && fieldExact
+			continue
+		}
+
+		bounds = ranges
+		consumed[field] = true
+		exact = exact && fieldExact
+		break
+	}
+	equalities := position
+
+	var ranges []keyRange
+	for _, prefix := range prefixes {
+		if bounds == nil {
+			ranges = append(ranges, keyRange{prefix: prefix})
+			continue
+		}
+		for i := range bounds {
+			ranges = append(ranges, keyRange{prefix: prefix, bound: &bounds[i], descending: tree.Descending(position)})
+		}
+	}
+
+	for field := range conditions {
+		if !consumed[field] {
+			exact = false
+		}
+	}
+
+	plan := &queryPlan{
+		index:   definition,
+		tree:    tree,
+		ranges:  ranges,
+		covered: complete && exact,
+		ordered: len(sortFields) > 0 && !multikey && len(prefixes) == 1 && len(bounds) <= 1 && sortsInOrder(definition, tree, equalities, sortFields),
+	}
+	if plan.ordered {
+		plan.sort = sortFields
+	}
+
+	score := 4 * equalities
+	if bounds != nil {
+		score += 2
+	}
+	if plan.ordered {
+		score++
+	}
+	if score == 0 {
+		return nil, 0
+	}
+	return plan, score
+}
+
+// planHash looks up every combination of the values a query allows for the
+// fields of a hash index. Every field needs an equality or $in condition.
+func planHash(definition Index, hash *index.HashIndex, conditions map[string][]interface{}, implied map[string]bool, complete bool) (*queryPlan, int) {
+	keys := [][]interface{}{{}}
+	consumed := copyFields(implied)
+	exact := true
+
+	for _, field := range definition.Fields {
+		ranges, constrained, fieldExact := fieldRanges(conditions[field], hash.Multikey())
+		if !constrained || !allPoints(ranges) || len(keys)*len(ranges) > maxPrefixes {
+			return nil, 0
+		}
+		keys = extendPrefixes(keys, ranges)
+		consumed[field] = true
+		exact = exact && fieldExact
+	}
+
+	for field := range conditions {
+		if !consumed[field] {
+			exact = false
+		}
+	}
+
+	plan := &queryPlan{index: definition, hash: hash, keys: keys, covered: complete && exact}
+	return plan, 4*len(definition.Fields) + 1
+}
+
+func copyFields(fields map[string]bool) map[string]bool {
+	copied := make(map[string]bool, len(fields))
+	for field, set := range fields {
+		copied[field] = set
+	}
+	return copied
+}
+
+// impliedFields reports whether a partial or sparse index holds every record
+// that can meet conditions. It also returns the fields whose conditions are
+// exactly the index's filter, which every entry meets.
+func impliedFields(definition Index, conditions map[string][]interface{}) (map[string]bool, bool) {
+	implied := make(map[string]bool)
+	if definition.Sparse && !requiresValue(definition.Fields, conditions) {
+		return nil, false
+	}
+	if definition.Filter == nil {
+		return implied, true
+	}
+
+	required := make(map[string][]interface{})
+	if !collectConditions(definition.Filter, required) {
+		return nil, false
+	}
+	for field, filterConditions := range required {
+		if reflect.DeepEqual(conditions[field], filterConditions) {
+			implied[field] = true
+			continue
+		}
+		for _, condition := range filterConditions {
+			if !impliesCondition(conditions[field], condition) {
+				return nil, false
+			}
+		}
+	}
+
+	return implied, true
+}
+
+// requiresValue reports whether conditions rule out a null or missing value
+// for any of fields
+func requiresValue(fields []string, conditions map[string][]interface{}) bool {
+	for _, field := range fields {
+		ranges, constrained, _ := fieldRanges(conditions[field], false)
+		if !constrained {
+			continue
+		}
+
+		nullable := false
+		for _, r := range ranges {
+			if r.sample == nil {
+				nullable = true
+			}
+		}
+		if !nullable {
+			return true
+		}
+	}
+	return false
+}
+
+// impliesCondition reports whether the conditions on a field only allow
+// values that also meet condition
+func impliesCondition(conditions []interface{}, condition interface{}) bool {
+	for _, existing := range conditions {
+		if reflect.DeepEqual(existing, condition) {
+			return true
+		}
+	}
+
+	allowed, constrained, exact := fieldRanges([]interface{}{condition}, false)
+	if !constrained || !exact {
+		return false
+	}
+	ranges, constrained, _ := fieldRanges(conditions, false)
+	if !constrained {
+		return false
+	}
+
+	for _, r := range ranges {
+		covered := false
+		for _, other := range allowed {
+			if other.covers(r) {
+				covered = true
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// extendPrefixes appends each point of ranges to each prefix
+func extendPrefixes(prefixes [][]interface{}, ranges []valueRange) [][]interface{} {
+	extended := make([][]interface{}, 0, len(prefixes)*len(ranges))
+	for _, prefix := range prefixes {
+		for _, r := range ranges {
+			extended = append(extended, append(append([]interface{}{}, prefix...), r.lower))
+		}
+	}
+	return extended
+}
+
+// sortsInOrder reports whether the entries sharing an equality prefix come
+// in the order of sortFields. The sort has to cover every remaining field,
+// in the same directions, for records that tie to come in UUID order.
+func sortsInOrder(definition Index, tree *index.BTree, equalities int, sortFields []SortField) bool {
+	var remaining []SortField
+	for _, field := range sortFields {
+		prefixField := false
+		for _, equal := range definition.Fields[:equalities] {
+			if field.Field == equal {
+				prefixField = true
+			}
+		}
+		if !prefixField {
+			remaining = append(remaining, field)
+		}
+	}
+
+	if len(remaining) != len(definition.Fields)-equalities {
+		return false
+	}
+	for i, field := range remaining {
+		position := equalities + i
+		if field.Field != definition.Fields[position] || (field.Order == Descending) != tree.Descending(position) {
+			return false
+		}
+	}
+	return true
+}
+
+// pointIDs returns the distinct uuids of point ranges in ascending order
+func pointIDs(ranges []valueRange) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, r := range ranges {
+		if id, ok := r.lower.(string); ok && !seen[id] && storage.ValidateName(id) == nil {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func allPoints(ranges []valueRange) bool {
+	for _, r := range ranges {
+		if !r.point() {
+			return false
+		}
+	}
+	return true
+}
+
+// collectConditions gathers the conditions on each field that criteria
+// requires together, looking into $and. It returns false if criteria also
+// has conditions that cannot be gathered this way.
+func collectConditions(criteria map[string]interface{}, conditions map[string][]interface{}) bool {
+	complete := true
+	for key, condition := range criteria {
+		if key == "$and" {
+			clauses, ok := condition.([]interface{})
+			if !ok {
+				complete = false
+				continue
+			}
+			for _, clause := range clauses {
+				nested, ok := clause.(map[string]interface{})
+				if !ok || !collectConditions(nested, conditions) {
+					complete = false
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(key, "$") {
+			complete = false
+			continue
+		}
+		conditions[key] = append(conditions[key], condition)
+	}
+	return complete
+}
+
+// fieldRanges converts the conditions on a field into the ranges of values
+// they allow. constrained is false when no condition narrows the values, and
+// exact is false when some condition was left for the query to check.
+//
+// On a multikey index each condition may be met by a different element of
+// an array, so only the first condition is used.
+func fieldRanges(conditions []interface{}, multikey bool) (ranges []valueRange, constrained, exact bool) {
+	exact = true
+
+	for _, condition := range conditions {
+		operators, isExpression := condition.(map[string]interface{})
+		if !isExpression || !isOperatorExpression(operators) {
+			operators = map[string]interface{}{"$eq": condition}
+		}
+
+		names := make([]string, 0, len(operators))
+		for operator := range operators {
+			names = append(names, operator)
+		}
+		sort.Strings(names)
+
+		for _, operator := range names {
+			allowed, ok := operatorRanges(operator, operators[operator])
+			if !ok || (multikey && constrained) {
+				exact = false
+				continue
+			}
+			ranges, constrained = intersectRanges(ranges, constrained, allowed)
+		}
+	}
+
+	return ranges, constrained, exact
+}
+
+func intersectRanges(ranges []valueRange, constrained bool, allowed []valueRange) ([]valueRange, bool) {
+	if !constrained {
+		return allowed, true
+	}
+
+	var intersection []valueRange
+	for _, r := range ranges {
+		for _, other := range allowed {
+			if narrowed, ok := r.intersect(other); ok {
+				intersection = append(intersection, narrowed)
+			}
+		}
+	}
+	return intersection, true
+}
+
+// operatorRanges converts a query operator into ranges, if it can be
+// answered from an index
+func operatorRanges(operator string, operand interface{}) ([]valueRange, bool) {
+	switch operator {
+	case "$eq":
+		if !indexable(operand) {
+			return nil, false
+		}
+		return []valueRange{pointRange(operand)}, true
+	case "$in":
+		values, ok := operand.([]interface{})
+		if !ok {
+			return nil, false
+		}
+		ranges := make([]valueRange, 0, len(values))
+		for _, value := range values {
+			if !indexable(value) {
+				return nil, false
+			}
+			ranges = append(ranges, pointRange(value))
+		}
+		return ranges, true
+	case "$gt", "$gte", "$lt", "$lte":
+		if operand == nil || !indexable(operand) {
+			return nil, false
+		}
+		r := valueRange{sample: operand}
+		inclusive := strings.HasSuffix(operator, "e")
+		if strings.HasPrefix(operator, "$g") {
+			r.lower, r.hasLower, r.lowerInclusive = operand, true, inclusive
+		} else {
+			r.upper, r.hasUpper, r.upperInclusive = operand, true, inclusive
+		}
+		return []valueRange{r}, true
+	}
+	return nil, false
+}
+
+// indexable reports whether an index lookup of value finds exactly the
+// records a query for it matches
+func indexable(value interface{}) bool {
+	switch value.(type) {
+	case nil, string, bool:
+		return true
+	case map[string]interface{}, []interface{}, *regexp.Regexp:
+		return false
+	}
+	_, isNumber := validator.ToFloat(value)
+	return isNumber
+}
@@ -0,0 +1,246 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/adityaparmar9813/NAP/internal/storage"
+	"github.com/adityaparmar9813/NAP/internal/validator"
+)
+
+// ErrRecordNotFound is returned by the by-UUID operations when no record has
+// the given UUID
+var ErrRecordNotFound = errors.New("record not found")
+
+// UpdateResult reports how many records matched an update and how many of
+// them actually changed
+type UpdateResult struct {
+	MatchedCount  int
+	ModifiedCount int
+}
+
+// storedRecord is a record loaded from storage together with its key
+type storedRecord struct {
+	key string
+	doc map[string]interface{}
+}
+
+// findRecords returns every record matching criteria. Changes are applied
+// after the scan so that no engine is written to while it is being read.
+func (s *Schema) findRecords(criteria map[string]interface{}, store storage.StorageInterface) ([]storedRecord, error) {
+	query, err := validator.Compile(criteria)
+	if err != nil {
+		return nil, fmt.Errorf("invalid criteria: %w", err)
+	}
+
+	plan, err := s.planQuery(criteria, nil, store)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []storedRecord
+
+	err = scanRecords(s.Name, plan, nil, store, func(key string, data []byte) error {
+		var record map[string]interface{}
+		if err := storage.JSONToStruct(data, &record); err != nil {
+			return fmt.Errorf("failed to load record %s: %w", key, err)
+		}
+
+		if query.Matches(record) {
+			records = append(records, storedRecord{key: key, doc: record})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read collection: %w", err)
+	}
+
+	return records, nil
+}
+
+// loadRecord reads the record stored under recordID
+func (s *Schema) loadRecord(recordID string, store storage.StorageInterface) (storedRecord, error) {
+	var record map[string]interface{}
+	err := store.Get(s.Name, recordID, &record)
+	if errors.Is(err, storage.ErrNotFound) {
+		return storedRecord{}, fmt.Errorf("%w: %s", ErrRecordNotFound, recordID)
+	}
+	if err != nil {
+		return storedRecord{}, fmt.Errorf("failed to load record %s: %w", recordID, err)
+	}
+
+	return storedRecord{key: recordID, doc: record}, nil
+}
+
+// UpdateRecords sets the fields in update on every record matching criteria.
+// Each resulting document is validated before anything is written, so an
+// invalid update leaves the collection untouched.
+func (s *Schema) UpdateRecords(criteria, update map[string]interface{}, validator validator.ValidatorInterface, store storage.StorageInterface) (UpdateResult, error) {
+	s.state().mu.Lock()
+	defer s.state().mu.Unlock()
+
+	records, err := s.findRecords(criteria, store)
+	if err != nil {
+		return UpdateResult{}, err
+	}
+
+	return s.applyUpdates(records, func(doc map[string]interface{}) (map[string]interface{}, error) {
+		return applyUpdate(doc, update)
+	}, validator, store)
+}
+
+// UpdateRecordByUUID sets the fields in update on a single record
+func (s *Schema) UpdateRecordByUUID(recordID string, update map[string]interface{}, validator validator.ValidatorInterface, store storage.StorageInterface) (UpdateResult, error) {
+	s.state().mu.Lock()
+	defer s.state().mu.Unlock()
+
+	record, err := s.loadRecord(recordID, store)
+	if err != nil {
+		return UpdateResult{}, err
+	}
+
+	return s.applyUpdates([]storedRecord{record}, func(doc map[string]interface{}) (map[string]interface{}, error) {
+		return applyUpdate(doc, update)
+	}, validator, store)
+}
+
+// ReplaceRecord swaps the whole document stored under recordID for doc. The
+// record keeps its UUID.
+func (s *Schema) ReplaceRecord(recordID string, doc map[string]interface{}, validator validator.ValidatorInterface, store storage.StorageInterface) (UpdateResult, error) {
+	s.state().mu.Lock()
+	defer s.state().mu.Unlock()
+
+	record, err := s.loadRecord(recordID, store)
+	if err != nil {
+		return UpdateResult{}, err
+	}
+
+	return s.applyUpdates([]storedRecord{record}, func(existing map[string]interface{}) (map[string]interface{}, error) {
+		if id, exists := doc["uuid"]; exists && !sameUUID(id, recordID) {
+			return nil, fmt.Errorf("field 'uuid' cannot be modified")
+		}
+
+		replacement := make(map[string]interface{}, len(doc)+1)
+		for key, value := range doc {
+			replacement[key] = value
+		}
+		replacement["uuid"] = recordID
+		return replacement, nil
+	}, validator, store)
+}
+
+// applyUpdates computes and validates the new version of every record,
+// checks it against the unique indexes, then writes the ones that changed
+func (s *Schema) applyUpdates(records []storedRecord, change func(doc map[string]interface{}) (map[string]interface{}, error), validator validator.ValidatorInterface, store storage.StorageInterface) (UpdateResult, error) {
+	result := UpdateResult{MatchedCount: len(records)}
+	var modified, original []storedRecord
+
+	for _, record := range records {
+		updated, err := change(record.doc)
+		if err != nil {
+			return UpdateResult{}, fmt.Errorf("record %s: %w", record.key, err)
+		}
+		if err := s.Validate(updated, validator); err != nil {
+			return UpdateResult{}, fmt.Errorf("record %s: %w", record.key, err)
+		}
+
+		// Compare the documents as they would be stored, so that writing an
+		// int over the float64 it was loaded as is not counted as a change
+		normalized, err := normalizeDocument(updated)
+		if err != nil {
+			return UpdateResult{}, fmt.Errorf("record %s: %w", record.key, err)
+		}
+		if reflect.DeepEqual(normalized, record.doc) {
+			continue
+		}
+
+		modified = append(modified, storedRecord{key: record.key, doc: normalized})
+		original = append(original, record)
+	}
+
+	if err := s.reindexRecords(original, modified, store); err != nil {
+		return UpdateResult{}, err
+	}
+
+	for i, record := range modified {
+		if err := store.Put(s.Name, record.key, record.doc); err != nil {
+			// Point the indexes back at the records that were not written
+			_ = s.reindexRecords(modified[i:], original[i:], store)
+			return result, fmt.Errorf("failed to save record %s: %w", record.key, err)
+		}
+		result.ModifiedCount++
+	}
+
+	return result, nil
+}
+
+func sameUUID(value, recordID interface{}) bool {
+	id, ok := value.(string)
+	return ok && id == recordID
+}
+
+// normalizeDocument round-trips doc through JSON
+func normalizeDocument(doc map[string]interface{}) (map[string]interface{}, error) {
+	data, err := storage.StructToJSON(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert document to JSON: %w", err)
+	}
+
+	var normalized map[string]interface{}
+	if err := storage.JSONToStruct(data, &normalized); err != nil {
+		return nil, err
+	}
+
+	return normalized, nil
+}
+
+// DeleteRecords removes every record matching criteria and returns how many
+// were deleted
+func (s *Schema) DeleteRecords(criteria map[string]interface{}, store storage.StorageInterface) (int, error) {
+	s.state().mu.Lock()
+	defer s.state().mu.Unlock()
+
+	records, err := s.findRecords(criteria, store)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, record := range records {
+		err := store.Delete(s.Name, record.key)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete record %s: %w", record.key, err)
+		}
+		if err := s.removeRecordFromIndexes(record.doc, record.key, store); err != nil {
+			return deleted, fmt.Errorf("record %s: %w", record.key, err)
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// DeleteRecordByUUID removes a single record
+func (s *Schema) DeleteRecordByUUID(recordID string, store storage.StorageInterface) error {
+	s.state().mu.Lock()
+	defer s.state().mu.Unlock()
+
+	record, err := s.loadRecord(recordID, store)
+	if err != nil {
+		return err
+	}
+
+	err = store.Delete(s.Name, recordID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("%w: %s", ErrRecordNotFound, recordID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete record %s: %w", recordID, err)
+	}
+
+	return s.removeRecordFromIndexes(record.doc, recordID, store)
+}
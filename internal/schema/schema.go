@@ -1,9 +1,9 @@
 package schema
 
 import (
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"sync"
 
 	"github.com/adityaparmar9813/NAP/internal/storage"
 	"github.com/adityaparmar9813/NAP/internal/types"
@@ -15,11 +15,22 @@ type Field struct {
 	Name     string
 	Type     types.FieldType
 	Required bool
+	// Unique rejects two records with the same value. A record without the
+	// field counts as having null.
+	Unique bool
 }
 
 type Schema struct {
-	Name   string
-	Fields map[string]Field
+	Name    string
+	Fields  map[string]Field
+	Indexes []Index
+
+	// indexMu guards Indexes, which is only read to save the schema: the
+	// definitions in use are kept in the state of the collection
+	indexMu sync.RWMutex
+
+	shared     *collection
+	sharedOnce sync.Once
 }
 
 func NewSchema(name string) *Schema {
@@ -47,7 +58,14 @@ func (s *Schema) AddField(field Field) error {
 	return nil
 }
 
-func BuildSchema(name string, storage storage.StorageInterface, fields ...Field) (*Schema, error) {
+func BuildSchema(name string, store storage.StorageInterface, fields ...Field) (*Schema, error) {
+	if err := storage.ValidateName(name); err != nil {
+		return nil, fmt.Errorf("invalid collection name: %w", err)
+	}
+	if storage.IsSystemCollection(name) {
+		return nil, fmt.Errorf("collection name '%s' is reserved", name)
+	}
+
 	schema := NewSchema(name)
 
 	// Add UUID field by default
@@ -66,11 +84,31 @@ func BuildSchema(name string, storage storage.StorageInterface, fields ...Field)
 		if err != nil {
 			return nil, err
 		}
+		if field.Unique {
+			schema.Indexes = append(schema.Indexes, Index{
+				Name:   UniqueIndexPrefix + field.Name,
+				Fields: []string{field.Name},
+				Unique: true,
+			})
+		}
+	}
+
+	// Never overwrite an existing definition with a different one
+	existing := NewSchema(name)
+	err = store.Get(storage.SchemaCollection, name, existing)
+	if err == nil {
+		if !existing.sameDefinition(schema) {
+			return nil, fmt.Errorf("%w: %s", ErrSchemaConflict, name)
+		}
+		schema.Indexes = existing.Indexes
+		return schema, nil
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
 	}
 
-	// Save the schema to a file
-	schemaPath := filepath.Join("./schemas", name+".json")
-	err = storage.SaveStructToFile(schema, schemaPath)
+	// Save the schema definition
+	err = store.Put(storage.SchemaCollection, name, schema)
 	if err != nil {
 		return nil, err
 	}
@@ -109,54 +147,32 @@ func (s *Schema) AddRecord(doc map[string]interface{}, validator validator.Valid
 		return err
 	}
 
+	s.state().mu.Lock()
+	defer s.state().mu.Unlock()
+
 	// Add UUID field
 	recordID := uuid.New().String()
 	doc["uuid"] = recordID
 
-	// Create collection directory if it doesn't exist
-	collectionPath := filepath.Join("./collections", s.Name)
-	err = os.MkdirAll(collectionPath, 0755)
+	// Index the record as it will be stored, with Go slices and numbers
+	// turned into their JSON forms
+	record, err := normalizeDocument(doc)
 	if err != nil {
-		return fmt.Errorf("failed to create collection directory: %w", err)
+		return err
 	}
 
-	// Save the record to a file named after its UUID
-	filePath := filepath.Join(collectionPath, recordID+".json")
-	err = storage.SaveStructToFile(doc, filePath)
-	if err != nil {
-		return fmt.Errorf("failed to save record: %w", err)
+	if err := s.indexRecord(record, recordID, storage); err != nil {
+		return err
 	}
 
-	return nil
-}
-
-func (s *Schema) GetRecord(criteria map[string]interface{}, storage storage.StorageInterface) ([]map[string]interface{}, error) {
-	collectionPath := filepath.Join("./collections", s.Name)
-	files, err := os.ReadDir(collectionPath)
+	// Save the record under its UUID
+	err = storage.Put(s.Name, recordID, record)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read collection directory: %w", err)
-	}
-
-	var matchingRecords []map[string]interface{}
-
-	for _, file := range files {
-		if filepath.Ext(file.Name()) != ".json" {
-			continue
-		}
-
-		filePath := filepath.Join(collectionPath, file.Name())
-		var record map[string]interface{}
-		err := storage.LoadStructFromFile(filePath, &record)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load record from file %s: %w", file.Name(), err)
-		}
-
-		if validator.MatchesCriteria(record, criteria) {
-			matchingRecords = append(matchingRecords, record)
-		}
+		s.unindexRecord(s.definedIndexes(), record, recordID, storage)
+		return fmt.Errorf("failed to save record: %w", err)
 	}
 
-	return matchingRecords, nil
+	return nil
 }
 
 func (s *Schema) PrintSchema() {
@@ -0,0 +1,82 @@
+package schema
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/adityaparmar9813/NAP/internal/index"
+	"github.com/adityaparmar9813/NAP/internal/storage"
+	"github.com/adityaparmar9813/NAP/internal/validator"
+)
+
+// TextScore is the field holding how well a record matches a $text search.
+// Sort on it, {Field: TextScore, Order: Descending}, to return the best
+// matches first, and project it with {"<field>": {"$meta": "textScore"}}.
+// Records never store it.
+const TextScore = "$textScore"
+
+// textKeys returns the single key a text index holds for a record: every
+// string in its indexed fields, including those in arrays. Records without
+// any text are not indexed.
+func textKeys(definition Index, record map[string]interface{}) [][]interface{} {
+	var key []interface{}
+	for _, field := range definition.Fields {
+		values, _ := validator.ResolvePath(record, field)
+		for _, value := range values {
+			key = appendStrings(key, value)
+		}
+	}
+
+	if len(key) == 0 {
+		return nil
+	}
+	return [][]interface{}{key}
+}
+
+func appendStrings(key []interface{}, value interface{}) []interface{} {
+	switch typed := value.(type) {
+	case string:
+		return append(key, typed)
+	case []interface{}:
+		for _, element := range typed {
+			key = appendStrings(key, element)
+		}
+	}
+	return key
+}
+
+// planText searches the collection's text index for a $text condition. The
+// plan reads the matching records in UUID order along with their scores;
+// the rest of the criteria is left for the query to check.
+func (s *Schema) planText(search interface{}, store storage.StorageInterface) (*queryPlan, error) {
+	for _, definition := range s.definedIndexes() {
+		if definition.Type != TextIndex {
+			continue
+		}
+
+		opened, err := s.openIndex(definition, store)
+		if err != nil {
+			return nil, err
+		}
+		text, isText := opened.(*index.TextIndex)
+		if !isText {
+			return nil, fmt.Errorf("index '%s' is not a text index", definition.Name)
+		}
+
+		terms, _ := search.(map[string]interface{})["$search"].(string)
+		scores, err := text.Search(index.ParseTextQuery(terms))
+		if err != nil {
+			return nil, fmt.Errorf("failed to search index '%s': %w", definition.Name, err)
+		}
+
+		ids := make([]string, 0, len(scores))
+		for id := range scores {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		return &queryPlan{index: definition, ids: ids, scores: scores}, nil
+	}
+
+	return nil, fmt.Errorf("%w on collection '%s'", ErrNoTextIndex, s.Name)
+}
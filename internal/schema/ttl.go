@@ -0,0 +1,219 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adityaparmar9813/NAP/internal/index"
+	"github.com/adityaparmar9813/NAP/internal/storage"
+	"github.com/adityaparmar9813/NAP/internal/validator"
+)
+
+// DefaultExpireBatchSize is the number of expired records deleted at a time
+// when no batch size is given
+const DefaultExpireBatchSize = 100
+
+// expiryKeys returns the keys of a record in a TTL index: the time of each
+// date in the indexed field, in milliseconds since the epoch. Dates are RFC
+// 3339 strings, as $currentDate writes them, or milliseconds since the
+// epoch. A record without a date has no keys and never expires.
+func expiryKeys(definition Index, record map[string]interface{}) ([][]interface{}, bool) {
+	values, throughArray := validator.ResolvePath(record, definition.Fields[0])
+	elements, fromArray := fieldElements(values)
+
+	var keys [][]interface{}
+	for _, value := range elements {
+		if milliseconds, isDate := dateMilliseconds(value); isDate {
+			keys = append(keys, []interface{}{milliseconds})
+		}
+	}
+	return keys, (throughArray || fromArray) && len(keys) > 0
+}
+
+// dateMilliseconds converts a date to milliseconds since the epoch
+func dateMilliseconds(value interface{}) (float64, bool) {
+	if text, isString := value.(string); isString {
+		date, err := time.Parse(time.RFC3339Nano, text)
+		if err != nil {
+			return 0, false
+		}
+		return float64(date.UnixMilli()), true
+	}
+
+	number, isNumber := validator.ToFloat(value)
+	return number, isNumber && !math.IsNaN(number) && !math.IsInf(number, 0)
+}
+
+// ExpireRecords deletes the records whose date in a TTL index is more than
+// the index's ExpireAfter before now, and returns how many it removed. The
+// records are deleted batchSize at a time, and writes to the collection may
+// run between batches.
+func (s *Schema) ExpireRecords(ctx context.Context, now time.Time, batchSize int, store storage.StorageInterface) (int, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultExpireBatchSize
+	}
+
+	removed := 0
+	for _, definition := range s.definedIndexes() {
+		if definition.ExpireAfter <= 0 {
+			continue
+		}
+
+		cutoff := float64(now.Add(-definition.ExpireAfter).UnixMilli())
+		for {
+			if err := ctx.Err(); err != nil {
+				return removed, err
+			}
+
+			deleted, more, err := s.expireBatch(definition, cutoff, batchSize, store)
+			removed += deleted
+			if err != nil {
+				return removed, err
+			}
+			if !more {
+				break
+			}
+		}
+	}
+
+	return removed, nil
+}
+
+// expireBatch deletes up to batchSize records dated at or before cutoff in
+// a TTL index. more is set when the batch was full.
+func (s *Schema) expireBatch(definition Index, cutoff float64, batchSize int, store storage.StorageInterface) (deleted int, more bool, err error) {
+	s.state().mu.Lock()
+	defer s.state().mu.Unlock()
+
+	opened, err := s.openIndex(definition, store)
+	if err != nil {
+		return 0, false, err
+	}
+	tree, isTree := opened.(*index.BTree)
+	if !isTree {
+		return 0, false, fmt.Errorf("TTL index '%s' is not a B+tree", definition.Name)
+	}
+
+	expired := keyRange{bound: &valueRange{upper: cutoff, hasUpper: true, upperInclusive: true, sample: cutoff}}
+	var entries []index.Entry
+	seen := make(map[string]bool)
+	err = expired.scan(tree, nil, "", func(key []interface{}, id string) error {
+		if !seen[id] {
+			seen[id] = true
+			entries = append(entries, index.Entry{Key: key, ID: id})
+		}
+		if len(entries) == batchSize {
+			return storage.ErrStopScan
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read index '%s': %w", definition.Name, err)
+	}
+
+	for _, entry := range entries {
+		record, err := s.loadRecord(entry.ID, store)
+		if errors.Is(err, ErrRecordNotFound) {
+			// Drop an entry left behind by a failed delete
+			if err := tree.Delete(entry.Key, entry.ID); err != nil {
+				return deleted, false, indexError(definition, err)
+			}
+			continue
+		}
+		if err != nil {
+			return deleted, false, err
+		}
+
+		if err := store.Delete(s.Name, entry.ID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return deleted, false, fmt.Errorf("failed to delete record %s: %w", entry.ID, err)
+		}
+		if err := s.removeRecordFromIndexes(record.doc, entry.ID, store); err != nil {
+			return deleted, false, fmt.Errorf("record %s: %w", entry.ID, err)
+		}
+		deleted++
+	}
+
+	return deleted, len(entries) == batchSize, nil
+}
+
+// ExpireRecords deletes the expired records of every collection with a TTL
+// index, and returns how many were removed from each collection that had
+// any
+func (c *Catalog) ExpireRecords(ctx context.Context, now time.Time, batchSize int) (map[string]int, error) {
+	c.mu.RLock()
+	names := make([]string, 0, len(c.schemas))
+	for name := range c.schemas {
+		names = append(names, name)
+	}
+	schemas := make(map[string]*Schema, len(c.schemas))
+	for name, schema := range c.schemas {
+		schemas[name] = schema
+	}
+	c.mu.RUnlock()
+	sort.Strings(names)
+
+	removed := make(map[string]int)
+	for _, name := range names {
+		count, err := schemas[name].ExpireRecords(ctx, now, batchSize, c.storage)
+		if count > 0 {
+			removed[name] = count
+		}
+		if err != nil {
+			return removed, fmt.Errorf("collection '%s': %w", name, err)
+		}
+	}
+
+	return removed, nil
+}
+
+// Reaper deletes expired records from the collections of a catalog in the
+// background
+type Reaper struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+// StartReaper runs ExpireRecords every interval until the reaper is
+// stopped. report, if not nil, is called after every pass that removed
+// records or failed, with the number removed from each collection.
+func (c *Catalog) StartReaper(interval time.Duration, batchSize int, report func(removed map[string]int, err error)) *Reaper {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Reaper{cancel: cancel, done: make(chan struct{})}
+
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				removed, err := c.ExpireRecords(ctx, now, batchSize)
+				if errors.Is(err, context.Canceled) {
+					return
+				}
+				if report != nil && (len(removed) > 0 || err != nil) {
+					report(removed, err)
+				}
+			}
+		}
+	}()
+
+	return r
+}
+
+// Stop ends the reaper, waiting for a pass in progress to stop between
+// batches. It is safe to call more than once.
+func (r *Reaper) Stop() {
+	r.once.Do(r.cancel)
+	<-r.done
+}
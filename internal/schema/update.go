@@ -0,0 +1,482 @@
+package schema
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adityaparmar9813/NAP/internal/validator"
+)
+
+// updateOperators maps every supported update operator to the function that
+// applies one of its fields
+var updateOperators = map[string]func(doc map[string]interface{}, path string, operand interface{}) error{
+	"$set":         setOperator,
+	"$unset":       unsetOperator,
+	"$inc":         incOperator,
+	"$mul":         mulOperator,
+	"$push":        pushOperator,
+	"$addToSet":    addToSetOperator,
+	"$pull":        pullOperator,
+	"$pop":         popOperator,
+	"$rename":      renameOperator,
+	"$min":         minOperator,
+	"$max":         maxOperator,
+	"$currentDate": currentDateOperator,
+}
+
+// applyUpdate returns a copy of doc with update applied. update is either a
+// set of operators such as {"$set": {"address.city": "Pune"}} or, as a
+// shorthand for $set, a plain map of fields.
+func applyUpdate(doc, update map[string]interface{}) (map[string]interface{}, error) {
+	operators, err := parseUpdate(update)
+	if err != nil {
+		return nil, err
+	}
+
+	// Work on a JSON copy so that the caller's document and operands are
+	// never shared with the result, and numbers compare the way they will
+	// once stored
+	updated, err := normalizeDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+	normalizedOperators, err := normalizeDocument(operators)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(normalizedOperators))
+	for name := range normalizedOperators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fields := normalizedOperators[name].(map[string]interface{})
+		paths := make([]string, 0, len(fields))
+		for path := range fields {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		for _, path := range paths {
+			if err := updateOperators[name](updated, path, fields[path]); err != nil {
+				return nil, fmt.Errorf("%s '%s': %w", name, path, err)
+			}
+		}
+	}
+
+	return updated, nil
+}
+
+// parseUpdate checks an update document and returns it as operators
+func parseUpdate(update map[string]interface{}) (map[string]interface{}, error) {
+	hasOperators := false
+	for key := range update {
+		if strings.HasPrefix(key, "$") {
+			hasOperators = true
+			break
+		}
+	}
+	if !hasOperators {
+		update = map[string]interface{}{"$set": update}
+	}
+
+	var paths []string
+	for name, fields := range update {
+		if _, known := updateOperators[name]; !known {
+			if !strings.HasPrefix(name, "$") {
+				return nil, fmt.Errorf("cannot mix update operators and plain field '%s'", name)
+			}
+			return nil, fmt.Errorf("unknown update operator '%s'", name)
+		}
+
+		fieldMap, ok := fields.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s expects a document of fields", name)
+		}
+
+		for path, operand := range fieldMap {
+			paths = append(paths, path)
+			if name == "$rename" {
+				target, ok := operand.(string)
+				if !ok {
+					return nil, fmt.Errorf("$rename '%s': target must be a string", path)
+				}
+				paths = append(paths, target)
+			}
+		}
+	}
+
+	sort.Strings(paths)
+	for i, path := range paths {
+		if path == "" || strings.HasPrefix(path, ".") || strings.HasSuffix(path, ".") || strings.Contains(path, "..") {
+			return nil, fmt.Errorf("invalid field path '%s'", path)
+		}
+		if path == "uuid" || strings.HasPrefix(path, "uuid.") {
+			return nil, fmt.Errorf("field 'uuid' cannot be modified")
+		}
+
+		// Updating a path and one of its parents in the same update is ambiguous
+		for _, other := range paths[:i] {
+			if other == path || strings.HasPrefix(path, other+".") {
+				return nil, fmt.Errorf("updating '%s' conflicts with '%s'", path, other)
+			}
+		}
+	}
+
+	return update, nil
+}
+
+// fieldValue reads path as a single value, the way expressions and update
+// operators see a field. The path is resolved as criteria resolve it, and
+// one that goes through an array of documents gives the list of values it
+// reaches there.
+func fieldValue(doc map[string]interface{}, path string) (interface{}, bool) {
+	values, throughArray := validator.ResolvePath(doc, path)
+	if throughArray {
+		return append([]interface{}{}, values...), true
+	}
+	if len(values) == 0 {
+		return nil, false
+	}
+	return values[0], true
+}
+
+// parentOf walks to the container holding the last segment of path. With
+// create set, missing documents along the way are added.
+func parentOf(doc map[string]interface{}, path string, create bool) (interface{}, string, error) {
+	segments := strings.Split(path, ".")
+	var current interface{} = doc
+
+	for _, segment := range segments[:len(segments)-1] {
+		switch container := current.(type) {
+		case map[string]interface{}:
+			next, exists := container[segment]
+			if !exists || next == nil {
+				if !create {
+					return nil, "", nil
+				}
+				next = make(map[string]interface{})
+				container[segment] = next
+			}
+			current = next
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(container) {
+				return nil, "", fmt.Errorf("cannot use '%s' to index an array", segment)
+			}
+			current = container[index]
+		default:
+			return nil, "", fmt.Errorf("cannot traverse '%s' in a non-document value", segment)
+		}
+	}
+
+	return current, segments[len(segments)-1], nil
+}
+
+// setPath stores value at a dotted path, creating documents as needed
+func setPath(doc map[string]interface{}, path string, value interface{}) error {
+	parent, last, err := parentOf(doc, path, true)
+	if err != nil {
+		return err
+	}
+
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		container[last] = value
+	case []interface{}:
+		index, err := strconv.Atoi(last)
+		if err != nil || index < 0 || index >= len(container) {
+			return fmt.Errorf("array index '%s' is out of range", last)
+		}
+		container[index] = value
+	default:
+		return fmt.Errorf("cannot set a field in a non-document value")
+	}
+
+	return nil
+}
+
+// removePath deletes the value at a dotted path. Array elements are set to
+// null rather than removed, so the positions of the others do not change.
+func removePath(doc map[string]interface{}, path string) (interface{}, bool) {
+	parent, last, err := parentOf(doc, path, false)
+	if err != nil {
+		return nil, false
+	}
+
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		value, exists := container[last]
+		delete(container, last)
+		return value, exists
+	case []interface{}:
+		index, err := strconv.Atoi(last)
+		if err != nil || index < 0 || index >= len(container) {
+			return nil, false
+		}
+		value := container[index]
+		container[index] = nil
+		return value, true
+	}
+
+	return nil, false
+}
+
+func setOperator(doc map[string]interface{}, path string, operand interface{}) error {
+	return setPath(doc, path, operand)
+}
+
+func unsetOperator(doc map[string]interface{}, path string, operand interface{}) error {
+	removePath(doc, path)
+	return nil
+}
+
+func incOperator(doc map[string]interface{}, path string, operand interface{}) error {
+	return arithmetic(doc, path, operand, func(current, operand float64) float64 {
+		return current + operand
+	})
+}
+
+func mulOperator(doc map[string]interface{}, path string, operand interface{}) error {
+	// Multiplying a missing field sets it to zero, as in MongoDB
+	return arithmetic(doc, path, operand, func(current, operand float64) float64 {
+		return current * operand
+	})
+}
+
+// arithmetic combines a numeric field with a numeric operand. A missing field
+// starts at zero.
+func arithmetic(doc map[string]interface{}, path string, operand interface{}, apply func(current, operand float64) float64) error {
+	number, ok := operand.(float64)
+	if !ok {
+		return fmt.Errorf("operand must be a number, got %v", operand)
+	}
+
+	current := 0.0
+	if value, exists := fieldValue(doc, path); exists {
+		existing, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("cannot apply to non-numeric value %v", value)
+		}
+		current = existing
+	}
+
+	result := apply(current, number)
+	if math.IsInf(result, 0) || math.IsNaN(result) {
+		return fmt.Errorf("result is not a finite number")
+	}
+
+	return setPath(doc, path, result)
+}
+
+// arrayAt returns the array stored at path, or nil when the field is missing
+func arrayAt(doc map[string]interface{}, path string) ([]interface{}, bool, error) {
+	value, exists := fieldValue(doc, path)
+	if !exists || value == nil {
+		return nil, false, nil
+	}
+
+	array, ok := value.([]interface{})
+	if !ok {
+		return nil, false, fmt.Errorf("field is not an array")
+	}
+
+	return array, true, nil
+}
+
+// eachValues expands an operand that may use the {"$each": [...]} modifier
+func eachValues(operand interface{}) ([]interface{}, error) {
+	modifier, ok := operand.(map[string]interface{})
+	if !ok {
+		return []interface{}{operand}, nil
+	}
+
+	each, exists := modifier["$each"]
+	if !exists {
+		return []interface{}{operand}, nil
+	}
+	if len(modifier) != 1 {
+		return nil, fmt.Errorf("$each cannot be combined with other fields")
+	}
+
+	values, ok := each.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("$each expects an array")
+	}
+
+	return values, nil
+}
+
+func pushOperator(doc map[string]interface{}, path string, operand interface{}) error {
+	array, _, err := arrayAt(doc, path)
+	if err != nil {
+		return err
+	}
+
+	values, err := eachValues(operand)
+	if err != nil {
+		return err
+	}
+
+	return setPath(doc, path, append(array, values...))
+}
+
+func addToSetOperator(doc map[string]interface{}, path string, operand interface{}) error {
+	array, _, err := arrayAt(doc, path)
+	if err != nil {
+		return err
+	}
+
+	values, err := eachValues(operand)
+	if err != nil {
+		return err
+	}
+
+	for _, value := range values {
+		if !containsValue(array, value) {
+			array = append(array, value)
+		}
+	}
+
+	return setPath(doc, path, array)
+}
+
+// containsValue reports whether array holds value. Both come from JSON, so
+// deep equality is exact.
+func containsValue(array []interface{}, value interface{}) bool {
+	for _, element := range array {
+		if reflect.DeepEqual(element, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// pullOperator removes every element matching the operand: a value, an
+// operator expression such as {"$gte": 6}, or criteria that document
+// elements are matched against
+func pullOperator(doc map[string]interface{}, path string, operand interface{}) error {
+	array, exists, err := arrayAt(doc, path)
+	if err != nil || !exists {
+		return err
+	}
+
+	criteria, isCriteria := operand.(map[string]interface{})
+	var query *validator.Query
+	if isCriteria && !isOperatorExpression(criteria) {
+		if query, err = validator.Compile(criteria); err != nil {
+			return err
+		}
+	}
+
+	kept := make([]interface{}, 0, len(array))
+	for _, element := range array {
+		document, isDocument := element.(map[string]interface{})
+		if query != nil && isDocument {
+			if query.Matches(document) {
+				continue
+			}
+		} else if validator.MatchesValue(element, operand) {
+			continue
+		}
+		kept = append(kept, element)
+	}
+
+	return setPath(doc, path, kept)
+}
+
+func isOperatorExpression(operand map[string]interface{}) bool {
+	for key := range operand {
+		if strings.HasPrefix(key, "$") {
+			return true
+		}
+	}
+	return false
+}
+
+// popOperator removes the last element of an array for 1 and the first for -1
+func popOperator(doc map[string]interface{}, path string, operand interface{}) error {
+	direction, ok := operand.(float64)
+	if !ok || (direction != 1 && direction != -1) {
+		return fmt.Errorf("operand must be 1 or -1")
+	}
+
+	array, exists, err := arrayAt(doc, path)
+	if err != nil || !exists || len(array) == 0 {
+		return err
+	}
+
+	if direction == 1 {
+		array = array[:len(array)-1]
+	} else {
+		array = array[1:]
+	}
+
+	return setPath(doc, path, array)
+}
+
+func renameOperator(doc map[string]interface{}, path string, operand interface{}) error {
+	value, exists := removePath(doc, path)
+	if !exists {
+		return nil
+	}
+
+	return setPath(doc, operand.(string), value)
+}
+
+func minOperator(doc map[string]interface{}, path string, operand interface{}) error {
+	return compareAndSet(doc, path, operand, -1)
+}
+
+func maxOperator(doc map[string]interface{}, path string, operand interface{}) error {
+	return compareAndSet(doc, path, operand, 1)
+}
+
+// compareAndSet replaces the field with operand when operand orders in the
+// wanted direction (-1 for smaller, 1 for larger), or when it is missing
+func compareAndSet(doc map[string]interface{}, path string, operand interface{}, want int) error {
+	current, exists := fieldValue(doc, path)
+	if !exists {
+		return setPath(doc, path, operand)
+	}
+
+	order, ok := validator.Compare(operand, current)
+	if !ok {
+		return fmt.Errorf("cannot compare %v with %v", operand, current)
+	}
+	if order == want {
+		return setPath(doc, path, operand)
+	}
+
+	return nil
+}
+
+// currentDateOperator sets a field to the current time: an RFC 3339 string
+// for true or {"$type": "date"}, milliseconds since the epoch for
+// {"$type": "timestamp"}
+func currentDateOperator(doc map[string]interface{}, path string, operand interface{}) error {
+	now := time.Now().UTC()
+
+	switch spec := operand.(type) {
+	case bool:
+		if spec {
+			return setPath(doc, path, now.Format(time.RFC3339Nano))
+		}
+	case map[string]interface{}:
+		switch spec["$type"] {
+		case "date":
+			return setPath(doc, path, now.Format(time.RFC3339Nano))
+		case "timestamp":
+			return setPath(doc, path, float64(now.UnixMilli()))
+		}
+	}
+
+	return fmt.Errorf("operand must be true, {\"$type\": \"date\"} or {\"$type\": \"timestamp\"}")
+}
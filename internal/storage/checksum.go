@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+)
+
+// Every document written by FileStorage starts with a header line holding the
+// CRC32 of the JSON that follows it, e.g. "NAPCRC32 1a2b3c4d\n{...}".
+// Files without the header predate checksums and are read unverified.
+const checksumPrefix = "NAPCRC32 "
+
+const checksumHeaderSize = len(checksumPrefix) + 8 + 1
+
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrCorrupt is matched by every CorruptionError, so callers can test for
+// corruption with errors.Is without caring about the details
+var ErrCorrupt = errors.New("corrupt document")
+
+// CorruptionError reports a stored document that failed verification
+type CorruptionError struct {
+	Path   string
+	Reason string
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("corrupt document %s: %s", e.Path, e.Reason)
+}
+
+func (e *CorruptionError) Is(target error) bool {
+	return target == ErrCorrupt
+}
+
+// addChecksum prepends the checksum header to data
+func addChecksum(data []byte) []byte {
+	out := make([]byte, 0, checksumHeaderSize+len(data))
+	out = append(out, checksumPrefix...)
+	out = append(out, fmt.Sprintf("%08x\n", crc32.Checksum(data, checksumTable))...)
+	return append(out, data...)
+}
+
+// verifyChecksum strips and checks the checksum header, returning the payload.
+// Data without a header is returned as is.
+func verifyChecksum(data []byte, path string) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(checksumPrefix)) {
+		return data, nil
+	}
+
+	if len(data) < checksumHeaderSize || data[checksumHeaderSize-1] != '\n' {
+		return nil, &CorruptionError{Path: path, Reason: "truncated checksum header"}
+	}
+
+	expected, err := strconv.ParseUint(string(data[len(checksumPrefix):checksumHeaderSize-1]), 16, 32)
+	if err != nil {
+		return nil, &CorruptionError{Path: path, Reason: "malformed checksum header"}
+	}
+
+	payload := data[checksumHeaderSize:]
+	if actual := crc32.Checksum(payload, checksumTable); actual != uint32(expected) {
+		return nil, &CorruptionError{
+			Path:   path,
+			Reason: fmt.Sprintf("checksum mismatch: expected %08x, got %08x", expected, actual),
+		}
+	}
+
+	return payload, nil
+}
@@ -2,21 +2,257 @@ package storage
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 )
 
-type StorageInterface interface {
-	SaveStructToFile(v interface{}, filename string) error
-	LoadStructFromFile(filepath string, v interface{}) error
-}
+// walCheckpointSize is the log size at which FileStorage empties the WAL
+const walCheckpointSize = 4 << 20
 
-type FileStorage struct{}
+// FileStorage stores every document as its own JSON file. A collection lives
+// in "<root>/collections/<collection>/<key>.json"; reserved collections such
+// as "_schemas" live in "<root>/schemas/<key>.json".
+type FileStorage struct {
+	mu   sync.Mutex
+	root string
+	wal  *WAL
+}
 
 func NewFileStorage() *FileStorage {
-	return &FileStorage{}
+	return &FileStorage{root: "."}
+}
+
+// NewFileStorageWithWAL returns a FileStorage that logs every mutation to the
+// write-ahead log at walPath before applying it. Entries left behind by a
+// crash are replayed before the storage is returned.
+func NewFileStorageWithWAL(walPath string) (*FileStorage, error) {
+	return openFileStorage(".", walPath)
+}
+
+// OpenFileStorage returns a FileStorage rooted at root, with its write-ahead
+// log in "<root>/wal/napdb.wal"
+func OpenFileStorage(root string) (*FileStorage, error) {
+	return openFileStorage(root, filepath.Join(root, "wal", "napdb.wal"))
+}
+
+func openFileStorage(root, walPath string) (*FileStorage, error) {
+	wal, err := OpenWAL(walPath)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := &FileStorage{root: root, wal: wal}
+
+	err = wal.Replay(func(entry WALEntry) error {
+		return fs.applyEntry(entry)
+	})
+	if err != nil {
+		wal.Close()
+		return nil, err
+	}
+
+	// Everything replayed is on disk now, so the log can start over
+	if err := fs.checkpoint(); err != nil {
+		wal.Close()
+		return nil, err
+	}
+	if err := fs.removeTempFiles(); err != nil {
+		wal.Close()
+		return nil, err
+	}
+
+	return fs, nil
+}
+
+// removeTempFiles deletes the temporary files of writes cut short by a
+// crash. SaveJSONToFile creates them next to the document, so they can only
+// be in a collection directory: "<root>/collections/<collection>" or, for
+// reserved collections, a directory directly under the root.
+func (fs *FileStorage) removeTempFiles() error {
+	dirs, err := subdirectories(fs.root)
+	if err != nil {
+		return err
+	}
+	collections, err := subdirectories(filepath.Join(fs.root, "collections"))
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range append(dirs, collections...) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("failed to read directory: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !isTempFile(entry.Name()) {
+				continue
+			}
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove temporary file: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// isTempFile reports whether name is one of SaveJSONToFile's temporary
+// files, "<key>.json.<random>.tmp"
+func isTempFile(name string) bool {
+	base := strings.TrimSuffix(name, ".tmp")
+	return base != name && strings.Contains(base, ".json.")
+}
+
+func subdirectories(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	var dirs []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs = append(dirs, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return dirs, nil
+}
+
+func (fs *FileStorage) collectionDir(collection string) string {
+	if IsSystemCollection(collection) {
+		return filepath.Join(fs.root, collection[1:])
+	}
+	return filepath.Join(fs.root, "collections", collection)
+}
+
+func (fs *FileStorage) documentPath(collection, key string) string {
+	return filepath.Join(fs.collectionDir(collection), key+".json")
+}
+
+func (fs *FileStorage) Put(collection, key string, v interface{}) error {
+	if err := validateAddress(collection, key); err != nil {
+		return err
+	}
+
+	return fs.SaveStructToFile(v, fs.documentPath(collection, key))
+}
+
+func (fs *FileStorage) Get(collection, key string, v interface{}) error {
+	if err := validateAddress(collection, key); err != nil {
+		return err
+	}
+
+	err := fs.LoadStructFromFile(fs.documentPath(collection, key), v)
+	if errors.Is(err, os.ErrNotExist) {
+		return notFound(collection, key)
+	}
+
+	return err
+}
+
+func (fs *FileStorage) Delete(collection, key string) error {
+	if err := validateAddress(collection, key); err != nil {
+		return err
+	}
+
+	filename := fs.documentPath(collection, key)
+	walKey, err := fs.walKey(filename)
+	if err != nil {
+		return err
+	}
+	entry := WALEntry{Op: WALOpDelete, Key: walKey}
+
+	// Check for the file under the lock, so that a concurrent delete cannot
+	// remove it between the check and the logged delete
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return notFound(collection, key)
+	}
+	if fs.wal == nil {
+		return fs.applyEntry(entry)
+	}
+
+	if _, err := fs.wal.Append(entry.Op, entry.Key, nil); err != nil {
+		return err
+	}
+
+	return fs.applyEntry(entry)
+}
+
+func (fs *FileStorage) Scan(collection string, fn func(key string, data []byte) error) error {
+	return fs.ScanFrom(collection, "", fn)
+}
+
+func (fs *FileStorage) ScanFrom(collection, start string, fn func(key string, data []byte) error) error {
+	if err := ValidateName(collection); err != nil {
+		return fmt.Errorf("collection: %w", err)
+	}
+
+	files, err := fs.ListFiles(fs.collectionDir(collection))
+	if err != nil {
+		return err
+	}
+
+	// File names do not sort like their keys, since "a-b.json" comes before
+	// "a.json" while "a" comes before "a-b"
+	sort.Slice(files, func(i, j int) bool {
+		return documentKey(files[i]) < documentKey(files[j])
+	})
+	first := sort.Search(len(files), func(i int) bool {
+		return documentKey(files[i]) >= start
+	})
+
+	for _, filename := range files[first:] {
+		key := documentKey(filename)
+		data, err := LoadJSONFromFile(filename)
+		if errors.Is(err, os.ErrNotExist) {
+			// Deleted since the directory was listed
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !json.Valid(data) {
+			return &CorruptionError{Path: filename, Reason: "invalid JSON"}
+		}
+
+		if err := fn(key, data); err != nil {
+			if errors.Is(err, ErrStopScan) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// documentKey returns the key of the document stored in filename
+func documentKey(filename string) string {
+	return strings.TrimSuffix(filepath.Base(filename), ".json")
+}
+
+// Sync checkpoints the WAL. Every write is already durable once it returns.
+func (fs *FileStorage) Sync() error {
+	if fs.wal == nil {
+		return nil
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.checkpoint()
 }
 
 func StructToJSON(v interface{}) ([]byte, error) {
@@ -27,6 +263,9 @@ func JSONToStruct(data []byte, v interface{}) error {
 	return json.Unmarshal(data, v)
 }
 
+// SaveJSONToFile writes data, prefixed with its checksum, to a temporary file
+// in the target directory, fsyncs it and renames it over filename. Readers
+// therefore see either the old document or the new one, never a torn write.
 func SaveJSONToFile(data []byte, filename string) error {
 	// Ensure the directory exists
 	dir := filepath.Dir(filename)
@@ -34,22 +273,50 @@ func SaveJSONToFile(data []byte, filename string) error {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	// Create or open the file
-	file, err := os.Create(filename)
+	file, err := os.CreateTemp(dir, filepath.Base(filename)+".*.tmp")
 	if err != nil {
 		return fmt.Errorf("failed to create file: %w", err)
 	}
-	defer file.Close()
+	tmpName := file.Name()
 
 	// Write the data
-	_, err = file.Write(data)
+	_, err = file.Write(addChecksum(data))
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
+		os.Remove(tmpName)
 		return fmt.Errorf("failed to write to file: %w", err)
 	}
 
+	if err := os.Rename(tmpName, filename); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("failed to rename file: %w", err)
+	}
+
+	return syncDir(dir)
+}
+
+// syncDir fsyncs a directory so that a rename inside it is durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open directory: %w", err)
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync directory: %w", err)
+	}
+
 	return nil
 }
 
+// LoadJSONFromFile reads a document and verifies its checksum, returning the
+// JSON payload. A mismatch is reported as a *CorruptionError.
 func LoadJSONFromFile(filename string) ([]byte, error) {
 	file, err := os.Open(filename)
 	if err != nil {
@@ -62,7 +329,7 @@ func LoadJSONFromFile(filename string) ([]byte, error) {
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
 
-	return data, nil
+	return verifyChecksum(data, filename)
 }
 
 func (fs *FileStorage) SaveStructToFile(v interface{}, filename string) error {
@@ -71,7 +338,7 @@ func (fs *FileStorage) SaveStructToFile(v interface{}, filename string) error {
 		return fmt.Errorf("failed to convert struct to JSON: %w", err)
 	}
 
-	return SaveJSONToFile(data, filename)
+	return fs.save(data, filename)
 }
 
 func (fs *FileStorage) AddStructToFile(v interface{}, filename string) error {
@@ -80,7 +347,121 @@ func (fs *FileStorage) AddStructToFile(v interface{}, filename string) error {
 		return fmt.Errorf("failed to convert struct to JSON: %w", err)
 	}
 
-	return SaveJSONToFile(data, filename)
+	return fs.save(data, filename)
+}
+
+func (fs *FileStorage) save(data []byte, filename string) error {
+	if fs.wal == nil {
+		return SaveJSONToFile(data, filename)
+	}
+
+	key, err := fs.walKey(filename)
+	if err != nil {
+		return err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	entry := WALEntry{Op: WALOpPut, Key: key, Data: data}
+	seq, err := fs.wal.Append(entry.Op, entry.Key, entry.Data)
+	if err != nil {
+		return err
+	}
+	entry.Seq = seq
+
+	if err := fs.applyEntry(entry); err != nil {
+		return err
+	}
+
+	if fs.wal.Size() >= walCheckpointSize {
+		return fs.checkpoint()
+	}
+
+	return nil
+}
+
+// walKey is how a file is named in the WAL: relative to the root, so that
+// replaying does not depend on the working directory. Files outside the
+// root are named by their absolute path.
+func (fs *FileStorage) walKey(filename string) (string, error) {
+	relative, err := filepath.Rel(fs.root, filename)
+	if err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(relative), nil
+	}
+
+	absolute, err := filepath.Abs(filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve path: %w", err)
+	}
+	return absolute, nil
+}
+
+// walFile returns the file a WAL key names
+func (fs *FileStorage) walFile(key string) string {
+	if filepath.IsAbs(key) {
+		return key
+	}
+	return filepath.Join(fs.root, filepath.FromSlash(key))
+}
+
+// applyEntry performs a logged mutation. Puts carry the whole file contents,
+// so applying an entry twice is harmless.
+func (fs *FileStorage) applyEntry(entry WALEntry) error {
+	filename := fs.walFile(entry.Key)
+	switch entry.Op {
+	case WALOpPut:
+		return SaveJSONToFile(entry.Data, filename)
+	case WALOpDelete:
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove file: %w", err)
+		}
+		return syncDir(filepath.Dir(filename))
+	default:
+		return fmt.Errorf("unknown WAL op: %d", entry.Op)
+	}
+}
+
+// checkpoint empties the WAL. Entries are applied with durable writes before
+// the mutation returns, so none of them are needed for recovery anymore.
+func (fs *FileStorage) checkpoint() error {
+	return fs.wal.Truncate()
+}
+
+// Close checkpoints and closes the WAL, if there is one
+func (fs *FileStorage) Close() error {
+	if fs.wal == nil {
+		return nil
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.checkpoint(); err != nil {
+		return err
+	}
+
+	return fs.wal.Close()
+}
+
+func (fs *FileStorage) ListFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		files = append(files, filepath.Join(dir, entry.Name()))
+	}
+
+	return files, nil
 }
 
 func (fs *FileStorage) LoadStructFromFile(filename string, v interface{}) error {
@@ -89,5 +470,55 @@ func (fs *FileStorage) LoadStructFromFile(filename string, v interface{}) error
 		return err
 	}
 
-	return JSONToStruct(data, v)
+	return decodeDocument(data, filename, v)
+}
+
+// decodeDocument unmarshals a stored document, reporting malformed JSON as
+// corruption of the file it came from
+func decodeDocument(data []byte, filename string, v interface{}) error {
+	err := JSONToStruct(data, v)
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return &CorruptionError{Path: filename, Reason: fmt.Sprintf("invalid JSON: %v", err)}
+	}
+
+	return err
+}
+
+// MigrateDirectory copies every JSON document in dir, a collection directory
+// written by FileStorage, into collection on dst. Keys are the file names
+// without the ".json" extension. The source files are left in place; remove
+// them once the migrated collection has been verified. It returns the number
+// of documents copied.
+func MigrateDirectory(dir string, dst StorageInterface, collection string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	count := 0
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		filename := filepath.Join(dir, entry.Name())
+		data, err := LoadJSONFromFile(filename)
+		if err != nil {
+			return count, err
+		}
+
+		var doc json.RawMessage
+		if err := decodeDocument(data, filename, &doc); err != nil {
+			return count, err
+		}
+
+		if err := dst.Put(collection, documentKey(filename), doc); err != nil {
+			return count, fmt.Errorf("failed to migrate %s: %w", filename, err)
+		}
+		count++
+	}
+
+	return count, nil
 }
@@ -0,0 +1,793 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// LSMStorage is a log-structured storage engine. Writes go to a write-ahead
+// log and an in-memory sorted memtable; full memtables are flushed to
+// immutable sorted SSTables, which a background goroutine merges with
+// size-tiered compaction. Every write is a sequential append.
+//
+// All collections share one tree rooted at a single directory. Entries are
+// keyed by "<collection>\x00<key>", so a collection is a contiguous key range.
+type LSMStorage struct {
+	mu      sync.RWMutex
+	dir     string
+	options LSMOptions
+	wal     *WAL
+	mem     *memtable
+	// tables is ordered newest first
+	tables []*sstable
+	nextID uint64
+
+	// failure is the last flush or compaction error no caller has seen.
+	// Neither loses a write, which is in the WAL or the input tables, so
+	// they are reported by Sync and Close rather than by the write that
+	// happened to trigger them.
+	failure error
+
+	compactCh chan struct{}
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closed    bool
+}
+
+// LSMOptions tunes an LSMStorage. Zero values select the defaults.
+type LSMOptions struct {
+	// MemtableSize is the approximate number of bytes buffered in memory
+	// before the memtable is flushed to an SSTable
+	MemtableSize int
+	// CompactionThreshold is the number of similarly sized SSTables that
+	// triggers a compaction
+	CompactionThreshold int
+}
+
+const (
+	lsmManifestFile   = "MANIFEST"
+	lsmWALFile        = "memtable.wal"
+	lsmTableExt       = ".sst"
+	defaultMemtable   = 4 << 20
+	defaultCompaction = 4
+)
+
+// lsmManifest lists the live SSTables, newest first
+type lsmManifest struct {
+	Tables []uint64 `json:"tables"`
+	NextID uint64   `json:"next_id"`
+}
+
+// NewLSMStorage opens or creates an LSM engine rooted at dir, replaying the
+// memtable's write-ahead log and starting the background compactor
+func NewLSMStorage(dir string, options LSMOptions) (*LSMStorage, error) {
+	if options.MemtableSize <= 0 {
+		options.MemtableSize = defaultMemtable
+	}
+	if options.CompactionThreshold < 2 {
+		options.CompactionThreshold = defaultCompaction
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	ls := &LSMStorage{
+		dir:       dir,
+		options:   options,
+		mem:       newMemtable(),
+		nextID:    1,
+		compactCh: make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+
+	if err := ls.loadTables(); err != nil {
+		ls.closeTables()
+		return nil, err
+	}
+
+	wal, err := OpenWAL(filepath.Join(dir, lsmWALFile))
+	if err != nil {
+		ls.closeTables()
+		return nil, err
+	}
+	ls.wal = wal
+
+	err = wal.Replay(func(entry WALEntry) error {
+		ls.mem.put(entry.Key, entry.Data, entry.Op == WALOpDelete)
+		return nil
+	})
+	if err != nil {
+		ls.closeTables()
+		wal.Close()
+		return nil, err
+	}
+
+	ls.wg.Add(1)
+	go ls.compactLoop()
+	ls.triggerCompaction()
+
+	return ls, nil
+}
+
+// loadTables opens every SSTable listed in the manifest and removes files
+// left behind by an interrupted flush or compaction
+func (ls *LSMStorage) loadTables() error {
+	var manifest lsmManifest
+	manifestPath := filepath.Join(ls.dir, lsmManifestFile)
+
+	if _, err := os.Stat(manifestPath); err == nil {
+		data, err := LoadJSONFromFile(manifestPath)
+		if err != nil {
+			return err
+		}
+		if err := decodeDocument(data, manifestPath, &manifest); err != nil {
+			return err
+		}
+	}
+
+	live := make(map[string]bool)
+	for _, id := range manifest.Tables {
+		path := ls.tablePath(id)
+		table, err := openSSTable(id, path)
+		if err != nil {
+			return err
+		}
+		ls.tables = append(ls.tables, table)
+		live[filepath.Base(path)] = true
+	}
+	if manifest.NextID > ls.nextID {
+		ls.nextID = manifest.NextID
+	}
+
+	entries, err := os.ReadDir(ls.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read directory: %w", err)
+	}
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) == lsmTableExt && !live[entry.Name()] {
+			os.Remove(filepath.Join(ls.dir, entry.Name()))
+		}
+	}
+
+	return nil
+}
+
+func (ls *LSMStorage) tablePath(id uint64) string {
+	return filepath.Join(ls.dir, fmt.Sprintf("%08d%s", id, lsmTableExt))
+}
+
+// writeManifest atomically replaces the manifest with the current table list
+func (ls *LSMStorage) writeManifest() error {
+	manifest := lsmManifest{NextID: ls.nextID}
+	for _, table := range ls.tables {
+		manifest.Tables = append(manifest.Tables, table.id)
+	}
+
+	data, err := StructToJSON(manifest)
+	if err != nil {
+		return err
+	}
+
+	return SaveJSONToFile(data, filepath.Join(ls.dir, lsmManifestFile))
+}
+
+func lsmKey(collection, key string) string {
+	return collection + "\x00" + key
+}
+
+func (ls *LSMStorage) Put(collection, key string, v interface{}) error {
+	if err := validateAddress(collection, key); err != nil {
+		return err
+	}
+
+	data, err := StructToJSON(v)
+	if err != nil {
+		return fmt.Errorf("failed to convert struct to JSON: %w", err)
+	}
+
+	return ls.write(lsmKey(collection, key), data, false)
+}
+
+func (ls *LSMStorage) Get(collection, key string, v interface{}) error {
+	if err := validateAddress(collection, key); err != nil {
+		return err
+	}
+
+	data, err := ls.get(lsmKey(collection, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return notFound(collection, key)
+	}
+	if err != nil {
+		return err
+	}
+
+	return decodeDocument(data, filepath.Join(ls.dir, collection, key), v)
+}
+
+func (ls *LSMStorage) Delete(collection, key string) error {
+	if err := validateAddress(collection, key); err != nil {
+		return err
+	}
+
+	if _, err := ls.get(lsmKey(collection, key)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return notFound(collection, key)
+		}
+		return err
+	}
+
+	return ls.write(lsmKey(collection, key), nil, true)
+}
+
+// Scan streams a collection by merging the memtable and the SSTables as it
+// goes, so only one block of each table is held in memory. It sees the
+// collection as it was when the scan started.
+func (ls *LSMStorage) Scan(collection string, fn func(key string, data []byte) error) error {
+	return ls.ScanFrom(collection, "", fn)
+}
+
+func (ls *LSMStorage) ScanFrom(collection, start string, fn func(key string, data []byte) error) error {
+	if err := ValidateName(collection); err != nil {
+		return fmt.Errorf("collection: %w", err)
+	}
+
+	prefix := lsmKey(collection, "")
+	sources, tables, err := ls.snapshot(prefix, prefix+start)
+	if err != nil {
+		return err
+	}
+	defer ls.releaseTables(tables)
+
+	merged := newMergeIterator(sources)
+	for {
+		entry, ok, err := merged.next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		if entry.tombstone {
+			continue
+		}
+
+		if err := fn(entry.key[len(prefix):], entry.value); err != nil {
+			if errors.Is(err, ErrStopScan) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// Sync reports a flush or compaction that failed since the last call. Every
+// write is already in the fsynced WAL before it returns.
+func (ls *LSMStorage) Sync() error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	err := ls.failure
+	ls.failure = nil
+	return err
+}
+
+func (ls *LSMStorage) write(key string, data []byte, tombstone bool) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if ls.closed {
+		return fmt.Errorf("storage is closed")
+	}
+
+	op := WALOpPut
+	if tombstone {
+		op = WALOpDelete
+	}
+	if _, err := ls.wal.Append(op, key, data); err != nil {
+		return err
+	}
+	ls.mem.put(key, data, tombstone)
+
+	// The write is durable in the WAL, so a failed flush only leaves the
+	// memtable for the next write to flush
+	if ls.mem.size >= ls.options.MemtableSize {
+		if err := ls.flushLocked(); err != nil {
+			ls.failure = fmt.Errorf("failed to flush memtable: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (ls *LSMStorage) get(key string) ([]byte, error) {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	if entry, ok := ls.mem.get(key); ok {
+		if entry.tombstone {
+			return nil, fmt.Errorf("failed to open file: %w", os.ErrNotExist)
+		}
+		return entry.value, nil
+	}
+
+	for _, table := range ls.tables {
+		entry, found, err := table.get(key)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+		if entry.tombstone {
+			break
+		}
+		return entry.value, nil
+	}
+
+	return nil, fmt.Errorf("failed to open file: %w", os.ErrNotExist)
+}
+
+// entrySource yields the entries of the memtable or a table in key order
+type entrySource interface {
+	next() (entry sstEntry, ok bool, err error)
+}
+
+// memIterator walks a copy of the memtable's entries
+type memIterator struct {
+	entries []sstEntry
+}
+
+func (it *memIterator) next() (sstEntry, bool, error) {
+	if len(it.entries) == 0 {
+		return sstEntry{}, false, nil
+	}
+	entry := it.entries[0]
+	it.entries = it.entries[1:]
+	return entry, true, nil
+}
+
+// mergeIterator merges sources, newest first, one entry at a time: the
+// smallest key comes next, and the newest source holding it decides its
+// value. Tombstones are returned like any other entry.
+type mergeIterator struct {
+	sources []entrySource
+	heads   []sstEntry
+	live    []bool
+	started bool
+}
+
+func newMergeIterator(sources []entrySource) *mergeIterator {
+	return &mergeIterator{
+		sources: sources,
+		heads:   make([]sstEntry, len(sources)),
+		live:    make([]bool, len(sources)),
+	}
+}
+
+func (m *mergeIterator) next() (entry sstEntry, ok bool, err error) {
+	if !m.started {
+		m.started = true
+		for i, source := range m.sources {
+			if m.heads[i], m.live[i], err = source.next(); err != nil {
+				return sstEntry{}, false, err
+			}
+		}
+	}
+
+	newest := -1
+	for i := range m.sources {
+		if m.live[i] && (newest < 0 || m.heads[i].key < m.heads[newest].key) {
+			newest = i
+		}
+	}
+	if newest < 0 {
+		return sstEntry{}, false, nil
+	}
+
+	entry = m.heads[newest]
+	for i := newest; i < len(m.sources); i++ {
+		if m.live[i] && m.heads[i].key == entry.key {
+			if m.heads[i], m.live[i], err = m.sources[i].next(); err != nil {
+				return sstEntry{}, false, err
+			}
+		}
+	}
+
+	return entry, true, nil
+}
+
+// snapshot returns the sources of the keys starting with prefix, from the
+// first one not less than start, newest first. The memtable entries are
+// copied, since it keeps changing, and the tables are held open until
+// releaseTables, since they never change.
+func (ls *LSMStorage) snapshot(prefix, start string) ([]entrySource, []*sstable, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if ls.closed {
+		return nil, nil, fmt.Errorf("storage is closed")
+	}
+
+	memory := &memIterator{}
+	ls.mem.scan(prefix, start, func(entry sstEntry) {
+		memory.entries = append(memory.entries, entry)
+	})
+
+	sources := []entrySource{memory}
+	tables := append([]*sstable(nil), ls.tables...)
+	for _, table := range tables {
+		table.refs++
+		sources = append(sources, table.iterate(prefix, start))
+	}
+
+	return sources, tables, nil
+}
+
+// releaseTables ends a scan's hold on tables, closing the ones a compaction
+// has replaced in the meantime
+func (ls *LSMStorage) releaseTables(tables []*sstable) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	for _, table := range tables {
+		table.refs--
+		if table.refs == 0 && table.obsolete {
+			table.close()
+			os.Remove(table.path)
+		}
+	}
+}
+
+// Flush writes the memtable to a new SSTable and empties the WAL
+func (ls *LSMStorage) Flush() error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	return ls.flushLocked()
+}
+
+func (ls *LSMStorage) flushLocked() error {
+	if ls.mem.len == 0 {
+		return nil
+	}
+
+	id := ls.nextID
+	ls.nextID++
+	path := ls.tablePath(id)
+
+	if err := writeSSTable(path, ls.mem.entries()); err != nil {
+		return err
+	}
+	table, err := openSSTable(id, path)
+	if err != nil {
+		return err
+	}
+
+	ls.tables = append([]*sstable{table}, ls.tables...)
+	if err := ls.writeManifest(); err != nil {
+		ls.tables = ls.tables[1:]
+		table.close()
+		os.Remove(path)
+		return err
+	}
+
+	// The memtable is durable in the new table, so its log can go
+	ls.mem = newMemtable()
+	if err := ls.wal.Truncate(); err != nil {
+		return err
+	}
+
+	ls.triggerCompaction()
+
+	return nil
+}
+
+func (ls *LSMStorage) triggerCompaction() {
+	select {
+	case ls.compactCh <- struct{}{}:
+	default:
+	}
+}
+
+func (ls *LSMStorage) compactLoop() {
+	defer ls.wg.Done()
+
+	for {
+		select {
+		case <-ls.done:
+			return
+		case <-ls.compactCh:
+			// Keep compacting until no tier is over the threshold
+			for {
+				compacted, err := ls.compactOnce()
+				if err != nil {
+					ls.mu.Lock()
+					ls.failure = fmt.Errorf("failed to compact SSTables: %w", err)
+					ls.mu.Unlock()
+				}
+				if err != nil || !compacted {
+					break
+				}
+			}
+		}
+	}
+}
+
+// pickCompaction finds the first run of adjacent tables with similar sizes
+// that is long enough to compact. Only adjacent tables are merged, so the
+// output can take their place without reordering newer and older data.
+func (ls *LSMStorage) pickCompaction() (start, end int) {
+	threshold := ls.options.CompactionThreshold
+
+	for start = 0; start < len(ls.tables); start++ {
+		end = start + 1
+		for end < len(ls.tables) && similarSize(ls.tables[start].size, ls.tables[end].size) {
+			end++
+		}
+		if end-start >= threshold {
+			return start, end
+		}
+	}
+
+	return 0, 0
+}
+
+func similarSize(a, b int64) bool {
+	if a > b {
+		a, b = b, a
+	}
+	return b <= a*4
+}
+
+// compactOnce merges one run of tables into a single table, streaming the
+// inputs block by block into the output. The merge itself runs without
+// holding the lock because SSTables are immutable.
+func (ls *LSMStorage) compactOnce() (bool, error) {
+	ls.mu.Lock()
+	if ls.closed {
+		ls.mu.Unlock()
+		return false, nil
+	}
+	start, end := ls.pickCompaction()
+	if end-start == 0 {
+		ls.mu.Unlock()
+		return false, nil
+	}
+	inputs := append([]*sstable(nil), ls.tables[start:end]...)
+	// Tombstones can only be dropped when nothing older could hold the key
+	dropTombstones := end == len(ls.tables)
+	id := ls.nextID
+	ls.nextID++
+	ls.mu.Unlock()
+
+	sources := make([]entrySource, len(inputs))
+	keys := 0
+	for i, table := range inputs {
+		sources[i] = table.iterate("", "")
+		keys += int(table.count)
+	}
+
+	path := ls.tablePath(id)
+	writer, err := createSSTable(path, keys)
+	if err != nil {
+		return false, err
+	}
+
+	merged := newMergeIterator(sources)
+	for {
+		entry, ok, err := merged.next()
+		if err != nil {
+			writer.abort()
+			return false, err
+		}
+		if !ok {
+			break
+		}
+		if entry.tombstone && dropTombstones {
+			continue
+		}
+		if err := writer.add(entry); err != nil {
+			writer.abort()
+			return false, err
+		}
+	}
+	if err := writer.finish(); err != nil {
+		return false, err
+	}
+
+	output, err := openSSTable(id, path)
+	if err != nil {
+		return false, err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	// Flushes only add tables at the front, so the inputs are still adjacent
+	offset := 0
+	for offset < len(ls.tables) && ls.tables[offset] != inputs[0] {
+		offset++
+	}
+
+	tables := append([]*sstable(nil), ls.tables[:offset]...)
+	tables = append(tables, output)
+	tables = append(tables, ls.tables[offset+len(inputs):]...)
+	previous := ls.tables
+	ls.tables = tables
+
+	if err := ls.writeManifest(); err != nil {
+		ls.tables = previous
+		output.close()
+		os.Remove(path)
+		return false, err
+	}
+
+	// Tables still being scanned are removed when the last scan ends
+	for _, table := range inputs {
+		table.obsolete = true
+		if table.refs == 0 {
+			table.close()
+			os.Remove(table.path)
+		}
+	}
+
+	return true, nil
+}
+
+// TableCount returns the number of live SSTables
+func (ls *LSMStorage) TableCount() int {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	return len(ls.tables)
+}
+
+// Close stops the compactor, flushes the memtable and closes every file. It
+// reports a failed flush or compaction that Sync has not.
+func (ls *LSMStorage) Close() error {
+	ls.mu.Lock()
+	if ls.closed {
+		ls.mu.Unlock()
+		return nil
+	}
+	err := ls.flushLocked()
+	ls.closed = true
+	ls.mu.Unlock()
+
+	close(ls.done)
+	ls.wg.Wait()
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if err == nil {
+		err = ls.failure
+	}
+
+	ls.closeTables()
+	if walErr := ls.wal.Close(); err == nil {
+		err = walErr
+	}
+
+	return err
+}
+
+func (ls *LSMStorage) closeTables() {
+	for _, table := range ls.tables {
+		table.close()
+	}
+	ls.tables = nil
+}
+
+// memtable is a skip list of the most recent writes, kept in key order
+type memtable struct {
+	head  *memNode
+	level int
+	len   int
+	size  int
+	rng   *rand.Rand
+}
+
+const memtableMaxLevel = 16
+
+type memNode struct {
+	entry sstEntry
+	next  [memtableMaxLevel]*memNode
+}
+
+func newMemtable() *memtable {
+	return &memtable{
+		head:  &memNode{},
+		level: 1,
+		rng:   rand.New(rand.NewSource(1)),
+	}
+}
+
+func (m *memtable) randomLevel() int {
+	level := 1
+	for level < memtableMaxLevel && m.rng.Intn(4) == 0 {
+		level++
+	}
+	return level
+}
+
+func (m *memtable) put(key string, value []byte, tombstone bool) {
+	var update [memtableMaxLevel]*memNode
+	node := m.head
+	for i := m.level - 1; i >= 0; i-- {
+		for node.next[i] != nil && node.next[i].entry.key < key {
+			node = node.next[i]
+		}
+		update[i] = node
+	}
+
+	entry := sstEntry{key: key, value: value, tombstone: tombstone}
+
+	if next := node.next[0]; next != nil && next.entry.key == key {
+		m.size += len(value) - len(next.entry.value)
+		next.entry = entry
+		return
+	}
+
+	level := m.randomLevel()
+	if level > m.level {
+		for i := m.level; i < level; i++ {
+			update[i] = m.head
+		}
+		m.level = level
+	}
+
+	newNode := &memNode{entry: entry}
+	for i := 0; i < level; i++ {
+		newNode.next[i] = update[i].next[i]
+		update[i].next[i] = newNode
+	}
+
+	m.len++
+	m.size += len(key) + len(value)
+}
+
+func (m *memtable) get(key string) (sstEntry, bool) {
+	node := m.head
+	for i := m.level - 1; i >= 0; i-- {
+		for node.next[i] != nil && node.next[i].entry.key < key {
+			node = node.next[i]
+		}
+	}
+
+	if next := node.next[0]; next != nil && next.entry.key == key {
+		return next.entry, true
+	}
+	return sstEntry{}, false
+}
+
+func (m *memtable) scan(prefix, start string, fn func(entry sstEntry)) {
+	if start < prefix {
+		start = prefix
+	}
+
+	node := m.head
+	for i := m.level - 1; i >= 0; i-- {
+		for node.next[i] != nil && node.next[i].entry.key < start {
+			node = node.next[i]
+		}
+	}
+
+	for node = node.next[0]; node != nil && strings.HasPrefix(node.entry.key, prefix); node = node.next[0] {
+		fn(node.entry)
+	}
+}
+
+func (m *memtable) entries() []sstEntry {
+	entries := make([]sstEntry, 0, m.len)
+	for node := m.head.next[0]; node != nil; node = node.next[0] {
+		entries = append(entries, node.entry)
+	}
+	return entries
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// MemoryStorage keeps every document in memory. It never touches the disk,
+// which makes it suitable for tests and ephemeral caches. Documents are
+// stored as JSON, so values read back have the same types as with the
+// on-disk engines.
+type MemoryStorage struct {
+	mu          sync.RWMutex
+	collections map[string]map[string][]byte
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{collections: make(map[string]map[string][]byte)}
+}
+
+func (ms *MemoryStorage) Put(collection, key string, v interface{}) error {
+	if err := validateAddress(collection, key); err != nil {
+		return err
+	}
+
+	data, err := StructToJSON(v)
+	if err != nil {
+		return fmt.Errorf("failed to convert struct to JSON: %w", err)
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	docs, exists := ms.collections[collection]
+	if !exists {
+		docs = make(map[string][]byte)
+		ms.collections[collection] = docs
+	}
+	docs[key] = data
+
+	return nil
+}
+
+func (ms *MemoryStorage) Get(collection, key string, v interface{}) error {
+	ms.mu.RLock()
+	data, exists := ms.collections[collection][key]
+	ms.mu.RUnlock()
+
+	if !exists {
+		return notFound(collection, key)
+	}
+
+	return JSONToStruct(data, v)
+}
+
+func (ms *MemoryStorage) Delete(collection, key string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, exists := ms.collections[collection][key]; !exists {
+		return notFound(collection, key)
+	}
+	delete(ms.collections[collection], key)
+
+	return nil
+}
+
+// Scan iterates over a snapshot of the collection, so fn may modify the
+// collection while the scan is running
+func (ms *MemoryStorage) Scan(collection string, fn func(key string, data []byte) error) error {
+	return ms.ScanFrom(collection, "", fn)
+}
+
+func (ms *MemoryStorage) ScanFrom(collection, start string, fn func(key string, data []byte) error) error {
+	ms.mu.RLock()
+	docs := ms.collections[collection]
+	keys := make([]string, 0, len(docs))
+	values := make(map[string][]byte)
+	for key, data := range docs {
+		if key >= start {
+			keys = append(keys, key)
+			values[key] = data
+		}
+	}
+	ms.mu.RUnlock()
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := fn(key, values[key]); err != nil {
+			if errors.Is(err, ErrStopScan) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ms *MemoryStorage) Sync() error {
+	return nil
+}
+
+func (ms *MemoryStorage) Close() error {
+	return nil
+}
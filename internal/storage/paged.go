@@ -0,0 +1,964 @@
+package storage
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// PagedStorage keeps every document of a collection in a single paged data
+// file instead of one file per document. The collection "users" lives in
+// "<root>/collections/users/data.pages"; reserved collections such as
+// "_schemas" live in "<root>/schemas/data.pages".
+//
+// Data files are made of fixed-size slotted pages. Small documents are stored
+// inline in a data page, larger ones spill into a chain of overflow pages.
+// Every change is logged as full page images to a write-ahead log next to the
+// data file, so a crash never leaves a half-written page behind.
+type PagedStorage struct {
+	mu         sync.Mutex
+	root       string
+	cachePages int
+	files      map[string]*pagedFile
+}
+
+const (
+	PagedDataFile = "data.pages"
+
+	pageSize       = 4096
+	pageHeaderSize = 16
+	slotSize       = 4
+
+	// Cells larger than this have their value moved to overflow pages
+	maxInlineCell = pageSize / 4
+	maxPagedKey   = 512
+
+	defaultCachePages = 256
+
+	pagedMagic              = "NAPPAGE1"
+	pagedWALCheckpointSize  = 4 << 20
+	overflowCellPayloadSize = 8
+)
+
+// WALOpCommit marks the end of a batch of page images that must be applied
+// together. Only the paged engine logs batches.
+const WALOpCommit WALOp = 3
+
+const (
+	pageTypeFree     byte = 0
+	pageTypeMeta     byte = 1
+	pageTypeData     byte = 2
+	pageTypeOverflow byte = 3
+)
+
+const (
+	cellInline   byte = 0
+	cellOverflow byte = 1
+)
+
+// NewPagedStorage returns a PagedStorage rooted at root that caches up to
+// cachePages pages per data file. A non-positive value selects the default.
+func NewPagedStorage(root string, cachePages int) *PagedStorage {
+	if cachePages <= 0 {
+		cachePages = defaultCachePages
+	}
+
+	return &PagedStorage{
+		root:       root,
+		cachePages: cachePages,
+		files:      make(map[string]*pagedFile),
+	}
+}
+
+func (ps *PagedStorage) collectionDir(collection string) string {
+	if IsSystemCollection(collection) {
+		return filepath.Join(ps.root, collection[1:])
+	}
+	return filepath.Join(ps.root, "collections", collection)
+}
+
+func (ps *PagedStorage) Put(collection, key string, v interface{}) error {
+	if err := validateAddress(collection, key); err != nil {
+		return err
+	}
+
+	data, err := StructToJSON(v)
+	if err != nil {
+		return fmt.Errorf("failed to convert struct to JSON: %w", err)
+	}
+
+	pf, err := ps.fileFor(collection, true)
+	if err != nil {
+		return err
+	}
+
+	return pf.put(key, data)
+}
+
+func (ps *PagedStorage) Get(collection, key string, v interface{}) error {
+	if err := validateAddress(collection, key); err != nil {
+		return err
+	}
+
+	pf, err := ps.fileFor(collection, false)
+	if errors.Is(err, os.ErrNotExist) {
+		return notFound(collection, key)
+	}
+	if err != nil {
+		return err
+	}
+
+	data, err := pf.get(key)
+	if errors.Is(err, os.ErrNotExist) {
+		return notFound(collection, key)
+	}
+	if err != nil {
+		return err
+	}
+
+	return decodeDocument(data, pf.path+"#"+key, v)
+}
+
+func (ps *PagedStorage) Delete(collection, key string) error {
+	if err := validateAddress(collection, key); err != nil {
+		return err
+	}
+
+	pf, err := ps.fileFor(collection, false)
+	if errors.Is(err, os.ErrNotExist) {
+		return notFound(collection, key)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = pf.delete(key)
+	if errors.Is(err, os.ErrNotExist) {
+		return notFound(collection, key)
+	}
+
+	return err
+}
+
+func (ps *PagedStorage) Scan(collection string, fn func(key string, data []byte) error) error {
+	return ps.ScanFrom(collection, "", fn)
+}
+
+func (ps *PagedStorage) ScanFrom(collection, start string, fn func(key string, data []byte) error) error {
+	if err := ValidateName(collection); err != nil {
+		return fmt.Errorf("collection: %w", err)
+	}
+
+	pf, err := ps.fileFor(collection, false)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	keys, err := pf.listKeys()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys[sort.SearchStrings(keys, start):] {
+		data, err := pf.get(key)
+		if errors.Is(err, os.ErrNotExist) {
+			// Deleted since the keys were listed
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := fn(key, data); err != nil {
+			if errors.Is(err, ErrStopScan) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Sync is a no-op: every change is committed and fsynced before it returns
+func (ps *PagedStorage) Sync() error {
+	return nil
+}
+
+// Close closes every open data file
+func (ps *PagedStorage) Close() error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	var firstErr error
+	for path, pf := range ps.files {
+		if err := pf.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(ps.files, path)
+	}
+
+	return firstErr
+}
+
+func (ps *PagedStorage) fileFor(collection string, create bool) (*pagedFile, error) {
+	path := filepath.Join(ps.collectionDir(collection), PagedDataFile)
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if pf, ok := ps.files[path]; ok {
+		return pf, nil
+	}
+
+	if !create {
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("failed to open file: %w", err)
+		}
+	}
+
+	pf, err := openPagedFile(path, ps.cachePages)
+	if err != nil {
+		return nil, err
+	}
+	ps.files[path] = pf
+
+	return pf, nil
+}
+
+// slotRef locates a cell inside a data file
+type slotRef struct {
+	page uint32
+	slot uint16
+}
+
+type pagedFile struct {
+	mu        sync.Mutex
+	path      string
+	file      *os.File
+	wal       *WAL
+	pageCount uint32
+	cache     *pageCache
+	dirty     map[uint32][]byte
+	// freeSpace is the free-space map: contiguous free bytes per data page,
+	// or -1 for pages that can't hold cells
+	freeSpace []int
+	freePages []uint32
+	keys      map[string]slotRef
+	// failed is set once the in-memory state can no longer be trusted to
+	// match the data file and WAL. Every operation fails until the file is
+	// reopened, which recovers it from the WAL.
+	failed error
+}
+
+func openPagedFile(path string, cachePages int) (*pagedFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open data file: %w", err)
+	}
+
+	wal, err := OpenWAL(path + ".wal")
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	pf := &pagedFile{
+		path:  path,
+		file:  file,
+		wal:   wal,
+		cache: newPageCache(cachePages),
+		dirty: make(map[uint32][]byte),
+	}
+
+	// Don't go through close here: it would empty a WAL that failed to replay
+	if err := pf.recover(); err != nil {
+		wal.Close()
+		file.Close()
+		return nil, err
+	}
+
+	if err := pf.load(); err != nil {
+		wal.Close()
+		file.Close()
+		return nil, err
+	}
+
+	return pf, nil
+}
+
+// recover writes back the page images of every committed batch in the WAL
+func (pf *pagedFile) recover() error {
+	pending := make(map[uint32][]byte)
+	committed := make(map[uint32][]byte)
+
+	err := pf.wal.Replay(func(entry WALEntry) error {
+		switch entry.Op {
+		case WALOpPut:
+			id, err := strconv.ParseUint(entry.Key, 10, 32)
+			if err != nil || len(entry.Data) != pageSize {
+				return fmt.Errorf("invalid page image for page %q", entry.Key)
+			}
+			pending[uint32(id)] = entry.Data
+		case WALOpCommit:
+			for id, data := range pending {
+				committed[id] = data
+			}
+			pending = make(map[uint32][]byte)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for id, data := range committed {
+		if _, err := pf.file.WriteAt(data, int64(id)*pageSize); err != nil {
+			return fmt.Errorf("failed to recover page %d: %w", id, err)
+		}
+	}
+	if err := pf.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync data file: %w", err)
+	}
+
+	return pf.wal.Truncate()
+}
+
+// load rebuilds the key directory and free-space map by scanning every page
+func (pf *pagedFile) load() error {
+	info, err := pf.file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat data file: %w", err)
+	}
+
+	pf.pageCount = uint32(info.Size() / pageSize)
+	pf.freeSpace = make([]int, pf.pageCount)
+	pf.freePages = nil
+	pf.keys = make(map[string]slotRef)
+	pf.cache.clear()
+
+	if pf.pageCount == 0 {
+		_, meta := pf.allocPage(pageTypeMeta)
+		copy(meta[pageHeaderSize:], pagedMagic)
+		return pf.commit()
+	}
+
+	meta, err := pf.readPage(0)
+	if err != nil {
+		return err
+	}
+	if meta[0] != pageTypeMeta || string(meta[pageHeaderSize:pageHeaderSize+len(pagedMagic)]) != pagedMagic {
+		return &CorruptionError{Path: pf.path, Reason: "not a paged data file"}
+	}
+	pf.freeSpace[0] = -1
+
+	for id := uint32(1); id < pf.pageCount; id++ {
+		page, err := pf.readPage(id)
+		if err != nil {
+			return err
+		}
+
+		switch page[0] {
+		case pageTypeFree:
+			pf.freeSpace[id] = -1
+			pf.freePages = append(pf.freePages, id)
+		case pageTypeData:
+			pf.freeSpace[id] = pageFree(page)
+			for slot := uint16(0); slot < pageSlotCount(page); slot++ {
+				cell := pageCell(page, slot)
+				if cell == nil {
+					continue
+				}
+				pf.keys[cellKey(cell)] = slotRef{page: id, slot: slot}
+			}
+		default:
+			pf.freeSpace[id] = -1
+		}
+	}
+
+	return nil
+}
+
+// usable reports why the file cannot be used, if it cannot
+func (pf *pagedFile) usable() error {
+	if pf.failed != nil {
+		return fmt.Errorf("data file %s must be reopened: %w", pf.path, pf.failed)
+	}
+	return nil
+}
+
+func (pf *pagedFile) listKeys() ([]string, error) {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+
+	if err := pf.usable(); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(pf.keys))
+	for key := range pf.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+func (pf *pagedFile) get(key string) ([]byte, error) {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+
+	if err := pf.usable(); err != nil {
+		return nil, err
+	}
+
+	ref, ok := pf.keys[key]
+	if !ok {
+		return nil, fmt.Errorf("failed to open file: %w", os.ErrNotExist)
+	}
+
+	page, err := pf.readPage(ref.page)
+	if err != nil {
+		return nil, err
+	}
+	cell := pageCell(page, ref.slot)
+	if cell == nil {
+		return nil, &CorruptionError{Path: pf.path, Reason: fmt.Sprintf("missing cell for key %s", key)}
+	}
+
+	body := cell[3+len(cellKey(cell)):]
+	if cell[0] == cellInline {
+		return append([]byte(nil), body...), nil
+	}
+
+	return pf.readOverflow(binary.LittleEndian.Uint32(body[4:8]), int(binary.LittleEndian.Uint32(body[0:4])))
+}
+
+func (pf *pagedFile) put(key string, data []byte) error {
+	if len(key) == 0 || len(key) > maxPagedKey {
+		return fmt.Errorf("invalid key length %d", len(key))
+	}
+
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+
+	if err := pf.usable(); err != nil {
+		return err
+	}
+
+	err := pf.putLocked(key, data)
+	if err == nil {
+		err = pf.commit()
+	}
+	if err != nil {
+		return pf.rollback(err)
+	}
+
+	return nil
+}
+
+func (pf *pagedFile) delete(key string) error {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+
+	if err := pf.usable(); err != nil {
+		return err
+	}
+	if _, exists := pf.keys[key]; !exists {
+		return fmt.Errorf("failed to open file: %w", os.ErrNotExist)
+	}
+
+	err := pf.deleteLocked(key)
+	if err == nil {
+		err = pf.commit()
+	}
+	if err != nil {
+		return pf.rollback(err)
+	}
+
+	return nil
+}
+
+func (pf *pagedFile) putLocked(key string, data []byte) error {
+	if _, exists := pf.keys[key]; exists {
+		if err := pf.deleteLocked(key); err != nil {
+			return err
+		}
+	}
+
+	var cell []byte
+	if 3+len(key)+len(data) <= maxInlineCell {
+		cell = makeCell(cellInline, key, data)
+	} else {
+		first, err := pf.writeOverflow(data)
+		if err != nil {
+			return err
+		}
+		pointer := make([]byte, overflowCellPayloadSize)
+		binary.LittleEndian.PutUint32(pointer[0:4], uint32(len(data)))
+		binary.LittleEndian.PutUint32(pointer[4:8], first)
+		cell = makeCell(cellOverflow, key, pointer)
+	}
+
+	ref, err := pf.insertCell(cell)
+	if err != nil {
+		return err
+	}
+	pf.keys[key] = ref
+
+	return nil
+}
+
+func (pf *pagedFile) deleteLocked(key string) error {
+	ref := pf.keys[key]
+
+	page, err := pf.writablePage(ref.page)
+	if err != nil {
+		return err
+	}
+
+	cell := pageCell(page, ref.slot)
+	if cell != nil && cell[0] == cellOverflow {
+		body := cell[3+len(cellKey(cell)):]
+		if err := pf.freeOverflow(binary.LittleEndian.Uint32(body[4:8])); err != nil {
+			return err
+		}
+	}
+
+	removeCell(page, ref.slot)
+	pf.freeSpace[ref.page] = pageFree(page)
+	delete(pf.keys, key)
+
+	return nil
+}
+
+// insertCell stores a cell in the first data page with room for it,
+// allocating a new page when none has enough space
+func (pf *pagedFile) insertCell(cell []byte) (slotRef, error) {
+	need := len(cell) + slotSize
+
+	for id := len(pf.freeSpace) - 1; id > 0; id-- {
+		if pf.freeSpace[id] < need {
+			continue
+		}
+
+		page, err := pf.writablePage(uint32(id))
+		if err != nil {
+			return slotRef{}, err
+		}
+		slot := insertIntoPage(page, cell)
+		pf.freeSpace[id] = pageFree(page)
+
+		return slotRef{page: uint32(id), slot: slot}, nil
+	}
+
+	id, page := pf.allocPage(pageTypeData)
+	slot := insertIntoPage(page, cell)
+	pf.freeSpace[id] = pageFree(page)
+
+	return slotRef{page: id, slot: slot}, nil
+}
+
+func (pf *pagedFile) writeOverflow(data []byte) (uint32, error) {
+	capacity := pageSize - pageHeaderSize
+	var first uint32
+	var prev []byte
+
+	for offset := 0; offset < len(data); offset += capacity {
+		end := offset + capacity
+		if end > len(data) {
+			end = len(data)
+		}
+
+		id, page := pf.allocPage(pageTypeOverflow)
+		binary.LittleEndian.PutUint16(page[4:6], uint16(end-offset))
+		copy(page[pageHeaderSize:], data[offset:end])
+
+		if prev == nil {
+			first = id
+		} else {
+			binary.LittleEndian.PutUint32(prev[8:12], id)
+		}
+		prev = page
+	}
+
+	return first, nil
+}
+
+func (pf *pagedFile) readOverflow(id uint32, length int) ([]byte, error) {
+	data := make([]byte, 0, length)
+
+	for id != 0 && len(data) < length {
+		page, err := pf.readPage(id)
+		if err != nil {
+			return nil, err
+		}
+		if page[0] != pageTypeOverflow {
+			return nil, &CorruptionError{Path: pf.path, Reason: fmt.Sprintf("page %d is not an overflow page", id)}
+		}
+
+		n := int(binary.LittleEndian.Uint16(page[4:6]))
+		data = append(data, page[pageHeaderSize:pageHeaderSize+n]...)
+		id = binary.LittleEndian.Uint32(page[8:12])
+	}
+
+	if len(data) != length {
+		return nil, &CorruptionError{Path: pf.path, Reason: "truncated overflow chain"}
+	}
+
+	return data, nil
+}
+
+func (pf *pagedFile) freeOverflow(id uint32) error {
+	for id != 0 {
+		page, err := pf.writablePage(id)
+		if err != nil {
+			return err
+		}
+
+		next := binary.LittleEndian.Uint32(page[8:12])
+		clear(page)
+		page[0] = pageTypeFree
+		pf.freeSpace[id] = -1
+		pf.freePages = append(pf.freePages, id)
+		id = next
+	}
+
+	return nil
+}
+
+// allocPage returns a zeroed dirty page, reusing a free page when possible
+func (pf *pagedFile) allocPage(pageType byte) (uint32, []byte) {
+	var id uint32
+	if n := len(pf.freePages); n > 0 {
+		id = pf.freePages[n-1]
+		pf.freePages = pf.freePages[:n-1]
+	} else {
+		id = pf.pageCount
+		pf.pageCount++
+		pf.freeSpace = append(pf.freeSpace, -1)
+	}
+
+	page := make([]byte, pageSize)
+	page[0] = pageType
+	if pageType == pageTypeData {
+		binary.LittleEndian.PutUint16(page[4:6], pageHeaderSize)
+		binary.LittleEndian.PutUint16(page[6:8], pageSize)
+	}
+	pf.dirty[id] = page
+
+	return id, page
+}
+
+func (pf *pagedFile) readPage(id uint32) ([]byte, error) {
+	if page, ok := pf.dirty[id]; ok {
+		return page, nil
+	}
+	if page, ok := pf.cache.get(id); ok {
+		return page, nil
+	}
+
+	page := make([]byte, pageSize)
+	if _, err := pf.file.ReadAt(page, int64(id)*pageSize); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read page %d: %w", id, err)
+	}
+
+	expected := binary.LittleEndian.Uint32(page[12:16])
+	binary.LittleEndian.PutUint32(page[12:16], 0)
+	if crc32.Checksum(page, checksumTable) != expected {
+		return nil, &CorruptionError{Path: pf.path, Reason: fmt.Sprintf("page %d checksum mismatch", id)}
+	}
+
+	pf.cache.put(id, page)
+
+	return page, nil
+}
+
+// writablePage returns a copy of the page that is tracked as dirty, leaving
+// the cached image untouched until the change commits
+func (pf *pagedFile) writablePage(id uint32) ([]byte, error) {
+	if page, ok := pf.dirty[id]; ok {
+		return page, nil
+	}
+
+	page, err := pf.readPage(id)
+	if err != nil {
+		return nil, err
+	}
+
+	page = append([]byte(nil), page...)
+	pf.dirty[id] = page
+
+	return page, nil
+}
+
+// commit logs every dirty page to the WAL, writes them to the data file and
+// fsyncs it
+func (pf *pagedFile) commit() error {
+	if len(pf.dirty) == 0 {
+		return nil
+	}
+
+	ids := make([]uint32, 0, len(pf.dirty))
+	for id := range pf.dirty {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	entries := make([]WALEntry, 0, len(ids)+1)
+	for _, id := range ids {
+		page := pf.dirty[id]
+		binary.LittleEndian.PutUint32(page[12:16], 0)
+		binary.LittleEndian.PutUint32(page[12:16], crc32.Checksum(page, checksumTable))
+		entries = append(entries, WALEntry{Op: WALOpPut, Key: strconv.FormatUint(uint64(id), 10), Data: page})
+	}
+	entries = append(entries, WALEntry{Op: WALOpCommit})
+
+	if _, err := pf.wal.AppendBatch(entries); err != nil {
+		return err
+	}
+
+	// The batch is committed now: the next open replays it whatever happens
+	// to the data file. If it cannot be written, the pages in memory are
+	// neither the old nor the new state of the file.
+	for _, id := range ids {
+		page := pf.dirty[id]
+		if _, err := pf.file.WriteAt(page, int64(id)*pageSize); err != nil {
+			pf.failed = fmt.Errorf("failed to write page %d: %w", id, err)
+			return pf.failed
+		}
+	}
+	if err := pf.file.Sync(); err != nil {
+		pf.failed = fmt.Errorf("failed to sync data file: %w", err)
+		return pf.failed
+	}
+
+	for _, id := range ids {
+		page := pf.dirty[id]
+		binary.LittleEndian.PutUint32(page[12:16], 0)
+		pf.cache.put(id, page)
+		delete(pf.dirty, id)
+	}
+
+	if pf.wal.Size() >= pagedWALCheckpointSize {
+		return pf.wal.Truncate()
+	}
+
+	return nil
+}
+
+// rollback throws away the uncommitted changes of an operation that failed
+// with cause and rebuilds the in-memory state from the data file. A file
+// that cannot be rebuilt fails, rather than serving a half-loaded state.
+func (pf *pagedFile) rollback(cause error) error {
+	pf.dirty = make(map[uint32][]byte)
+	if pf.failed != nil {
+		return cause
+	}
+
+	if err := pf.load(); err != nil {
+		pf.failed = fmt.Errorf("failed to reload after an error: %w", err)
+		return fmt.Errorf("%w; %v", cause, pf.failed)
+	}
+	return cause
+}
+
+func (pf *pagedFile) close() error {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+
+	// Every committed page is already synced to the data file, unless the
+	// file failed, and then the WAL is needed to recover it
+	var walErr error
+	if pf.failed == nil {
+		walErr = pf.wal.Truncate()
+	}
+	if err := pf.wal.Close(); err != nil && walErr == nil {
+		walErr = err
+	}
+	if err := pf.file.Close(); err != nil {
+		return err
+	}
+
+	return walErr
+}
+
+// Page layout: type (1) | unused (1) | slot count (2) | free start (2) |
+// free end (2) | next page (4) | checksum (4) | slots... | free | cells.
+// Overflow pages reuse the free start field for the length of their data.
+
+func pageSlotCount(page []byte) uint16 {
+	return binary.LittleEndian.Uint16(page[2:4])
+}
+
+func pageFree(page []byte) int {
+	return int(binary.LittleEndian.Uint16(page[6:8])) - int(binary.LittleEndian.Uint16(page[4:6]))
+}
+
+func slotAt(page []byte, slot uint16) (offset, length uint16) {
+	pos := pageHeaderSize + int(slot)*slotSize
+	return binary.LittleEndian.Uint16(page[pos : pos+2]), binary.LittleEndian.Uint16(page[pos+2 : pos+4])
+}
+
+func setSlot(page []byte, slot, offset, length uint16) {
+	pos := pageHeaderSize + int(slot)*slotSize
+	binary.LittleEndian.PutUint16(page[pos:pos+2], offset)
+	binary.LittleEndian.PutUint16(page[pos+2:pos+4], length)
+}
+
+// pageCell returns the cell in a slot, or nil if the slot is empty
+func pageCell(page []byte, slot uint16) []byte {
+	if slot >= pageSlotCount(page) {
+		return nil
+	}
+
+	offset, length := slotAt(page, slot)
+	if length == 0 || int(offset)+int(length) > pageSize {
+		return nil
+	}
+
+	return page[offset : offset+length]
+}
+
+// Cell layout: kind (1) | key length (2) | key | value or overflow pointer
+
+func makeCell(kind byte, key string, body []byte) []byte {
+	cell := make([]byte, 3+len(key)+len(body))
+	cell[0] = kind
+	binary.LittleEndian.PutUint16(cell[1:3], uint16(len(key)))
+	copy(cell[3:], key)
+	copy(cell[3+len(key):], body)
+	return cell
+}
+
+func cellKey(cell []byte) string {
+	keyLen := int(binary.LittleEndian.Uint16(cell[1:3]))
+	return string(cell[3 : 3+keyLen])
+}
+
+// insertIntoPage writes a cell at the end of the free region, reusing an
+// empty slot when there is one. The caller must have checked for space.
+func insertIntoPage(page []byte, cell []byte) uint16 {
+	count := pageSlotCount(page)
+	slot := count
+	for i := uint16(0); i < count; i++ {
+		if _, length := slotAt(page, i); length == 0 {
+			slot = i
+			break
+		}
+	}
+
+	if slot == count {
+		count++
+		binary.LittleEndian.PutUint16(page[2:4], count)
+		binary.LittleEndian.PutUint16(page[4:6], uint16(pageHeaderSize+int(count)*slotSize))
+	}
+
+	freeEnd := binary.LittleEndian.Uint16(page[6:8]) - uint16(len(cell))
+	copy(page[freeEnd:], cell)
+	binary.LittleEndian.PutUint16(page[6:8], freeEnd)
+	setSlot(page, slot, freeEnd, uint16(len(cell)))
+
+	return slot
+}
+
+// removeCell empties a slot and compacts the remaining cells so the page's
+// free space stays contiguous. Slot numbers of other cells don't change.
+func removeCell(page []byte, slot uint16) {
+	setSlot(page, slot, 0, 0)
+
+	count := pageSlotCount(page)
+	for count > 0 {
+		if _, length := slotAt(page, count-1); length != 0 {
+			break
+		}
+		count--
+	}
+
+	cells := make([][]byte, count)
+	for i := uint16(0); i < count; i++ {
+		if cell := pageCell(page, i); cell != nil {
+			cells[i] = append([]byte(nil), cell...)
+		}
+	}
+
+	freeEnd := uint16(pageSize)
+	for i, cell := range cells {
+		if cell == nil {
+			setSlot(page, uint16(i), 0, 0)
+			continue
+		}
+		freeEnd -= uint16(len(cell))
+		copy(page[freeEnd:], cell)
+		setSlot(page, uint16(i), freeEnd, uint16(len(cell)))
+	}
+
+	binary.LittleEndian.PutUint16(page[2:4], count)
+	binary.LittleEndian.PutUint16(page[4:6], uint16(pageHeaderSize+int(count)*slotSize))
+	binary.LittleEndian.PutUint16(page[6:8], freeEnd)
+}
+
+// pageCache is an LRU cache of clean page images
+type pageCache struct {
+	capacity int
+	order    *list.List
+	entries  map[uint32]*list.Element
+}
+
+type cachedPage struct {
+	id   uint32
+	data []byte
+}
+
+func newPageCache(capacity int) *pageCache {
+	return &pageCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[uint32]*list.Element),
+	}
+}
+
+func (c *pageCache) get(id uint32) ([]byte, bool) {
+	elem, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cachedPage).data, true
+}
+
+func (c *pageCache) put(id uint32, data []byte) {
+	if elem, ok := c.entries[id]; ok {
+		elem.Value.(*cachedPage).data = data
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[id] = c.order.PushFront(&cachedPage{id: id, data: data})
+
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedPage).id)
+	}
+}
+
+func (c *pageCache) clear() {
+	c.order.Init()
+	c.entries = make(map[uint32]*list.Element)
+}
@@ -1 +1,250 @@
 package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// WALOp identifies the kind of mutation recorded in a WAL entry
+type WALOp byte
+
+const (
+	WALOpPut    WALOp = 1
+	WALOpDelete WALOp = 2
+)
+
+// Each entry is framed as: length (4 bytes) | crc32 of payload (4 bytes) | payload.
+// The payload holds: sequence (8 bytes) | op (1 byte) | key length (4 bytes) | key | data.
+const (
+	walFrameHeaderSize   = 8
+	walPayloadHeaderSize = 8 + 1 + 4
+	walMaxEntrySize      = 64 << 20
+)
+
+var walTable = crc32.MakeTable(crc32.Castagnoli)
+
+// WALEntry is a single mutation recorded in the write-ahead log. Key is
+// whatever the engine uses to find the data again, such as a page number
+// or a file path relative to its root.
+type WALEntry struct {
+	Seq  uint64
+	Op   WALOp
+	Key  string
+	Data []byte
+}
+
+// WAL is an append-only, checksummed write-ahead log. Every entry is
+// fsynced before Append returns, so a mutation is only applied once it is
+// guaranteed to be recoverable.
+type WAL struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	size int64
+	seq  uint64
+}
+
+// OpenWAL opens the log at path, creating it if needed. Call Replay before
+// appending to recover entries left behind by a previous run.
+func OpenWAL(path string) (*WAL, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create WAL directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open WAL: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat WAL: %w", err)
+	}
+
+	return &WAL{path: path, file: file, size: info.Size()}, nil
+}
+
+// Replay calls fn for every complete entry in the log, in order. Reading
+// stops at the first torn or corrupt entry, and the log is truncated there
+// so later appends never follow garbage.
+func (w *WAL) Replay(fn func(entry WALEntry) error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek WAL: %w", err)
+	}
+
+	reader := bufio.NewReader(w.file)
+	var valid int64
+
+	for {
+		entry, n, err := readWALEntry(reader)
+		if err != nil {
+			// io.EOF is a clean end; anything else is an incomplete entry to discard
+			break
+		}
+
+		if err := fn(entry); err != nil {
+			return fmt.Errorf("failed to replay WAL entry %d: %w", entry.Seq, err)
+		}
+
+		valid += n
+		if entry.Seq > w.seq {
+			w.seq = entry.Seq
+		}
+	}
+
+	if valid != w.size {
+		if err := w.file.Truncate(valid); err != nil {
+			return fmt.Errorf("failed to discard incomplete WAL entries: %w", err)
+		}
+		if err := w.file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync WAL: %w", err)
+		}
+		w.size = valid
+	}
+
+	_, err := w.file.Seek(w.size, io.SeekStart)
+	return err
+}
+
+func readWALEntry(r io.Reader) (WALEntry, int64, error) {
+	var header [walFrameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return WALEntry{}, 0, err
+	}
+
+	length := binary.LittleEndian.Uint32(header[0:4])
+	checksum := binary.LittleEndian.Uint32(header[4:8])
+	if length < walPayloadHeaderSize || length > walMaxEntrySize {
+		return WALEntry{}, 0, errors.New("invalid WAL entry length")
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return WALEntry{}, 0, err
+	}
+	if crc32.Checksum(payload, walTable) != checksum {
+		return WALEntry{}, 0, errors.New("WAL entry checksum mismatch")
+	}
+
+	keyLen := binary.LittleEndian.Uint32(payload[9:13])
+	if walPayloadHeaderSize+int64(keyLen) > int64(length) {
+		return WALEntry{}, 0, errors.New("invalid WAL key length")
+	}
+
+	entry := WALEntry{
+		Seq:  binary.LittleEndian.Uint64(payload[0:8]),
+		Op:   WALOp(payload[8]),
+		Key:  string(payload[walPayloadHeaderSize : walPayloadHeaderSize+keyLen]),
+		Data: payload[walPayloadHeaderSize+keyLen:],
+	}
+
+	return entry, int64(walFrameHeaderSize + length), nil
+}
+
+// Append writes an entry to the end of the log and fsyncs it. The entry's
+// sequence number is returned.
+func (w *WAL) Append(op WALOp, key string, data []byte) (uint64, error) {
+	return w.AppendBatch([]WALEntry{{Op: op, Key: key, Data: data}})
+}
+
+// AppendBatch writes several entries with a single fsync and returns the
+// sequence number of the last one. Replay may still see only a prefix of the
+// batch after a crash, so callers that need all-or-nothing semantics should
+// end the batch with an entry of their own that marks it complete. A batch
+// that fails is removed from the log again.
+func (w *WAL) AppendBatch(entries []WALEntry) (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	seq := w.seq
+	var buf []byte
+
+	for _, entry := range entries {
+		length := walPayloadHeaderSize + len(entry.Key) + len(entry.Data)
+		if length > walMaxEntrySize {
+			return 0, fmt.Errorf("WAL entry too large: %d bytes", length)
+		}
+
+		seq++
+		frame := make([]byte, walFrameHeaderSize+length)
+		payload := frame[walFrameHeaderSize:]
+		binary.LittleEndian.PutUint64(payload[0:8], seq)
+		payload[8] = byte(entry.Op)
+		binary.LittleEndian.PutUint32(payload[9:13], uint32(len(entry.Key)))
+		copy(payload[walPayloadHeaderSize:], entry.Key)
+		copy(payload[walPayloadHeaderSize+len(entry.Key):], entry.Data)
+
+		binary.LittleEndian.PutUint32(frame[0:4], uint32(length))
+		binary.LittleEndian.PutUint32(frame[4:8], crc32.Checksum(payload, walTable))
+
+		buf = append(buf, frame...)
+	}
+
+	if _, err := w.file.Write(buf); err != nil {
+		w.discardTail()
+		return 0, fmt.Errorf("failed to append to WAL: %w", err)
+	}
+	if err := w.file.Sync(); err != nil {
+		// The batch may be in the file without being durable. Drop it so
+		// that the log ends where size says it does.
+		w.discardTail()
+		return 0, fmt.Errorf("failed to sync WAL: %w", err)
+	}
+
+	w.seq = seq
+	w.size += int64(len(buf))
+
+	return seq, nil
+}
+
+// discardTail drops whatever part of a failed batch made it to the file
+func (w *WAL) discardTail() {
+	w.file.Truncate(w.size)
+	w.file.Seek(w.size, io.SeekStart)
+}
+
+// Size returns the current length of the log in bytes
+func (w *WAL) Size() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.size
+}
+
+// Truncate empties the log. Callers must make sure every entry has been
+// applied durably before checkpointing.
+func (w *WAL) Truncate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate WAL: %w", err)
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek WAL: %w", err)
+	}
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync WAL: %w", err)
+	}
+	w.size = 0
+
+	return nil
+}
+
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.file.Close()
+}
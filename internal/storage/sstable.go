@@ -0,0 +1,469 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// SSTable layout:
+//
+//	entries | sparse index | bloom filter | footer
+//
+// Entries are sorted by key: key length (4) | key | kind (1) | value length (4) | value.
+// The sparse index records the offset of every sstIndexInterval-th entry.
+// The footer holds the index offset (8), bloom offset (8), entry count (8),
+// a crc32 of everything before it (4) and the magic string.
+const (
+	sstMagic         = "NAPSST01"
+	sstFooterSize    = 8 + 8 + 8 + 4 + len(sstMagic)
+	sstIndexInterval = 16
+	bloomBitsPerKey  = 10
+	bloomHashes      = 7
+)
+
+const (
+	entryValue     byte = 0
+	entryTombstone byte = 1
+)
+
+type sstEntry struct {
+	key       string
+	value     []byte
+	tombstone bool
+}
+
+type sstIndexEntry struct {
+	key    string
+	offset int64
+}
+
+// sstable is an open, immutable sorted table
+type sstable struct {
+	id          uint64
+	path        string
+	file        *os.File
+	size        int64
+	count       uint64
+	indexOffset int64
+	index       []sstIndexEntry
+	bloom       *bloomFilter
+
+	// refs counts the scans reading the table. A table replaced by a
+	// compaction is only closed once obsolete and unreferenced.
+	refs     int
+	obsolete bool
+}
+
+// sstWriter streams sorted entries into a new table. Only the sparse index
+// and the bloom filter are kept in memory while it writes.
+type sstWriter struct {
+	path   string
+	file   *os.File
+	out    *bufio.Writer
+	crc    hash.Hash32
+	offset int64
+	count  uint64
+	index  []sstIndexEntry
+	bloom  *bloomFilter
+	err    error
+}
+
+// createSSTable starts a table at path. keys is an upper bound on the number
+// of entries, which sizes the bloom filter.
+func createSSTable(path string, keys int) (*sstWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSTable: %w", err)
+	}
+
+	return &sstWriter{
+		path:  path,
+		file:  file,
+		out:   bufio.NewWriter(file),
+		crc:   crc32.New(checksumTable),
+		bloom: newBloomFilter(keys),
+	}, nil
+}
+
+// emit writes part of the body, which the checksum covers
+func (w *sstWriter) emit(data []byte) {
+	if w.err != nil {
+		return
+	}
+	if _, err := w.out.Write(data); err != nil {
+		w.err = fmt.Errorf("failed to write SSTable: %w", err)
+		return
+	}
+	w.crc.Write(data)
+	w.offset += int64(len(data))
+}
+
+func (w *sstWriter) emitUint32(v uint32) {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	w.emit(buf[:])
+}
+
+func (w *sstWriter) emitUint64(v uint64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	w.emit(buf[:])
+}
+
+// add appends an entry, whose key must follow the previous one
+func (w *sstWriter) add(entry sstEntry) error {
+	if w.count%sstIndexInterval == 0 {
+		w.index = append(w.index, sstIndexEntry{key: entry.key, offset: w.offset})
+	}
+	w.bloom.add(entry.key)
+	w.count++
+
+	kind := entryValue
+	if entry.tombstone {
+		kind = entryTombstone
+	}
+	w.emitUint32(uint32(len(entry.key)))
+	w.emit([]byte(entry.key))
+	w.emit([]byte{kind})
+	w.emitUint32(uint32(len(entry.value)))
+	w.emit(entry.value)
+
+	return w.err
+}
+
+// finish writes the index, bloom filter and footer and fsyncs the table. The
+// file is removed if any of it fails.
+func (w *sstWriter) finish() error {
+	indexOffset := w.offset
+	w.emitUint32(uint32(len(w.index)))
+	for _, entry := range w.index {
+		w.emitUint32(uint32(len(entry.key)))
+		w.emit([]byte(entry.key))
+		w.emitUint64(uint64(entry.offset))
+	}
+
+	bloomOffset := w.offset
+	w.emit(w.bloom.bits)
+
+	// The footer follows the checksummed body
+	checksum := w.crc.Sum32()
+	w.emitUint64(uint64(indexOffset))
+	w.emitUint64(uint64(bloomOffset))
+	w.emitUint64(w.count)
+	w.emitUint32(checksum)
+	w.emit([]byte(sstMagic))
+
+	err := w.err
+	if err == nil {
+		if err = w.out.Flush(); err != nil {
+			err = fmt.Errorf("failed to write SSTable: %w", err)
+		}
+	}
+	if err == nil {
+		err = w.file.Sync()
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(w.path)
+	}
+
+	return err
+}
+
+// abort gives up on the table and removes it
+func (w *sstWriter) abort() {
+	w.file.Close()
+	os.Remove(w.path)
+}
+
+// writeSSTable writes sorted entries to path and fsyncs the file
+func writeSSTable(path string, entries []sstEntry) error {
+	writer, err := createSSTable(path, len(entries))
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := writer.add(entry); err != nil {
+			writer.abort()
+			return err
+		}
+	}
+
+	return writer.finish()
+}
+
+// openSSTable opens a table, verifies its checksum and loads its sparse
+// index and bloom filter into memory
+func openSSTable(id uint64, path string) (*sstable, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SSTable: %w", err)
+	}
+
+	table, err := loadSSTable(id, path, file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return table, nil
+}
+
+// loadSSTable reads the footer, index and bloom filter of a table. The
+// entries are only streamed through the checksum, never held in memory.
+func loadSSTable(id uint64, path string, file *os.File) (*sstable, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat SSTable: %w", err)
+	}
+	size := info.Size()
+	if size < int64(sstFooterSize) {
+		return nil, &CorruptionError{Path: path, Reason: "missing SSTable footer"}
+	}
+
+	footer := make([]byte, sstFooterSize)
+	if _, err := file.ReadAt(footer, size-int64(sstFooterSize)); err != nil {
+		return nil, fmt.Errorf("failed to read SSTable: %w", err)
+	}
+	if string(footer[sstFooterSize-len(sstMagic):]) != sstMagic {
+		return nil, &CorruptionError{Path: path, Reason: "missing SSTable footer"}
+	}
+
+	bodySize := size - int64(sstFooterSize)
+	indexOffset := int64(binary.LittleEndian.Uint64(footer[0:8]))
+	bloomOffset := int64(binary.LittleEndian.Uint64(footer[8:16]))
+	count := binary.LittleEndian.Uint64(footer[16:24])
+
+	checksum := crc32.New(checksumTable)
+	if _, err := io.Copy(checksum, io.NewSectionReader(file, 0, bodySize)); err != nil {
+		return nil, fmt.Errorf("failed to read SSTable: %w", err)
+	}
+	if checksum.Sum32() != binary.LittleEndian.Uint32(footer[24:28]) {
+		return nil, &CorruptionError{Path: path, Reason: "SSTable checksum mismatch"}
+	}
+	if indexOffset > bloomOffset || bloomOffset > bodySize {
+		return nil, &CorruptionError{Path: path, Reason: "invalid SSTable footer"}
+	}
+
+	meta := make([]byte, bodySize-indexOffset)
+	if _, err := file.ReadAt(meta, indexOffset); err != nil {
+		return nil, fmt.Errorf("failed to read SSTable: %w", err)
+	}
+
+	reader := bytes.NewReader(meta[:bloomOffset-indexOffset])
+	var indexLen uint32
+	binary.Read(reader, binary.LittleEndian, &indexLen)
+
+	index := make([]sstIndexEntry, 0, indexLen)
+	for i := uint32(0); i < indexLen; i++ {
+		var keyLen uint32
+		if err := binary.Read(reader, binary.LittleEndian, &keyLen); err != nil {
+			return nil, &CorruptionError{Path: path, Reason: "truncated SSTable index"}
+		}
+		key := make([]byte, keyLen)
+		if _, err := io.ReadFull(reader, key); err != nil {
+			return nil, &CorruptionError{Path: path, Reason: "truncated SSTable index"}
+		}
+		var offset uint64
+		if err := binary.Read(reader, binary.LittleEndian, &offset); err != nil {
+			return nil, &CorruptionError{Path: path, Reason: "truncated SSTable index"}
+		}
+		index = append(index, sstIndexEntry{key: string(key), offset: int64(offset)})
+	}
+
+	return &sstable{
+		id:          id,
+		path:        path,
+		file:        file,
+		size:        size,
+		count:       count,
+		indexOffset: indexOffset,
+		index:       index,
+		bloom:       &bloomFilter{bits: append([]byte(nil), meta[bloomOffset-indexOffset:]...)},
+	}, nil
+}
+
+// block returns the entries between two sparse index positions
+func (t *sstable) block(i int) ([]sstEntry, error) {
+	start := t.index[i].offset
+	end := t.indexOffset
+	if i+1 < len(t.index) {
+		end = t.index[i+1].offset
+	}
+
+	data := make([]byte, end-start)
+	if _, err := t.file.ReadAt(data, start); err != nil {
+		return nil, fmt.Errorf("failed to read SSTable block: %w", err)
+	}
+
+	return decodeSSTEntries(data, t.path)
+}
+
+func decodeSSTEntries(data []byte, path string) ([]sstEntry, error) {
+	var entries []sstEntry
+
+	for pos := 0; pos < len(data); {
+		if pos+4 > len(data) {
+			return nil, &CorruptionError{Path: path, Reason: "truncated SSTable entry"}
+		}
+		keyLen := int(binary.LittleEndian.Uint32(data[pos:]))
+		pos += 4
+		if pos+keyLen+5 > len(data) {
+			return nil, &CorruptionError{Path: path, Reason: "truncated SSTable entry"}
+		}
+		key := string(data[pos : pos+keyLen])
+		pos += keyLen
+		kind := data[pos]
+		valueLen := int(binary.LittleEndian.Uint32(data[pos+1:]))
+		pos += 5
+		if pos+valueLen > len(data) {
+			return nil, &CorruptionError{Path: path, Reason: "truncated SSTable entry"}
+		}
+
+		entries = append(entries, sstEntry{
+			key:       key,
+			value:     data[pos : pos+valueLen],
+			tombstone: kind == entryTombstone,
+		})
+		pos += valueLen
+	}
+
+	return entries, nil
+}
+
+// get looks a key up. found reports whether the table has an entry for it,
+// which may be a tombstone.
+func (t *sstable) get(key string) (entry sstEntry, found bool, err error) {
+	if len(t.index) == 0 || !t.bloom.mayContain(key) {
+		return sstEntry{}, false, nil
+	}
+
+	// Find the last block whose first key is <= key
+	i := sort.Search(len(t.index), func(i int) bool { return t.index[i].key > key }) - 1
+	if i < 0 {
+		return sstEntry{}, false, nil
+	}
+
+	entries, err := t.block(i)
+	if err != nil {
+		return sstEntry{}, false, err
+	}
+	for _, entry := range entries {
+		if entry.key == key {
+			return entry, true, nil
+		}
+	}
+
+	return sstEntry{}, false, nil
+}
+
+// sstIterator reads the entries of a table whose keys start with a prefix,
+// from the first key not less than start, in key order, one block at a time
+type sstIterator struct {
+	table   *sstable
+	prefix  string
+	start   string
+	block   int
+	entries []sstEntry
+}
+
+func (t *sstable) iterate(prefix, start string) *sstIterator {
+	if start < prefix {
+		start = prefix
+	}
+	i := sort.Search(len(t.index), func(i int) bool { return t.index[i].key >= start }) - 1
+	if i < 0 {
+		i = 0
+	}
+	return &sstIterator{table: t, prefix: prefix, start: start, block: i}
+}
+
+// next returns the next entry. ok is false once the prefix is exhausted.
+func (it *sstIterator) next() (entry sstEntry, ok bool, err error) {
+	for {
+		for len(it.entries) > 0 {
+			entry := it.entries[0]
+			it.entries = it.entries[1:]
+			if entry.key < it.start {
+				continue
+			}
+			if !strings.HasPrefix(entry.key, it.prefix) {
+				it.block = len(it.table.index)
+				it.entries = nil
+				return sstEntry{}, false, nil
+			}
+			return entry, true, nil
+		}
+
+		if it.block >= len(it.table.index) {
+			return sstEntry{}, false, nil
+		}
+		entries, err := it.table.block(it.block)
+		if err != nil {
+			return sstEntry{}, false, err
+		}
+		it.block++
+		it.entries = entries
+	}
+}
+
+func (t *sstable) close() error {
+	return t.file.Close()
+}
+
+// bloomFilter answers "definitely not present" for keys missing from a table
+type bloomFilter struct {
+	bits []byte
+}
+
+func newBloomFilter(keys int) *bloomFilter {
+	size := (keys*bloomBitsPerKey + 7) / 8
+	if size < 8 {
+		size = 8
+	}
+	return &bloomFilter{bits: make([]byte, size)}
+}
+
+func bloomHash(key string) (uint32, uint32) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	return uint32(sum), uint32(sum >> 32)
+}
+
+func (b *bloomFilter) add(key string) {
+	h1, h2 := bloomHash(key)
+	nbits := uint32(len(b.bits) * 8)
+	for i := uint32(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) % nbits
+		b.bits[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+func (b *bloomFilter) mayContain(key string) bool {
+	if len(b.bits) == 0 {
+		return true
+	}
+
+	h1, h2 := bloomHash(key)
+	nbits := uint32(len(b.bits) * 8)
+	for i := uint32(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) % nbits
+		if b.bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
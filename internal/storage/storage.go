@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// StorageInterface is the contract every storage engine implements.
+// Documents are addressed by collection and key; how they are laid out is up
+// to the engine.
+type StorageInterface interface {
+	// Put stores v as JSON under key, replacing any existing document
+	Put(collection, key string, v interface{}) error
+	// Get decodes the document stored under key into v. A missing document
+	// is reported as ErrNotFound.
+	Get(collection, key string, v interface{}) error
+	// Delete removes a document. A missing document is reported as ErrNotFound.
+	Delete(collection, key string) error
+	// Scan calls fn with the key and JSON of every document in a collection,
+	// in ascending key order. fn must not modify or retain data. Returning
+	// ErrStopScan from fn ends the scan early without an error.
+	Scan(collection string, fn func(key string, data []byte) error) error
+	// ScanFrom is Scan starting at the first key not less than start
+	ScanFrom(collection, start string, fn func(key string, data []byte) error) error
+	// Sync makes every completed write durable
+	Sync() error
+	Close() error
+}
+
+// SchemaCollection holds schema definitions. Collections whose names start
+// with an underscore are reserved for the database itself.
+const SchemaCollection = "_schemas"
+
+// ErrNotFound is returned when a document doesn't exist. It matches
+// os.ErrNotExist as well.
+var ErrNotFound = fmt.Errorf("document not found: %w", os.ErrNotExist)
+
+// ErrStopScan can be returned from a Scan callback to stop early
+var ErrStopScan = errors.New("stop scan")
+
+// IsSystemCollection reports whether a collection is reserved for the database
+func IsSystemCollection(collection string) bool {
+	return strings.HasPrefix(collection, "_")
+}
+
+// ValidateName checks that a collection name or key can be used by every
+// engine, including the ones that map them to file and directory names
+func ValidateName(name string) error {
+	if name == "" || name == "." || name == ".." {
+		return fmt.Errorf("invalid name %q", name)
+	}
+	if strings.ContainsAny(name, "/\\\x00") {
+		return fmt.Errorf("invalid name %q: must not contain path separators", name)
+	}
+	return nil
+}
+
+func validateAddress(collection, key string) error {
+	if err := ValidateName(collection); err != nil {
+		return fmt.Errorf("collection: %w", err)
+	}
+	if err := ValidateName(key); err != nil {
+		return fmt.Errorf("key: %w", err)
+	}
+	return nil
+}
+
+func notFound(collection, key string) error {
+	return fmt.Errorf("%w: %s/%s", ErrNotFound, collection, key)
+}
@@ -0,0 +1,688 @@
+package validator
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Query is a compiled set of criteria. Criteria use the MongoDB query
+// language: a field maps either to a value it must equal or to an operator
+// expression such as {"$gte": 18, "$lt": 65}, and $and, $or and $nor combine
+// whole criteria documents. Fields may be dotted paths into nested documents
+// and arrays, and a condition on an array field matches when any element
+// satisfies it.
+//
+// A top-level {"$text": {"$search": "..."}} condition is answered by a
+// collection's text index, which selects the records to match, so Matches
+// treats it as met.
+type Query struct {
+	match matcher
+}
+
+type matcher func(record map[string]interface{}) bool
+
+// valueTest checks a single field. values holds every value the field's path
+// reaches, and is empty when the field is missing.
+type valueTest func(values []interface{}) bool
+
+// Compile checks criteria and prepares them for matching
+func Compile(criteria map[string]interface{}) (*Query, error) {
+	if search, exists := criteria["$text"]; exists {
+		if err := checkTextSearch(search); err != nil {
+			return nil, err
+		}
+
+		rest := make(map[string]interface{}, len(criteria)-1)
+		for key, condition := range criteria {
+			if key != "$text" {
+				rest[key] = condition
+			}
+		}
+		criteria = rest
+	}
+
+	match, err := compileCriteria(criteria)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Query{match: match}, nil
+}
+
+// Matches reports whether record satisfies the query
+func (q *Query) Matches(record map[string]interface{}) bool {
+	return q.match(record)
+}
+
+// ValidateCriteria reports why criteria cannot be used, if they cannot
+func ValidateCriteria(criteria map[string]interface{}) error {
+	_, err := Compile(criteria)
+	return err
+}
+
+// MatchesValue reports whether a single value satisfies condition, which is
+// either a value to compare with or an operator expression
+func MatchesValue(value, condition interface{}) bool {
+	test, err := compileCondition(condition)
+	return err == nil && test([]interface{}{value})
+}
+
+func compileCriteria(criteria map[string]interface{}) (matcher, error) {
+	// Compile in a fixed order so that errors are reported deterministically
+	keys := make([]string, 0, len(criteria))
+	for key := range criteria {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	matchers := make([]matcher, 0, len(keys))
+	for _, key := range keys {
+		var match matcher
+		var err error
+
+		switch key {
+		case "$and", "$or", "$nor":
+			match, err = compileLogical(key, criteria[key])
+		case "$text":
+			return nil, fmt.Errorf("$text must be a top-level condition")
+		default:
+			if strings.HasPrefix(key, "$") {
+				return nil, fmt.Errorf("unknown query operator '%s'", key)
+			}
+			match, err = compileField(key, criteria[key])
+		}
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, match)
+	}
+
+	return allOf(matchers), nil
+}
+
+// checkTextSearch checks the operand of $text, which needs a $search string
+func checkTextSearch(operand interface{}) error {
+	search, ok := operand.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("$text expects a document with $search")
+	}
+	for key, value := range search {
+		if key != "$search" {
+			return fmt.Errorf("unknown $text option '%s'", key)
+		}
+		if _, isString := value.(string); !isString {
+			return fmt.Errorf("$search must be a string")
+		}
+	}
+	if _, exists := search["$search"]; !exists {
+		return fmt.Errorf("$text expects a document with $search")
+	}
+	return nil
+}
+
+func allOf(matchers []matcher) matcher {
+	return func(record map[string]interface{}) bool {
+		for _, match := range matchers {
+			if !match(record) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func compileLogical(operator string, operand interface{}) (matcher, error) {
+	clauses, err := criteriaList(operator, operand)
+	if err != nil {
+		return nil, err
+	}
+
+	matchers := make([]matcher, 0, len(clauses))
+	for _, clause := range clauses {
+		match, err := compileCriteria(clause)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, match)
+	}
+
+	switch operator {
+	case "$and":
+		return allOf(matchers), nil
+	case "$or":
+		return func(record map[string]interface{}) bool {
+			for _, match := range matchers {
+				if match(record) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	default:
+		return func(record map[string]interface{}) bool {
+			for _, match := range matchers {
+				if match(record) {
+					return false
+				}
+			}
+			return true
+		}, nil
+	}
+}
+
+// criteriaList reads the non-empty array of criteria documents taken by the
+// logical operators
+func criteriaList(operator string, operand interface{}) ([]map[string]interface{}, error) {
+	var clauses []map[string]interface{}
+
+	switch list := operand.(type) {
+	case []map[string]interface{}:
+		clauses = list
+	case []interface{}:
+		for _, item := range list {
+			clause, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s expects an array of documents", operator)
+			}
+			clauses = append(clauses, clause)
+		}
+	default:
+		return nil, fmt.Errorf("%s expects an array of documents", operator)
+	}
+
+	if len(clauses) == 0 {
+		return nil, fmt.Errorf("%s expects a non-empty array", operator)
+	}
+
+	return clauses, nil
+}
+
+func compileField(path string, condition interface{}) (matcher, error) {
+	test, err := compileCondition(condition)
+	if err != nil {
+		return nil, fmt.Errorf("field '%s': %w", path, err)
+	}
+
+	segments := strings.Split(path, ".")
+	return func(record map[string]interface{}) bool {
+		return test(resolvePath(record, segments, nil, nil))
+	}, nil
+}
+
+// ResolvePath returns every value that a dotted path reaches in value, the
+// way criteria read a field. Numeric segments index into arrays, and any
+// other segment applied to an array is looked up in each of its documents,
+// so "items.sku" reaches the sku of every item. throughArray reports whether
+// the path went into an array that way. A missing field reaches nothing.
+func ResolvePath(value interface{}, path string) (values []interface{}, throughArray bool) {
+	values = resolvePath(value, strings.Split(path, "."), nil, &throughArray)
+	return values, throughArray
+}
+
+func resolvePath(value interface{}, segments []string, values []interface{}, throughArray *bool) []interface{} {
+	if len(segments) == 0 {
+		return append(values, value)
+	}
+
+	switch container := value.(type) {
+	case map[string]interface{}:
+		if next, exists := container[segments[0]]; exists {
+			values = resolvePath(next, segments[1:], values, throughArray)
+		}
+	case []interface{}:
+		if index, err := strconv.Atoi(segments[0]); err == nil {
+			if index >= 0 && index < len(container) {
+				values = resolvePath(container[index], segments[1:], values, throughArray)
+			}
+			return values
+		}
+		if throughArray != nil {
+			*throughArray = true
+		}
+		for _, element := range container {
+			if _, isDocument := element.(map[string]interface{}); isDocument {
+				values = resolvePath(element, segments, values, throughArray)
+			}
+		}
+	}
+
+	return values
+}
+
+// anyValue reports whether match accepts one of values or, as in MongoDB,
+// one of the elements of an array among them
+func anyValue(values []interface{}, match func(value interface{}) bool) bool {
+	for _, value := range values {
+		if match(value) {
+			return true
+		}
+		if array, isArray := value.([]interface{}); isArray {
+			for _, element := range array {
+				if match(element) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// operatorExpression returns condition as a map of operators, or nil when it
+// is a plain value
+func operatorExpression(condition interface{}) (map[string]interface{}, error) {
+	expression, ok := condition.(map[string]interface{})
+	if !ok || len(expression) == 0 {
+		return nil, nil
+	}
+
+	operators := 0
+	for key := range expression {
+		if strings.HasPrefix(key, "$") {
+			operators++
+		}
+	}
+
+	switch operators {
+	case 0:
+		return nil, nil
+	case len(expression):
+		return expression, nil
+	default:
+		return nil, fmt.Errorf("cannot mix operators and fields in %v", condition)
+	}
+}
+
+func compileCondition(condition interface{}) (valueTest, error) {
+	if pattern, ok := condition.(*regexp.Regexp); ok {
+		return regexTest(pattern), nil
+	}
+
+	expression, err := operatorExpression(condition)
+	if err != nil {
+		return nil, err
+	}
+	if expression == nil {
+		return equalityTest(condition), nil
+	}
+
+	operators := make([]string, 0, len(expression))
+	for operator := range expression {
+		operators = append(operators, operator)
+	}
+	sort.Strings(operators)
+
+	tests := make([]valueTest, 0, len(operators))
+	for _, operator := range operators {
+		var test valueTest
+		var err error
+
+		switch operator {
+		case "$options":
+			if _, hasRegex := expression["$regex"]; !hasRegex {
+				return nil, fmt.Errorf("$options requires $regex")
+			}
+			continue
+		case "$regex":
+			test, err = compileRegex(expression["$regex"], expression["$options"])
+		default:
+			compile, known := valueOperators[operator]
+			if !known {
+				return nil, fmt.Errorf("unknown query operator '%s'", operator)
+			}
+			test, err = compile(expression[operator])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operator, err)
+		}
+		tests = append(tests, test)
+	}
+
+	return func(values []interface{}) bool {
+		for _, test := range tests {
+			if !test(values) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// valueOperators compile the operators that apply to a single field.
+// $regex and its $options are handled together in compileCondition.
+var valueOperators map[string]func(operand interface{}) (valueTest, error)
+
+func init() {
+	valueOperators = map[string]func(operand interface{}) (valueTest, error){
+		"$eq": func(operand interface{}) (valueTest, error) {
+			return equalityTest(operand), nil
+		},
+		"$ne": func(operand interface{}) (valueTest, error) {
+			return negate(equalityTest(operand)), nil
+		},
+		"$gt":  orderingTest(func(order int) bool { return order > 0 }),
+		"$gte": orderingTest(func(order int) bool { return order >= 0 }),
+		"$lt":  orderingTest(func(order int) bool { return order < 0 }),
+		"$lte": orderingTest(func(order int) bool { return order <= 0 }),
+		"$in":  inTest,
+		"$nin": func(operand interface{}) (valueTest, error) {
+			test, err := inTest(operand)
+			if err != nil {
+				return nil, err
+			}
+			return negate(test), nil
+		},
+		"$exists": func(operand interface{}) (valueTest, error) {
+			want, ok := operand.(bool)
+			if !ok {
+				return nil, fmt.Errorf("expects a boolean")
+			}
+			return func(values []interface{}) bool {
+				return (len(values) > 0) == want
+			}, nil
+		},
+		"$type":      typeTest,
+		"$size":      sizeTest,
+		"$all":       allTest,
+		"$elemMatch": elemMatchTest,
+		"$not": func(operand interface{}) (valueTest, error) {
+			if _, isRegex := operand.(*regexp.Regexp); !isRegex {
+				expression, err := operatorExpression(operand)
+				if err != nil {
+					return nil, err
+				}
+				if expression == nil {
+					return nil, fmt.Errorf("expects an operator expression")
+				}
+			}
+
+			test, err := compileCondition(operand)
+			if err != nil {
+				return nil, err
+			}
+			return negate(test), nil
+		},
+	}
+}
+
+// negate inverts a test over the whole field, so {"$ne": "a"} rejects an
+// array containing "a" rather than accepting it for its other elements
+func negate(test valueTest) valueTest {
+	return func(values []interface{}) bool {
+		return !test(values)
+	}
+}
+
+// equalityTest matches values equal to operand. A null operand also matches
+// missing fields.
+func equalityTest(operand interface{}) valueTest {
+	return func(values []interface{}) bool {
+		if operand == nil && len(values) == 0 {
+			return true
+		}
+		return anyValue(values, func(value interface{}) bool {
+			if operand == nil {
+				return value == nil
+			}
+			return compareValues(value, operand)
+		})
+	}
+}
+
+// orderingTest builds a range operator. Only values that can be ordered
+// against the operand, numbers with numbers and strings with strings, match.
+func orderingTest(accept func(order int) bool) func(operand interface{}) (valueTest, error) {
+	return func(operand interface{}) (valueTest, error) {
+		if _, ok := Compare(operand, operand); !ok {
+			return nil, fmt.Errorf("cannot order by %v", operand)
+		}
+
+		return func(values []interface{}) bool {
+			return anyValue(values, func(value interface{}) bool {
+				order, ok := Compare(value, operand)
+				return ok && accept(order)
+			})
+		}, nil
+	}
+}
+
+func inTest(operand interface{}) (valueTest, error) {
+	values, ok := operand.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expects an array")
+	}
+
+	tests := make([]valueTest, 0, len(values))
+	for _, value := range values {
+		if pattern, isRegex := value.(*regexp.Regexp); isRegex {
+			tests = append(tests, regexTest(pattern))
+		} else {
+			tests = append(tests, equalityTest(value))
+		}
+	}
+
+	return func(values []interface{}) bool {
+		for _, test := range tests {
+			if test(values) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// typeTest matches values of the named JSON type, or of any of an array of
+// names: "string", "int", "float" (also "double" and "number"), "bool" (also
+// "boolean"), "object", "array" and "null"
+func typeTest(operand interface{}) (valueTest, error) {
+	var names []string
+	switch typed := operand.(type) {
+	case string:
+		names = []string{typed}
+	case []interface{}:
+		for _, item := range typed {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("expects type names")
+			}
+			names = append(names, name)
+		}
+	default:
+		return nil, fmt.Errorf("expects a type name")
+	}
+
+	checks := make([]func(value interface{}) bool, 0, len(names))
+	for _, name := range names {
+		check, known := typeChecks[name]
+		if !known {
+			return nil, fmt.Errorf("unknown type '%s'", name)
+		}
+		checks = append(checks, check)
+	}
+
+	return func(values []interface{}) bool {
+		return anyValue(values, func(value interface{}) bool {
+			for _, check := range checks {
+				if check(value) {
+					return true
+				}
+			}
+			return false
+		})
+	}, nil
+}
+
+// sizeTest matches arrays with exactly the given number of elements
+func sizeTest(operand interface{}) (valueTest, error) {
+	size, ok := ToFloat(operand)
+	if !ok || size < 0 || !isInt(size) {
+		return nil, fmt.Errorf("expects a non-negative integer")
+	}
+
+	return func(values []interface{}) bool {
+		for _, value := range values {
+			if array, isArray := value.([]interface{}); isArray && float64(len(array)) == size {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// allTest matches arrays holding every one of the given values. Each value
+// may also be a condition such as {"$elemMatch": {...}}.
+func allTest(operand interface{}) (valueTest, error) {
+	conditions, ok := operand.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expects an array")
+	}
+
+	tests := make([]valueTest, 0, len(conditions))
+	for _, condition := range conditions {
+		test, err := compileCondition(condition)
+		if err != nil {
+			return nil, err
+		}
+		tests = append(tests, test)
+	}
+
+	return func(values []interface{}) bool {
+		if len(tests) == 0 {
+			return false
+		}
+		for _, test := range tests {
+			if !test(values) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// elemMatchTest matches arrays with at least one element satisfying every
+// condition at once. The operand is either criteria for document elements,
+// such as {"sku": "a", "qty": {"$gt": 2}}, or an operator expression for
+// scalar elements, such as {"$gte": 80, "$lt": 90}.
+func elemMatchTest(operand interface{}) (valueTest, error) {
+	criteria, ok := operand.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expects a document")
+	}
+
+	var matchElement func(element interface{}) bool
+	expression, err := operatorExpression(criteria)
+	if err != nil {
+		return nil, err
+	}
+
+	if expression != nil {
+		test, err := compileCondition(expression)
+		if err != nil {
+			return nil, err
+		}
+		matchElement = func(element interface{}) bool {
+			return test([]interface{}{element})
+		}
+	} else {
+		match, err := compileCriteria(criteria)
+		if err != nil {
+			return nil, err
+		}
+		matchElement = func(element interface{}) bool {
+			document, isDocument := element.(map[string]interface{})
+			return isDocument && match(document)
+		}
+	}
+
+	return func(values []interface{}) bool {
+		for _, value := range values {
+			array, isArray := value.([]interface{})
+			if !isArray {
+				continue
+			}
+			for _, element := range array {
+				if matchElement(element) {
+					return true
+				}
+			}
+		}
+		return false
+	}, nil
+}
+
+func isNumber(value interface{}) bool {
+	_, ok := ToFloat(value)
+	return ok
+}
+
+func isBool(value interface{}) bool {
+	_, ok := value.(bool)
+	return ok
+}
+
+var typeChecks = map[string]func(value interface{}) bool{
+	"string": func(value interface{}) bool {
+		_, ok := value.(string)
+		return ok
+	},
+	"int":     isInt,
+	"float":   isNumber,
+	"double":  isNumber,
+	"number":  isNumber,
+	"bool":    isBool,
+	"boolean": isBool,
+	"object": func(value interface{}) bool {
+		_, ok := value.(map[string]interface{})
+		return ok
+	},
+	"array": func(value interface{}) bool {
+		_, ok := value.([]interface{})
+		return ok
+	},
+	"null": func(value interface{}) bool {
+		return value == nil
+	},
+}
+
+// compileRegex builds a $regex test. The supported options are i, m and s,
+// with their meaning in Go regular expressions.
+func compileRegex(pattern, options interface{}) (valueTest, error) {
+	expression, ok := pattern.(string)
+	if !ok {
+		return nil, fmt.Errorf("expects a string pattern")
+	}
+
+	if options != nil {
+		flags, ok := options.(string)
+		if !ok {
+			return nil, fmt.Errorf("$options must be a string")
+		}
+		for _, flag := range flags {
+			if !strings.ContainsRune("ims", flag) {
+				return nil, fmt.Errorf("unsupported option '%c'", flag)
+			}
+		}
+		if flags != "" {
+			expression = "(?" + flags + ")" + expression
+		}
+	}
+
+	compiled, err := regexp.Compile(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	return regexTest(compiled), nil
+}
+
+// regexTest matches string values against pattern
+func regexTest(pattern *regexp.Regexp) valueTest {
+	return func(values []interface{}) bool {
+		return anyValue(values, func(value interface{}) bool {
+			text, ok := value.(string)
+			return ok && pattern.MatchString(text)
+		})
+	}
+}
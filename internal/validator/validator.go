@@ -1,8 +1,12 @@
 package validator
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"math"
 	"reflect"
+	"strings"
 
 	"github.com/adityaparmar9813/NAP/internal/types"
 )
@@ -24,7 +28,7 @@ func (v *Validator) ValidateType(value interface{}, fieldType types.FieldType) e
 			return fmt.Errorf("expected string, got %v", reflect.TypeOf(value))
 		}
 	case types.TypeInt:
-		if _, ok := value.(int); !ok {
+		if !isInt(value) {
 			return fmt.Errorf("expected int, got %v", reflect.TypeOf(value))
 		}
 	case types.TypeFloat:
@@ -41,18 +45,23 @@ func (v *Validator) ValidateType(value interface{}, fieldType types.FieldType) e
 	return nil
 }
 
-func MatchesCriteria(record, criteria map[string]interface{}) bool {
-	for key, criteriaValue := range criteria {
-		recordValue, exists := record[key]
-		if !exists {
-			return false
-		}
-
-		if !compareValues(recordValue, criteriaValue) {
-			return false
-		}
+// isInt accepts Go integers as well as whole float64 values, which is how
+// integers come back after a document has been stored as JSON
+func isInt(value interface{}) bool {
+	switch v := value.(type) {
+	case int, int8, int16, int32, int64:
+		return true
+	case float64:
+		return v == math.Trunc(v) && !math.IsInf(v, 0)
 	}
-	return true
+	return false
+}
+
+// MatchesCriteria reports whether record satisfies criteria. Invalid criteria
+// match nothing; use Compile or ValidateCriteria to find out why.
+func MatchesCriteria(record, criteria map[string]interface{}) bool {
+	query, err := Compile(criteria)
+	return err == nil && query.Matches(record)
 }
 
 func compareValues(v1, v2 interface{}) bool {
@@ -96,6 +105,114 @@ func compareValues(v1, v2 interface{}) bool {
 		}
 	}
 
-	// For other types, try string comparison as a last resort
-	return fmt.Sprintf("%v", v1) == fmt.Sprintf("%v", v2)
+	// Other values of different Go types, such as []string and
+	// []interface{}, are equal when they are stored the same. Values of
+	// different kinds, such as "20" and 20, never are, as in an index.
+	data1, err1 := json.Marshal(v1)
+	data2, err2 := json.Marshal(v2)
+	return err1 == nil && err2 == nil && bytes.Equal(data1, data2)
+}
+
+// Compare orders two values of the same kind: numbers of any Go type
+// against each other, strings lexically and false before true. ok is false
+// when the values cannot be ordered against each other.
+func Compare(v1, v2 interface{}) (result int, ok bool) {
+	if f1, isNumber := ToFloat(v1); isNumber {
+		f2, isNumber := ToFloat(v2)
+		if !isNumber {
+			return 0, false
+		}
+		return compareFloats(f1, f2), true
+	}
+
+	switch a := v1.(type) {
+	case string:
+		b, isString := v2.(string)
+		if !isString {
+			return 0, false
+		}
+		return strings.Compare(a, b), true
+	case bool:
+		b, isBool := v2.(bool)
+		if !isBool {
+			return 0, false
+		}
+		switch {
+		case a == b:
+			return 0, true
+		case !a:
+			return -1, true
+		default:
+			return 1, true
+		}
+	}
+
+	return 0, false
+}
+
+func compareFloats(f1, f2 float64) int {
+	switch {
+	case f1 < f2:
+		return -1
+	case f1 > f2:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// ToFloat converts any Go number to a float64
+func ToFloat(value interface{}) (float64, bool) {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// CompareOrder orders any two values, which Compare cannot. Values of
+// different kinds sort by kind: null (and missing values, passed as nil),
+// numbers, strings, documents, arrays and then booleans. Documents and
+// arrays of the same kind are compared by their JSON encoding.
+func CompareOrder(v1, v2 interface{}) int {
+	rank1, rank2 := kindRank(v1), kindRank(v2)
+	if rank1 != rank2 {
+		return compareFloats(float64(rank1), float64(rank2))
+	}
+
+	if result, ok := Compare(v1, v2); ok {
+		return result
+	}
+	if rank1 == 0 {
+		return 0
+	}
+
+	data1, _ := json.Marshal(v1)
+	data2, _ := json.Marshal(v2)
+	return strings.Compare(string(data1), string(data2))
+}
+
+func kindRank(value interface{}) int {
+	switch value.(type) {
+	case nil:
+		return 0
+	case string:
+		return 2
+	case map[string]interface{}:
+		return 3
+	case []interface{}:
+		return 4
+	case bool:
+		return 5
+	}
+	if _, ok := ToFloat(value); ok {
+		return 1
+	}
+	// Anything else sorts with documents
+	return 3
 }
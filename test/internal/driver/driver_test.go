@@ -1,7 +1,209 @@
-package main
+package driver
 
-import "fmt"
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
 
-func main() {
-	fmt.Println("Working")
-}
\ No newline at end of file
+	"github.com/adityaparmar9813/NAP/internal/driver"
+	"github.com/adityaparmar9813/NAP/internal/schema"
+	"github.com/adityaparmar9813/NAP/internal/types"
+)
+
+func TestOpen_CreatesDirectoryAndLock(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "db")
+
+	db, err := driver.Open(dir, driver.Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer db.Close()
+
+	if _, err := os.Stat(filepath.Join(dir, "LOCK")); err != nil {
+		t.Fatalf("expected lock file, got %v", err)
+	}
+	if db.Dir() != dir {
+		t.Fatalf("expected dir %s, got %s", dir, db.Dir())
+	}
+}
+
+func TestOpen_DirectoryAlreadyOpen(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := driver.Open(dir, driver.Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := driver.Open(dir, driver.Options{}); !errors.Is(err, driver.ErrLocked) {
+		t.Fatalf("expected locked error, got %v", err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// The lock is released on close
+	db, err = driver.Open(dir, driver.Options{})
+	if err != nil {
+		t.Fatalf("expected no error after close, got %v", err)
+	}
+	db.Close()
+}
+
+func TestClose_Twice(t *testing.T) {
+	db, err := driver.Open(t.TempDir(), driver.Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	db.Close()
+	if err := db.Close(); !errors.Is(err, driver.ErrClosed) {
+		t.Fatalf("expected closed error, got %v", err)
+	}
+	if _, err := db.CreateCollection("users"); !errors.Is(err, driver.ErrClosed) {
+		t.Fatalf("expected closed error, got %v", err)
+	}
+}
+
+func TestDatabases_AreIsolated(t *testing.T) {
+	for _, engine := range []driver.Engine{driver.EngineFile, driver.EnginePaged, driver.EngineLSM, driver.EngineMemory} {
+		t.Run(string(engine), func(t *testing.T) {
+			first, err := driver.Open(t.TempDir(), driver.Options{Engine: engine})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			defer first.Close()
+
+			second, err := driver.Open(t.TempDir(), driver.Options{Engine: engine})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			defer second.Close()
+
+			users, err := first.CreateCollection("users", schema.Field{Name: "name", Type: types.TypeString, Required: true})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if err := users.AddRecord(map[string]interface{}{"name": "Ansh"}, first.Validator(), first.Storage()); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			records, err := users.GetRecord(map[string]interface{}{}, first.Storage())
+			if err != nil || len(records) != 1 {
+				t.Fatalf("expected 1 record in first database, got %v (%v)", records, err)
+			}
+
+			records, err = users.GetRecord(map[string]interface{}{}, second.Storage())
+			if err != nil || len(records) != 0 {
+				t.Fatalf("expected no records in second database, got %v (%v)", records, err)
+			}
+		})
+	}
+}
+
+func TestOpen_PersistsAcrossReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := driver.Open(dir, driver.Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	users, _ := db.CreateCollection("users", schema.Field{Name: "name", Type: types.TypeString, Required: true})
+	users.AddRecord(map[string]interface{}{"name": "Ansh"}, db.Validator(), db.Storage())
+	db.Close()
+
+	// Records are laid out under the data directory, not the working directory
+	entries, _ := os.ReadDir(filepath.Join(dir, "collections", "users"))
+	if len(entries) != 1 {
+		t.Fatalf("expected one record file under the data directory, got %d", len(entries))
+	}
+
+	db, err = driver.Open(dir, driver.Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer db.Close()
+
+	// The schema is loaded from the database rather than redefined
+	names, _ := db.ListCollections()
+	if len(names) != 1 || names[0] != "users" {
+		t.Fatalf("expected [users], got %v", names)
+	}
+	users, err = db.Collection("users")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	records, err := users.GetRecord(map[string]interface{}{"name": "Ansh"}, db.Storage())
+	if err != nil || len(records) != 1 {
+		t.Fatalf("expected persisted record, got %v (%v)", records, err)
+	}
+}
+
+func TestDropCollection(t *testing.T) {
+	db, err := driver.Open("", driver.Options{Engine: driver.EngineMemory})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer db.Close()
+
+	db.CreateCollection("users", schema.Field{Name: "name", Type: types.TypeString})
+
+	if err := db.DropCollection("users"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := db.Collection("users"); !errors.Is(err, schema.ErrCollectionNotFound) {
+		t.Fatalf("expected collection not found, got %v", err)
+	}
+}
+
+func TestOpen_ReaperExpiresRecords(t *testing.T) {
+	expired := make(chan map[string]int, 1)
+	db, err := driver.Open("", driver.Options{
+		Engine:         driver.EngineMemory,
+		ExpireInterval: 10 * time.Millisecond,
+		OnExpire: func(removed map[string]int, err error) {
+			if err == nil {
+				expired <- removed
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer db.Close()
+
+	tokens, err := db.CreateCollection("tokens")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := tokens.CreateIndex(schema.Index{Name: "ttl", Fields: []string{"issuedAt"}, ExpireAfter: time.Hour}, db.Storage()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, issuedAt := range []time.Time{time.Now().Add(-2 * time.Hour), time.Now()} {
+		doc := map[string]interface{}{"issuedAt": issuedAt.Format(time.RFC3339Nano)}
+		if err := tokens.AddRecord(doc, db.Validator(), db.Storage()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	select {
+	case removed := <-expired:
+		if removed["tokens"] != 1 {
+			t.Fatalf("expected 1 expired token, got %v", removed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the reaper to delete the expired token")
+	}
+
+	remaining, err := tokens.Count(map[string]interface{}{}, db.Storage())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if remaining != 1 {
+		t.Fatalf("expected 1 token to remain, got %d", remaining)
+	}
+}
@@ -0,0 +1,109 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/adityaparmar9813/NAP/internal/index"
+	"github.com/adityaparmar9813/NAP/internal/storage"
+)
+
+func TestHashIndex_InsertLookupAndDelete(t *testing.T) {
+	hash, err := index.OpenHashIndex(storage.NewMemoryStorage(), "_index.users.email")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	hash.SetBucketLoad(2)
+
+	for i := 0; i < 300; i++ {
+		if err := hash.Insert([]interface{}{fmt.Sprintf("user%d@example.com", i%100)}, fmt.Sprintf("id%03d", i)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	// The table grows as entries are added
+	if hash.Buckets() < 150 {
+		t.Fatalf("expected at least 150 buckets, got %d", hash.Buckets())
+	}
+
+	ids, err := hash.Lookup([]interface{}{"user42@example.com"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(ids, []string{"id042", "id142", "id242"}) {
+		t.Fatalf("expected the three records with the key, got %v", ids)
+	}
+
+	if err := hash.Delete([]interface{}{"user42@example.com"}, "id142"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	ids, _ = hash.Lookup([]interface{}{"user42@example.com"})
+	if !reflect.DeepEqual(ids, []string{"id042", "id242"}) {
+		t.Fatalf("expected the deleted entry to be gone, got %v", ids)
+	}
+
+	// Numbers are found whatever type they were inserted with
+	if err := hash.Insert([]interface{}{7}, "seven"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if ids, _ := hash.Lookup([]interface{}{7.0}); !reflect.DeepEqual(ids, []string{"seven"}) {
+		t.Fatalf("expected to find 7 as a float, got %v", ids)
+	}
+}
+
+func TestHashIndex_InsertUnique(t *testing.T) {
+	hash, err := index.OpenHashIndex(storage.NewMemoryStorage(), "_index.users.email")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if err := hash.InsertUnique([]interface{}{"ann@example.com"}, "a"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := hash.InsertUnique([]interface{}{"ann@example.com"}, "a"); err != nil {
+		t.Fatalf("expected reinserting the same entry to succeed, got %v", err)
+	}
+	if err := hash.InsertUnique([]interface{}{"ann@example.com"}, "b"); !errors.Is(err, index.ErrDuplicateKey) {
+		t.Fatalf("expected ErrDuplicateKey, got %v", err)
+	}
+}
+
+func TestHashIndex_Persists(t *testing.T) {
+	root := t.TempDir()
+	store := storage.NewPagedStorage(root, 0)
+
+	hash, err := index.OpenHashIndex(store, "_index.users.email")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	hash.SetBucketLoad(1)
+	for i := 0; i < 50; i++ {
+		if err := hash.Insert([]interface{}{i}, fmt.Sprint("id", i)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	buckets := hash.Buckets()
+	if err := store.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	store = storage.NewPagedStorage(root, 0)
+	defer store.Close()
+	reopened, err := index.OpenHashIndex(store, "_index.users.email")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if reopened.Buckets() != buckets {
+		t.Fatalf("expected %d buckets, got %d", buckets, reopened.Buckets())
+	}
+	for i := 0; i < 50; i++ {
+		ids, err := reopened.Lookup([]interface{}{i})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(ids) != 1 || ids[0] != fmt.Sprint("id", i) {
+			t.Fatalf("expected id%d, got %v", i, ids)
+		}
+	}
+}
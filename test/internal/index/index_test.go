@@ -1,7 +1,304 @@
-package main
+package index
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
 
-func main() {
-	fmt.Println("Working")
-}
\ No newline at end of file
+	"github.com/adityaparmar9813/NAP/internal/index"
+	"github.com/adityaparmar9813/NAP/internal/storage"
+)
+
+// entries returns every entry of a tree from the first key at least from
+func entries(t *testing.T, tree *index.BTree, from []interface{}) []index.Entry {
+	t.Helper()
+
+	var found []index.Entry
+	err := tree.Scan(from, func(key []interface{}, id string) error {
+		found = append(found, index.Entry{Key: key, ID: id})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return found
+}
+
+func TestCompareKeys(t *testing.T) {
+	tests := []struct {
+		a, b     []interface{}
+		expected int
+	}{
+		{[]interface{}{1}, []interface{}{2}, -1},
+		{[]interface{}{2, "a"}, []interface{}{2, "b"}, -1},
+		{[]interface{}{2.0}, []interface{}{2}, 0},
+		{[]interface{}{nil}, []interface{}{0}, -1},
+		{[]interface{}{"a"}, []interface{}{"a", nil}, -1},
+		{[]interface{}{true}, []interface{}{"z"}, 1},
+	}
+
+	for _, test := range tests {
+		if result := index.CompareKeys(test.a, test.b); result != test.expected {
+			t.Fatalf("expected %d comparing %v and %v, got %d", test.expected, test.a, test.b, result)
+		}
+	}
+}
+
+func TestBTree_InsertScanAndDelete(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	tree, err := index.OpenBTree(store, "_index.numbers.n", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	tree.SetOrder(4)
+
+	random := rand.New(rand.NewSource(1))
+	numbers := random.Perm(500)
+	for _, n := range numbers {
+		if err := tree.Insert([]interface{}{n % 100}, fmt.Sprintf("id%03d", n)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	// Inserting an entry twice keeps one copy
+	if err := tree.Insert([]interface{}{7}, "id007"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	found := entries(t, tree, nil)
+	if len(found) != 500 {
+		t.Fatalf("expected 500 entries, got %d", len(found))
+	}
+	sorted := sort.SliceIsSorted(found, func(i, j int) bool {
+		order := index.CompareKeys(found[i].Key, found[j].Key)
+		return order < 0 || (order == 0 && found[i].ID < found[j].ID)
+	})
+	if !sorted {
+		t.Fatalf("expected entries in key order")
+	}
+
+	// Seek into the middle of the duplicates of a key
+	found = entries(t, tree, []interface{}{42})
+	if len(found) != 290 || found[0].ID != "id042" || found[4].ID != "id442" {
+		t.Fatalf("expected to start at key 42, got %d entries starting with %v", len(found), found[:5])
+	}
+
+	for _, n := range numbers {
+		if n%2 == 0 {
+			if err := tree.Delete([]interface{}{n % 100}, fmt.Sprintf("id%03d", n)); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+	}
+	// Deleting a missing entry does nothing
+	if err := tree.Delete([]interface{}{1}, "missing"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	found = entries(t, tree, nil)
+	if len(found) != 250 {
+		t.Fatalf("expected 250 entries, got %d", len(found))
+	}
+	for _, entry := range found {
+		if int(entry.Key[0].(float64))%2 == 0 {
+			t.Fatalf("expected even keys to be deleted, got %v", entry)
+		}
+	}
+}
+
+func TestBTree_Persists(t *testing.T) {
+	root := t.TempDir()
+	store := storage.NewPagedStorage(root, 0)
+
+	tree, err := index.OpenBTree(store, "_index.users.name", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	tree.SetOrder(3)
+	for i := 0; i < 50; i++ {
+		if err := tree.Insert([]interface{}{fmt.Sprintf("user %02d", i), i}, fmt.Sprint("id", i)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	before := entries(t, tree, nil)
+	if err := store.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	store = storage.NewPagedStorage(root, 0)
+	defer store.Close()
+	reopened, err := index.OpenBTree(store, "_index.users.name", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	after := entries(t, reopened, nil)
+	if !reflect.DeepEqual(before, after) {
+		t.Fatalf("expected the reopened tree to hold the same entries")
+	}
+	if err := reopened.Insert([]interface{}{"user 25", 100}, "id100"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if found := entries(t, reopened, []interface{}{"user 25", 100}); found[0].ID != "id100" {
+		t.Fatalf("expected to find the new entry, got %v", found[0])
+	}
+
+	if err := reopened.Drop(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	remaining := 0
+	store.Scan("_index.users.name", func(key string, data []byte) error {
+		remaining++
+		return nil
+	})
+	if remaining != 0 {
+		t.Fatalf("expected no nodes after drop, got %d", remaining)
+	}
+}
+
+func TestBTree_Multikey(t *testing.T) {
+	tree, err := index.OpenBTree(storage.NewMemoryStorage(), "_index.posts.tags", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if err := tree.Insert([]interface{}{"go"}, "a"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if tree.Multikey() {
+		t.Fatalf("expected a tree of scalar keys not to be multikey")
+	}
+	if err := tree.Insert([]interface{}{[]interface{}{"go", "db"}}, "b"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !tree.Multikey() {
+		t.Fatalf("expected a tree with an array key to be multikey")
+	}
+}
+
+func TestBTree_Descending(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	tree, err := index.OpenBTree(store, "_index.scores.team_points", []bool{false, true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	tree.SetOrder(4)
+
+	for i := 0; i < 20; i++ {
+		if err := tree.Insert([]interface{}{[]string{"blue", "red"}[i%2], i}, fmt.Sprintf("id%02d", i)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	// Within a team, points come from largest to smallest
+	found := entries(t, tree, []interface{}{"red"})
+	if len(found) != 10 || found[0].Key[1] != float64(19) || found[9].Key[1] != float64(1) {
+		t.Fatalf("expected red points from 19 down to 1, got %v", found)
+	}
+
+	// The directions are kept with the tree
+	reopened, err := index.OpenBTree(store, "_index.scores.team_points", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reopened.Descending(1) || reopened.Descending(0) {
+		t.Fatalf("expected only the second field to be descending")
+	}
+}
+
+func TestBTree_ScanFrom(t *testing.T) {
+	tree, err := index.OpenBTree(storage.NewMemoryStorage(), "_index.numbers.n", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	tree.SetOrder(4)
+
+	for i := 0; i < 40; i++ {
+		if err := tree.Insert([]interface{}{i / 2}, fmt.Sprintf("id%02d", i)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	// The scan starts at the entry for the key and id, and fn may change
+	// the tree while it runs
+	var ids []string
+	err = tree.ScanFrom([]interface{}{5}, "id11", func(key []interface{}, id string) error {
+		ids = append(ids, id)
+		if id == "id20" {
+			if err := tree.Insert([]interface{}{100}, "added"); err != nil {
+				return err
+			}
+			return tree.Delete([]interface{}{17}, "id35")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(ids) != 29 || ids[0] != "id11" || ids[28] != "added" {
+		t.Fatalf("expected id11 to id39 without id35 and then the added entry, got %v", ids)
+	}
+}
+
+// failingStorage fails the nth write from when it is armed
+type failingStorage struct {
+	storage.StorageInterface
+	countdown int
+}
+
+func (fs *failingStorage) Put(collection, key string, v interface{}) error {
+	if fs.countdown > 0 {
+		fs.countdown--
+		if fs.countdown == 0 {
+			return errors.New("disk full")
+		}
+	}
+	return fs.StorageInterface.Put(collection, key, v)
+}
+
+func TestBTree_FailedWriteLeavesTreeUnchanged(t *testing.T) {
+	// Failing each of the next few writes in turn hits every step of
+	// inserts and splits: new nodes, split nodes, parents and metadata
+	for n := 1; n <= 8; n++ {
+		store := &failingStorage{StorageInterface: storage.NewMemoryStorage()}
+		tree, err := index.OpenBTree(store, "_index.users.age", nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		tree.SetOrder(3)
+		for i := 0; i < 20; i += 2 {
+			if err := tree.Insert([]interface{}{i}, fmt.Sprint("id", i)); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+		before := entries(t, tree, nil)
+
+		store.countdown = n
+		for i := 1; i < 20 && store.countdown > 0; i += 2 {
+			if err := tree.Insert([]interface{}{i}, fmt.Sprint("id", i)); err != nil {
+				break
+			}
+			before = entries(t, tree, nil)
+		}
+		if store.countdown != 0 {
+			t.Fatalf("expected write %d to fail", n)
+		}
+
+		if after := entries(t, tree, nil); !reflect.DeepEqual(before, after) {
+			t.Fatalf("write %d: expected the failed insert to change nothing, got %v", n, after)
+		}
+		reopened, err := index.OpenBTree(store, "_index.users.age", nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if stored := entries(t, reopened, nil); !reflect.DeepEqual(before, stored) {
+			t.Fatalf("write %d: expected storage to hold the tree as it was, got %v", n, stored)
+		}
+		if err := tree.Insert([]interface{}{100}, "id100"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package index
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/adityaparmar9813/NAP/internal/index"
+	"github.com/adityaparmar9813/NAP/internal/storage"
+)
+
+func TestStem(t *testing.T) {
+	tests := map[string]string{
+		"caresses":       "caress",
+		"ponies":         "poni",
+		"cats":           "cat",
+		"agreed":         "agre",
+		"motoring":       "motor",
+		"hopping":        "hop",
+		"relational":     "relat",
+		"generalization": "gener",
+		"connection":     "connect",
+		"running":        "run",
+		"go":             "go",
+	}
+
+	for word, expected := range tests {
+		if stem := index.Stem(word); stem != expected {
+			t.Fatalf("expected %s to stem to %s, got %s", word, expected, stem)
+		}
+	}
+}
+
+func TestParseTextQuery(t *testing.T) {
+	query := index.ParseTextQuery(`fast "key value" stor* database`)
+
+	expected := index.TextQuery{
+		Words:    []string{"fast", "database"},
+		Prefixes: []string{"stor"},
+		Phrases:  []string{"key value"},
+	}
+	if !reflect.DeepEqual(query, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, query)
+	}
+}
+
+func TestAnalyzer_Terms(t *testing.T) {
+	analyzer, err := index.NewAnalyzer("", "")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	terms := analyzer.Terms("The Running of the Bulls, re-run!")
+	expected := []index.Term{{Text: "run", Position: 1}, {Text: "bull", Position: 4}, {Text: "re", Position: 5}, {Text: "run", Position: 6}}
+	if !reflect.DeepEqual(terms, expected) {
+		t.Fatalf("expected %v, got %v", expected, terms)
+	}
+
+	if _, err := index.NewAnalyzer("missing", ""); err == nil {
+		t.Fatalf("expected an error for an unknown tokenizer")
+	}
+	if _, err := index.NewAnalyzer("", "klingon"); err == nil {
+		t.Fatalf("expected an error for an unknown language")
+	}
+}
+
+func TestTextIndex_Search(t *testing.T) {
+	analyzer, err := index.NewAnalyzer("", "")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	text, err := index.OpenTextIndex(storage.NewMemoryStorage(), "_index.posts.body", analyzer)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	posts := map[string]string{
+		"a": "Database on database: a key value database",
+		"b": "Storing values in a database",
+		"c": "Cooking pasta for dinner",
+		"d": "The value of a key is stored",
+	}
+	for id, body := range posts {
+		if err := text.Insert([]interface{}{body}, id); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	scores, err := text.Search(index.ParseTextQuery("database"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(scores) != 2 || scores["a"] <= scores["b"] {
+		t.Fatalf("expected a to outrank b, got %v", scores)
+	}
+
+	scores, err = text.Search(index.ParseTextQuery(`"key value"`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, found := scores["a"]; len(scores) != 1 || !found {
+		t.Fatalf("expected only a to hold the phrase, got %v", scores)
+	}
+
+	scores, err = text.Search(index.ParseTextQuery("cook*"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, found := scores["c"]; len(scores) != 1 || !found {
+		t.Fatalf("expected the prefix to find c, got %v", scores)
+	}
+
+	if err := text.Delete([]interface{}{posts["a"]}, "a"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	scores, err = text.Search(index.ParseTextQuery("database"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, found := scores["b"]; len(scores) != 1 || !found {
+		t.Fatalf("expected only b after deleting a, got %v", scores)
+	}
+
+	if _, err := text.Lookup([]interface{}{"database"}); !errors.Is(err, index.ErrNotSearchable) {
+		t.Fatalf("expected ErrNotSearchable, got %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+package schema
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/adityaparmar9813/NAP/internal/storage"
+)
+
+// orderDocs returns the orders of two customers
+func orderDocs() []map[string]interface{} {
+	return []map[string]interface{}{
+		{"customer": "ansh", "status": "paid", "total": 30, "items": []interface{}{
+			map[string]interface{}{"sku": "pen", "qty": 2},
+			map[string]interface{}{"sku": "ink", "qty": 1},
+		}},
+		{"customer": "arpit", "status": "paid", "total": 50, "items": []interface{}{
+			map[string]interface{}{"sku": "pen", "qty": 5},
+		}},
+		{"customer": "ansh", "status": "paid", "total": 20, "items": []interface{}{}},
+		{"customer": "ansh", "status": "cancelled", "total": 100},
+	}
+}
+
+func TestAggregate_MatchGroupSort(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	orders := buildCollection(t, store, "orders", nil, orderDocs())
+
+	results, err := orders.Aggregate(context.Background(), []map[string]interface{}{
+		{"$match": map[string]interface{}{"status": "paid"}},
+		{"$sort": map[string]interface{}{"total": 1}},
+		{"$group": map[string]interface{}{
+			"_id":      "$customer",
+			"revenue":  map[string]interface{}{"$sum": "$total"},
+			"average":  map[string]interface{}{"$avg": "$total"},
+			"largest":  map[string]interface{}{"$max": "$total"},
+			"smallest": map[string]interface{}{"$min": "$total"},
+			"orders":   map[string]interface{}{"$count": map[string]interface{}{}},
+			"totals":   map[string]interface{}{"$push": "$total"},
+		}},
+		{"$sort": map[string]interface{}{"revenue": -1}},
+	}, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := []map[string]interface{}{
+		{"_id": "ansh", "revenue": float64(50), "average": float64(25), "largest": float64(30), "smallest": float64(20), "orders": float64(2), "totals": []interface{}{float64(20), float64(30)}},
+		{"_id": "arpit", "revenue": float64(50), "average": float64(50), "largest": float64(50), "smallest": float64(50), "orders": float64(1), "totals": []interface{}{float64(50)}},
+	}
+	// Both customers have the same revenue, so their order is not asserted
+	if len(results) != 2 {
+		t.Fatalf("expected 2 groups, got %v", results)
+	}
+	if results[0]["_id"] == "arpit" {
+		results[0], results[1] = results[1], results[0]
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("expected %v, got %v", expected, results)
+	}
+}
+
+func TestAggregate_GroupAll(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	orders := buildCollection(t, store, "orders", nil, orderDocs())
+
+	results, err := orders.Aggregate(context.Background(), []map[string]interface{}{
+		{"$group": map[string]interface{}{"_id": nil, "count": map[string]interface{}{"$sum": 1}, "missing": map[string]interface{}{"$avg": "$nothing"}}},
+	}, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := []map[string]interface{}{{"_id": nil, "count": float64(4), "missing": nil}}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("expected %v, got %v", expected, results)
+	}
+}
+
+func TestAggregate_UnwindProjectAddFields(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	orders := buildCollection(t, store, "orders", nil, orderDocs())
+
+	results, err := orders.Aggregate(context.Background(), []map[string]interface{}{
+		{"$unwind": "$items"},
+		{"$addFields": map[string]interface{}{"line": map[string]interface{}{"$concat": []interface{}{"$customer", ":", "$items.sku"}}}},
+		{"$project": map[string]interface{}{"uuid": 0, "line": 1, "qty": "$items.qty", "double": map[string]interface{}{"$multiply": []interface{}{"$items.qty", 2}}}},
+		{"$sort": []interface{}{map[string]interface{}{"qty": -1}, map[string]interface{}{"line": 1}}},
+		{"$skip": 1},
+		{"$limit": 1},
+	}, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := []map[string]interface{}{{"line": "ansh:pen", "qty": float64(2), "double": float64(4)}}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("expected %v, got %v", expected, results)
+	}
+}
+
+func TestAggregate_UnwindOptions(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	orders := buildCollection(t, store, "orders", nil, orderDocs())
+
+	results, err := orders.Aggregate(context.Background(), []map[string]interface{}{
+		{"$match": map[string]interface{}{"customer": "ansh"}},
+		{"$unwind": map[string]interface{}{"path": "$items", "includeArrayIndex": "position", "preserveNullAndEmptyArrays": true}},
+		{"$project": map[string]interface{}{"uuid": 0, "sku": "$items.sku", "position": 1, "total": 1}},
+		{"$sort": []interface{}{map[string]interface{}{"total": 1}, map[string]interface{}{"position": 1}}},
+	}, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// The empty and the missing arrays are kept with a null index
+	expected := []map[string]interface{}{
+		{"total": float64(20), "position": nil, "sku": []interface{}{}},
+		{"total": float64(30), "position": float64(0), "sku": "pen"},
+		{"total": float64(30), "position": float64(1), "sku": "ink"},
+		{"total": float64(100), "position": nil, "sku": nil},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("expected %v, got %v", expected, results)
+	}
+}
+
+func TestAggregate_FieldPathsMatchQueries(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	orders := buildCollection(t, store, "orders", nil, orderDocs())
+
+	// Expressions read paths as criteria do, array positions included
+	results, err := orders.Aggregate(context.Background(), []map[string]interface{}{
+		{"$match": map[string]interface{}{"items.0.sku": "pen"}},
+		{"$project": map[string]interface{}{"uuid": 0, "first": "$items.0.sku", "skus": "$items.sku"}},
+		{"$sort": map[string]interface{}{"skus": 1}},
+	}, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := []map[string]interface{}{
+		{"first": "pen", "skus": []interface{}{"pen", "ink"}},
+		{"first": "pen", "skus": []interface{}{"pen"}},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("expected %v, got %v", expected, results)
+	}
+}
+
+func TestAggregate_DoesNotModifyRecords(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	orders := buildCollection(t, store, "orders", nil, orderDocs())
+
+	_, err := orders.Aggregate(context.Background(), []map[string]interface{}{
+		{"$addFields": map[string]interface{}{"total": 0, "extra": true}},
+	}, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	records, _ := orders.GetRecord(map[string]interface{}{"extra": true}, store)
+	if len(records) != 0 {
+		t.Fatalf("expected stored records to be unchanged, got %v", records)
+	}
+}
+
+func TestAggregate_InvalidPipelines(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	orders := buildCollection(t, store, "orders", nil, orderDocs())
+
+	tests := []struct {
+		stage map[string]interface{}
+		err   string
+	}{
+		{map[string]interface{}{"$out": "copy"}, "unknown stage"},
+		{map[string]interface{}{"$match": map[string]interface{}{"total": map[string]interface{}{"$near": 1}}}, "unknown query operator"},
+		{map[string]interface{}{"$group": map[string]interface{}{"total": map[string]interface{}{"$sum": 1}}}, "_id"},
+		{map[string]interface{}{"$group": map[string]interface{}{"_id": nil, "x": map[string]interface{}{"$median": 1}}}, "unknown accumulator"},
+		{map[string]interface{}{"$sort": map[string]interface{}{"a": 1, "b": 1}}, "array"},
+		{map[string]interface{}{"$limit": -1}, "non-negative"},
+		{map[string]interface{}{"$unwind": "items"}, "field path"},
+		{map[string]interface{}{"$project": map[string]interface{}{"total": 0, "double": map[string]interface{}{"$add": []interface{}{"$total", 1}}}}, "cannot exclude"},
+		{map[string]interface{}{"$addFields": map[string]interface{}{"x": map[string]interface{}{"$pow": []interface{}{2, 3}}}}, "unknown expression operator"},
+		{map[string]interface{}{"$match": map[string]interface{}{}, "$limit": 1}, "exactly one key"},
+	}
+
+	for _, test := range tests {
+		_, err := orders.Aggregate(context.Background(), []map[string]interface{}{test.stage}, store)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("expected error containing %q for %v, got %v", test.err, test.stage, err)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package schema
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/adityaparmar9813/NAP/internal/schema"
+	"github.com/adityaparmar9813/NAP/internal/storage"
+	"github.com/adityaparmar9813/NAP/internal/types"
+)
+
+func TestLoadCatalog_ReloadsPersistedSchemas(t *testing.T) {
+	memoryStorage := storage.NewMemoryStorage()
+	schema.BuildSchema("users", memoryStorage, Field{Name: "name", Type: types.TypeString, Required: true})
+	schema.BuildSchema("orders", memoryStorage, Field{Name: "total", Type: types.TypeFloat})
+
+	catalog, err := schema.LoadCatalog(memoryStorage)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if names := catalog.List(); !reflect.DeepEqual(names, []string{"orders", "users"}) {
+		t.Fatalf("expected [orders users], got %v", names)
+	}
+
+	users, err := catalog.Get("users")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if field := users.Fields["name"]; field.Type != types.TypeString || !field.Required {
+		t.Fatalf("expected reloaded field definition, got %+v", field)
+	}
+}
+
+func TestCatalog_CreateSameDefinitionReturnsExisting(t *testing.T) {
+	catalog, _ := schema.LoadCatalog(storage.NewMemoryStorage())
+	nameField := Field{Name: "name", Type: types.TypeString, Required: true}
+
+	first, err := catalog.Create("users", nameField)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	second, err := catalog.Create("users", nameField)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if first != second {
+		t.Fatalf("expected the existing schema to be returned")
+	}
+}
+
+func TestCatalog_CreateConflictingDefinition(t *testing.T) {
+	memoryStorage := storage.NewMemoryStorage()
+	catalog, _ := schema.LoadCatalog(memoryStorage)
+	catalog.Create("users", Field{Name: "name", Type: types.TypeString, Required: true})
+
+	_, err := catalog.Create("users", Field{Name: "name", Type: types.TypeInt, Required: true})
+	if !errors.Is(err, schema.ErrSchemaConflict) {
+		t.Fatalf("expected schema conflict, got %v", err)
+	}
+
+	// BuildSchema refuses as well, and the saved definition is untouched
+	_, err = schema.BuildSchema("users", memoryStorage, Field{Name: "age", Type: types.TypeInt})
+	if !errors.Is(err, schema.ErrSchemaConflict) {
+		t.Fatalf("expected schema conflict, got %v", err)
+	}
+
+	reloaded, _ := schema.LoadCatalog(memoryStorage)
+	users, _ := reloaded.Get("users")
+	if users.Fields["name"].Type != types.TypeString {
+		t.Fatalf("expected original definition to be kept, got %+v", users.Fields)
+	}
+}
+
+func TestCatalog_Drop(t *testing.T) {
+	memoryStorage := storage.NewMemoryStorage()
+	catalog, _ := schema.LoadCatalog(memoryStorage)
+	users, _ := catalog.Create("users", Field{Name: "name", Type: types.TypeString, Required: true})
+	users.AddRecord(map[string]interface{}{"name": "Ansh"}, MockValidator{}, memoryStorage)
+	users.AddRecord(map[string]interface{}{"name": "Arpit"}, MockValidator{}, memoryStorage)
+
+	if err := catalog.Drop("users"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := catalog.Get("users"); !errors.Is(err, schema.ErrCollectionNotFound) {
+		t.Fatalf("expected collection not found, got %v", err)
+	}
+	if err := catalog.Drop("users"); !errors.Is(err, schema.ErrCollectionNotFound) {
+		t.Fatalf("expected collection not found, got %v", err)
+	}
+
+	records, _ := users.GetRecord(map[string]interface{}{}, memoryStorage)
+	if len(records) != 0 {
+		t.Fatalf("expected records to be deleted, got %v", records)
+	}
+
+	// The collection can be recreated with a new definition
+	if _, err := catalog.Create("users", Field{Name: "email", Type: types.TypeString}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestCatalog_RecoverRebuildsIndexes(t *testing.T) {
+	root := t.TempDir()
+	store := storage.NewPagedStorage(root, 0)
+
+	catalog, _ := schema.LoadCatalog(store)
+	if crashed, err := catalog.Recover(); err != nil || crashed {
+		t.Fatalf("expected a clean start, got %v and %v", crashed, err)
+	}
+	users, _ := catalog.Create("users", Field{Name: "name", Type: types.TypeString, Required: true})
+	if err := users.CreateIndex(schema.Index{Name: "name", Fields: []string{"name"}}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := users.AddRecord(map[string]interface{}{"name": "ada"}, MockValidator{}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// A crash between writing a record and its index entry leaves the
+	// record out of the index
+	if err := store.Put("users", "written-before-crash", map[string]interface{}{"uuid": "written-before-crash", "name": "ada"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	store = storage.NewPagedStorage(root, 0)
+	defer store.Close()
+	catalog, _ = schema.LoadCatalog(store)
+	crashed, err := catalog.Recover()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !crashed {
+		t.Fatalf("expected the unclean shutdown to be detected")
+	}
+	users, _ = catalog.Get("users")
+	count, err := users.Count(map[string]interface{}{"name": "ada"}, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("expected the rebuilt index to find 2 records, got %d", count)
+	}
+
+	if err := catalog.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if crashed, err := catalog.Recover(); err != nil || crashed {
+		t.Fatalf("expected a clean start after Close, got %v and %v", crashed, err)
+	}
+}
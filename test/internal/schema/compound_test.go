@@ -0,0 +1,279 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/adityaparmar9813/NAP/internal/schema"
+	"github.com/adityaparmar9813/NAP/internal/storage"
+	"github.com/adityaparmar9813/NAP/internal/types"
+)
+
+var scoreFields = []Field{
+	{Name: "team", Type: types.TypeString, Required: true},
+	{Name: "points", Type: types.TypeInt, Required: true},
+}
+
+// scoreDocs returns 20 scores split between two teams
+func scoreDocs() []map[string]interface{} {
+	docs := make([]map[string]interface{}, 20)
+	for i := range docs {
+		docs[i] = map[string]interface{}{"team": []string{"red", "blue"}[i%2], "points": i}
+	}
+	return docs
+}
+
+// teamPoints orders the points of each team from largest to smallest
+var teamPoints = schema.Index{
+	Name:   "team_points",
+	Fields: []string{"team", "points"},
+	Orders: []schema.SortOrder{schema.Ascending, schema.Descending},
+}
+
+func points(records []map[string]interface{}) []float64 {
+	values := make([]float64, len(records))
+	for i, record := range records {
+		values[i] = record["points"].(float64)
+	}
+	return values
+}
+
+func TestIndex_PrefixAndRange(t *testing.T) {
+	store := newCountingStorage()
+	scores := buildCollection(t, store, "scores", scoreFields, scoreDocs())
+	if err := scores.CreateIndex(teamPoints, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	store.reset()
+
+	tests := []struct {
+		criteria map[string]interface{}
+		expected int
+	}{
+		{map[string]interface{}{"team": "red"}, 10},
+		{map[string]interface{}{"team": "red", "points": map[string]interface{}{"$gte": 10}}, 5},
+		{map[string]interface{}{"team": "blue", "points": map[string]interface{}{"$gt": 4, "$lte": 9}}, 3},
+		{map[string]interface{}{"team": map[string]interface{}{"$in": []interface{}{"red", "blue"}}, "points": map[string]interface{}{"$lt": 3}}, 3},
+		{map[string]interface{}{"team": "red", "points": 4}, 1},
+	}
+
+	for _, test := range tests {
+		records, err := scores.GetRecord(test.criteria, store)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(records) != test.expected {
+			t.Fatalf("expected %d records for %v, got %d", test.expected, test.criteria, len(records))
+		}
+	}
+	if store.scans["scores"] != 0 {
+		t.Fatalf("expected the index to answer every query, got %d scans", store.scans["scores"])
+	}
+}
+
+func TestIndex_SortsFromIndex(t *testing.T) {
+	store := newCountingStorage()
+	scores := buildCollection(t, store, "scores", scoreFields, scoreDocs())
+	if err := scores.CreateIndex(teamPoints, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	store.reset()
+
+	tests := []struct {
+		criteria map[string]interface{}
+		sort     []schema.SortField
+		expected []float64
+	}{
+		// The equality on team leaves points, which the index orders descending
+		{
+			map[string]interface{}{"team": "red", "points": map[string]interface{}{"$lt": 9}},
+			[]schema.SortField{{Field: "points", Order: schema.Descending}},
+			[]float64{8, 6, 4, 2, 0},
+		},
+		// A sort on every field of the index needs no criteria
+		{
+			map[string]interface{}{},
+			[]schema.SortField{{Field: "team"}, {Field: "points", Order: schema.Descending}},
+			[]float64{19, 17, 15},
+		},
+	}
+
+	for _, test := range tests {
+		records, err := scores.GetRecord(test.criteria, store, &schema.FindOptions{Sort: test.sort, Limit: len(test.expected)})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got := points(records); !reflect.DeepEqual(got, test.expected) {
+			t.Fatalf("expected points %v, got %v", test.expected, got)
+		}
+	}
+	if store.scans["scores"] != 0 {
+		t.Fatalf("expected sorts to read the index, got %d scans", store.scans["scores"])
+	}
+
+	// The opposite direction is sorted in memory
+	records, err := scores.GetRecord(map[string]interface{}{"team": "blue"}, store, &schema.FindOptions{
+		Sort:  []schema.SortField{{Field: "points", Order: schema.Ascending}},
+		Limit: 3,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := points(records); !reflect.DeepEqual(got, []float64{1, 3, 5}) {
+		t.Fatalf("expected points [1 3 5], got %v", got)
+	}
+}
+
+func TestIndex_Multikey(t *testing.T) {
+	store := newCountingStorage()
+	posts, _ := schema.BuildSchema("posts", store)
+	if err := posts.CreateIndex(schema.Index{Name: "tags", Fields: []string{"tags", "year"}}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	docs := []map[string]interface{}{
+		{"tags": "go", "year": 2020},
+		{"tags": []interface{}{"go", "db"}, "year": 2021},
+		{"tags": []interface{}{"db"}, "year": 2022},
+		{"tags": []interface{}{}, "year": 2023},
+	}
+	for _, doc := range docs {
+		if err := posts.AddRecord(doc, MockValidator{}, store); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	store.reset()
+
+	tests := []struct {
+		criteria map[string]interface{}
+		expected int
+	}{
+		{map[string]interface{}{"tags": "go"}, 2},
+		{map[string]interface{}{"tags": "db", "year": map[string]interface{}{"$gte": 2022}}, 1},
+		{map[string]interface{}{"tags": map[string]interface{}{"$in": []interface{}{"go", "db"}}}, 3},
+	}
+
+	for _, test := range tests {
+		count, err := posts.Count(test.criteria, store)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if count != test.expected {
+			t.Fatalf("expected a count of %d for %v, got %d", test.expected, test.criteria, count)
+		}
+	}
+	if store.scans["posts"] != 0 {
+		t.Fatalf("expected the multikey index to answer every query, got %d scans", store.scans["posts"])
+	}
+
+	// Removing an array removes the entry for each element
+	if _, err := posts.UpdateRecords(map[string]interface{}{"year": 2021}, map[string]interface{}{"tags": "db"}, MockValidator{}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	count, err := posts.Count(map[string]interface{}{"tags": "go"}, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 record after the update, got %d", count)
+	}
+}
+
+func TestIndex_GoTypedRecords(t *testing.T) {
+	store := newCountingStorage()
+	posts, _ := schema.BuildSchema("posts", store)
+	if err := posts.CreateIndex(schema.Index{Name: "tags", Fields: []string{"tags"}}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := posts.CreateIndex(schema.Index{Name: "year", Fields: []string{"year"}, Type: schema.HashIndex}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Records are indexed as they are stored, not as Go values
+	doc := map[string]interface{}{"tags": []string{"go", "db"}, "year": int64(2021)}
+	if err := posts.AddRecord(doc, MockValidator{}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	store.reset()
+
+	for _, criteria := range []map[string]interface{}{{"tags": "go"}, {"tags": "db"}, {"year": 2021}} {
+		count, err := posts.Count(criteria, store)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if count != 1 {
+			t.Fatalf("expected 1 record for %v, got %d", criteria, count)
+		}
+	}
+	if store.scans["posts"] != 0 {
+		t.Fatalf("expected the indexes to answer every query, got %d scans", store.scans["posts"])
+	}
+}
+
+func TestIndex_PathsMatchScan(t *testing.T) {
+	store := newCountingStorage()
+	orders := buildCollection(t, store, "orders", nil, []map[string]interface{}{
+		{"items": []interface{}{map[string]interface{}{"sku": "a", "tags": []interface{}{"x", "y"}}}},
+		{"items": []interface{}{map[string]interface{}{"sku": "b"}, map[string]interface{}{"sku": "a", "tags": []interface{}{"z"}}}},
+		{"items": []interface{}{}},
+		{"items": map[string]interface{}{"sku": "c", "tags": "x"}},
+		{"other": true},
+	})
+
+	queries := []map[string]interface{}{
+		{"items.0.sku": "a"},
+		{"items.1.sku": "a"},
+		{"items.0.sku": nil},
+		{"items.sku": "a"},
+		{"items.sku": map[string]interface{}{"$in": []interface{}{"b", "c"}}},
+		{"items.sku": nil},
+		{"items.tags": "x"},
+		{"items.tags": map[string]interface{}{"$gte": "y"}},
+		{"items.tags": nil},
+	}
+	counts := func() []int {
+		found := make([]int, len(queries))
+		for i, criteria := range queries {
+			count, err := orders.Count(criteria, store)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			found[i] = count
+		}
+		return found
+	}
+
+	// An index reads paths the way criteria do, so it finds what a scan finds
+	scanned := counts()
+	if !reflect.DeepEqual(scanned, []int{1, 1, 3, 2, 2, 2, 2, 2, 2}) {
+		t.Fatalf("unexpected scan results %v", scanned)
+	}
+	for _, field := range []string{"items.0.sku", "items.1.sku", "items.sku", "items.tags"} {
+		if err := orders.CreateIndex(schema.Index{Name: field, Fields: []string{field}}, store); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	store.reset()
+	if indexed := counts(); !reflect.DeepEqual(indexed, scanned) {
+		t.Fatalf("expected the indexes to match a scan, got %v and %v", indexed, scanned)
+	}
+	if store.scans["orders"] != 0 {
+		t.Fatalf("expected the indexes to answer every query, got %d scans", store.scans["orders"])
+	}
+}
+
+func TestIndex_RejectsInvalidOrders(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	people := buildCollection(t, store, "people", personFields, personDocs())
+
+	invalid := []schema.Index{
+		{Name: "a", Fields: []string{"age"}, Orders: []schema.SortOrder{schema.Ascending, schema.Descending}},
+		{Name: "b", Fields: []string{"age"}, Orders: []schema.SortOrder{2}},
+	}
+	for _, definition := range invalid {
+		if err := people.CreateIndex(definition, store); err == nil {
+			t.Fatalf("expected an error for %s", fmt.Sprint(definition))
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/adityaparmar9813/NAP/internal/schema"
+	"github.com/adityaparmar9813/NAP/internal/storage"
+)
+
+func TestCount(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	users := buildCollection(t, store, "users", userFields, userDocs())
+
+	tests := []struct {
+		criteria map[string]interface{}
+		expected int
+	}{
+		{map[string]interface{}{}, 3},
+		{map[string]interface{}{"age": 25}, 2},
+		{map[string]interface{}{"age": map[string]interface{}{"$gt": 40}}, 0},
+		{map[string]interface{}{"$or": []interface{}{
+			map[string]interface{}{"age": 30},
+			map[string]interface{}{"name": "Jim Doe"},
+		}}, 2},
+	}
+
+	for _, test := range tests {
+		count, err := users.Count(test.criteria, store)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if count != test.expected {
+			t.Fatalf("expected %d records for %v, got %d", test.expected, test.criteria, count)
+		}
+	}
+
+	if _, err := users.Count(map[string]interface{}{"age": map[string]interface{}{"$near": 1}}, store); err == nil {
+		t.Fatalf("expected an error for invalid criteria")
+	}
+}
+
+func TestExists(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	users := buildCollection(t, store, "users", userFields, userDocs())
+
+	exists, err := users.Exists(map[string]interface{}{"name": "Jane Doe"}, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !exists {
+		t.Fatalf("expected a matching record to exist")
+	}
+
+	exists, err = users.Exists(map[string]interface{}{"name": "Nobody"}, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exists {
+		t.Fatalf("expected no matching record")
+	}
+}
+
+func TestDistinct(t *testing.T) {
+	memoryStorage := storage.NewMemoryStorage()
+	posts, _ := schema.BuildSchema("posts", memoryStorage)
+	docs := []map[string]interface{}{
+		{"tags": []interface{}{"go", "db"}, "author": map[string]interface{}{"name": "ansh"}, "views": 10},
+		{"tags": []interface{}{"db"}, "author": map[string]interface{}{"name": "arpit"}, "views": 10.0},
+		{"tags": "go", "author": map[string]interface{}{"name": "ansh"}, "views": 3},
+		{"author": map[string]interface{}{"name": "aditya"}},
+	}
+	for _, doc := range docs {
+		if err := posts.AddRecord(doc, MockValidator{}, memoryStorage); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	tests := []struct {
+		field    string
+		criteria map[string]interface{}
+		expected []interface{}
+	}{
+		{"tags", map[string]interface{}{}, []interface{}{"db", "go"}},
+		{"author.name", map[string]interface{}{}, []interface{}{"aditya", "ansh", "arpit"}},
+		{"views", map[string]interface{}{}, []interface{}{float64(3), float64(10)}},
+		{"author.name", map[string]interface{}{"tags": "db"}, []interface{}{"ansh", "arpit"}},
+		{"missing", map[string]interface{}{}, []interface{}{}},
+	}
+
+	for _, test := range tests {
+		values, err := posts.Distinct(test.field, test.criteria, memoryStorage)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !reflect.DeepEqual(values, test.expected) {
+			t.Fatalf("expected %v for %s, got %v", test.expected, test.field, values)
+		}
+	}
+}
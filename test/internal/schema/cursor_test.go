@@ -0,0 +1,221 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/adityaparmar9813/NAP/internal/schema"
+)
+
+// numberDocs returns count documents numbered from 0
+func numberDocs(count int) []map[string]interface{} {
+	docs := make([]map[string]interface{}, count)
+	for i := range docs {
+		docs[i] = map[string]interface{}{"n": i, "label": fmt.Sprint("number ", i)}
+	}
+	return docs
+}
+
+func TestCursor_IteratesAllRecords(t *testing.T) {
+	store := newCountingStorage()
+	numbers := buildCollection(t, store, "numbers", nil, numberDocs(25))
+	ctx := context.Background()
+
+	cursor, err := numbers.Find(ctx, map[string]interface{}{}, store, &schema.FindOptions{BatchSize: 4})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer cursor.Close()
+
+	seen := make(map[float64]bool)
+	lastUUID := ""
+	for cursor.Next(ctx) {
+		var record map[string]interface{}
+		if err := cursor.Decode(&record); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if record["uuid"].(string) <= lastUUID {
+			t.Fatalf("expected records in uuid order")
+		}
+		lastUUID = record["uuid"].(string)
+		seen[record["n"].(float64)] = true
+	}
+	if err := cursor.Err(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(seen) != 25 {
+		t.Fatalf("expected 25 records, got %d", len(seen))
+	}
+	if cursor.Next(ctx) {
+		t.Fatalf("expected exhausted cursor to stay exhausted")
+	}
+}
+
+func TestCursor_DecodeStruct(t *testing.T) {
+	store := newCountingStorage()
+	numbers := buildCollection(t, store, "numbers", nil, numberDocs(3))
+	ctx := context.Background()
+
+	cursor, _ := numbers.Find(ctx, map[string]interface{}{"n": 2}, store)
+	defer cursor.Close()
+
+	var record struct {
+		N     int    `json:"n"`
+		Label string `json:"label"`
+	}
+	if err := cursor.Decode(&record); err == nil {
+		t.Fatalf("expected error decoding before Next, got none")
+	}
+	if !cursor.Next(ctx) {
+		t.Fatalf("expected a record, got none: %v", cursor.Err())
+	}
+	if err := cursor.Decode(&record); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if record.N != 2 || record.Label != "number 2" {
+		t.Fatalf("expected number 2, got %+v", record)
+	}
+}
+
+func TestCursor_ReadsLazily(t *testing.T) {
+	store := newCountingStorage()
+	numbers := buildCollection(t, store, "numbers", nil, numberDocs(500))
+	ctx := context.Background()
+
+	cursor, _ := numbers.Find(ctx, map[string]interface{}{}, store, &schema.FindOptions{BatchSize: 10})
+	for i := 0; i < 5; i++ {
+		if !cursor.Next(ctx) {
+			t.Fatalf("expected a record, got none: %v", cursor.Err())
+		}
+	}
+	cursor.Close()
+
+	// The producer reads at most the batch being consumed, one queued batch
+	// and the one it is filling
+	if scanned := atomic.LoadInt64(&store.scanned); scanned > 31 {
+		t.Fatalf("expected at most 31 records to be read, got %d", scanned)
+	}
+
+	if cursor.Next(ctx) {
+		t.Fatalf("expected closed cursor to return no records")
+	}
+	if err := cursor.Decode(&map[string]interface{}{}); !errors.Is(err, schema.ErrCursorClosed) {
+		t.Fatalf("expected cursor closed, got %v", err)
+	}
+	if err := cursor.Close(); err != nil {
+		t.Fatalf("expected second Close to succeed, got %v", err)
+	}
+}
+
+func TestCursor_ReadsIndexLazily(t *testing.T) {
+	store := newCountingStorage()
+	numbers := buildCollection(t, store, "numbers", nil, numberDocs(500))
+	if err := numbers.CreateIndex(schema.Index{Name: "n", Fields: []string{"n"}}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	ctx := context.Background()
+	store.reset()
+
+	cursor, _ := numbers.Find(ctx, map[string]interface{}{"n": map[string]interface{}{"$gte": 0}}, store, &schema.FindOptions{BatchSize: 10})
+	defer cursor.Close()
+	for i := 0; i < 5; i++ {
+		if !cursor.Next(ctx) {
+			t.Fatalf("expected a record, got none: %v", cursor.Err())
+		}
+	}
+	if fetched := atomic.LoadInt64(&store.fetched); fetched > 31 {
+		t.Fatalf("expected at most 31 records to be read, got %d", fetched)
+	}
+
+	// The index is read as the cursor goes, without being locked, so a
+	// record added past the cursor's position is still found
+	if err := numbers.AddRecord(map[string]interface{}{"n": 1000}, MockValidator{}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	last := 0.0
+	count := 5
+	for cursor.Next(ctx) {
+		var record map[string]interface{}
+		if err := cursor.Decode(&record); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		last = record["n"].(float64)
+		count++
+	}
+	if err := cursor.Err(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if count != 501 || last != 1000 {
+		t.Fatalf("expected 501 records ending with the new one, got %d ending with %v", count, last)
+	}
+}
+
+func TestCursor_Cancellation(t *testing.T) {
+	store := newCountingStorage()
+	numbers := buildCollection(t, store, "numbers", nil, numberDocs(50))
+
+	// Cancelling the context passed to Next
+	cursor, _ := numbers.Find(context.Background(), map[string]interface{}{}, store, &schema.FindOptions{BatchSize: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	cursor.Next(ctx)
+	cancel()
+	for cursor.Next(ctx) {
+	}
+	if !errors.Is(cursor.Err(), context.Canceled) {
+		t.Fatalf("expected context canceled, got %v", cursor.Err())
+	}
+	cursor.Close()
+
+	// Cancelling the context the cursor was opened with
+	findCtx, cancelFind := context.WithCancel(context.Background())
+	cursor, _ = numbers.Find(findCtx, map[string]interface{}{}, store, &schema.FindOptions{BatchSize: 1})
+	cancelFind()
+	count := 0
+	for cursor.Next(context.Background()) {
+		count++
+	}
+	if !errors.Is(cursor.Err(), context.Canceled) || count == 50 {
+		t.Fatalf("expected cancellation to stop the cursor, got %d records and %v", count, cursor.Err())
+	}
+	cursor.Close()
+}
+
+func TestCursor_SortSkipLimit(t *testing.T) {
+	store := newCountingStorage()
+	numbers := buildCollection(t, store, "numbers", nil, numberDocs(30))
+	ctx := context.Background()
+
+	cursor, err := numbers.Find(ctx, map[string]interface{}{"n": map[string]interface{}{"$lt": 20}}, store, &schema.FindOptions{
+		Sort:       []schema.SortField{{Field: "n", Order: schema.Descending}},
+		Skip:       2,
+		Limit:      5,
+		BatchSize:  2,
+		Projection: map[string]interface{}{"n": 1, "uuid": 0},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer cursor.Close()
+
+	var got []float64
+	for cursor.Next(ctx) {
+		var record map[string]interface{}
+		cursor.Decode(&record)
+		if len(record) != 1 {
+			t.Fatalf("expected projected record, got %v", record)
+		}
+		got = append(got, record["n"].(float64))
+	}
+
+	expected := []float64{17, 16, 15, 14, 13}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	if _, err := numbers.Find(ctx, map[string]interface{}{}, store, &schema.FindOptions{BatchSize: -1}); err == nil {
+		t.Fatalf("expected error for negative batch size, got none")
+	}
+}
@@ -0,0 +1,142 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/adityaparmar9813/NAP/internal/schema"
+	"github.com/adityaparmar9813/NAP/internal/storage"
+)
+
+// contactDocs returns people with addresses, in no particular order of name
+func contactDocs() []map[string]interface{} {
+	return []map[string]interface{}{
+		{"name": "Carol", "age": 30, "address": map[string]interface{}{"city": "Pune", "zip": "411001"}, "password": "c"},
+		{"name": "alice", "age": 25, "address": map[string]interface{}{"city": "Delhi", "zip": "110001"}, "password": "a"},
+		{"name": "Bob", "age": 30, "address": map[string]interface{}{"city": "Agra", "zip": "282001"}, "password": "b"},
+		{"name": "Dave", "tags": []interface{}{"z", "b"}, "password": "d"},
+	}
+}
+
+func names(records []map[string]interface{}) []interface{} {
+	var result []interface{}
+	for _, record := range records {
+		result = append(result, record["name"])
+	}
+	return result
+}
+
+func TestGetRecord_Sort(t *testing.T) {
+	memoryStorage := storage.NewMemoryStorage()
+	people := buildCollection(t, memoryStorage, "people", nil, contactDocs())
+
+	records, err := people.GetRecord(map[string]interface{}{}, memoryStorage, &schema.FindOptions{
+		Sort: []schema.SortField{{Field: "age", Order: schema.Descending}, {Field: "name"}},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Missing ages sort before numbers, so Dave is last in descending order
+	expected := []interface{}{"Bob", "Carol", "alice", "Dave"}
+	if got := names(records); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	records, _ = people.GetRecord(map[string]interface{}{}, memoryStorage, &schema.FindOptions{
+		Sort: []schema.SortField{{Field: "address.city", Order: schema.Ascending}},
+	})
+	expected = []interface{}{"Dave", "Bob", "alice", "Carol"}
+	if got := names(records); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestGetRecord_DeterministicOrder(t *testing.T) {
+	memoryStorage := storage.NewMemoryStorage()
+	people := buildCollection(t, memoryStorage, "people", nil, contactDocs())
+
+	records, _ := people.GetRecord(map[string]interface{}{}, memoryStorage)
+	for i := 1; i < len(records); i++ {
+		if records[i-1]["uuid"].(string) >= records[i]["uuid"].(string) {
+			t.Fatalf("expected records in uuid order, got %v", records)
+		}
+	}
+
+	// Ties on the sort key fall back to uuid order as well
+	sorted, _ := people.GetRecord(map[string]interface{}{"age": 30}, memoryStorage, &schema.FindOptions{
+		Sort: []schema.SortField{{Field: "age"}},
+	})
+	if len(sorted) != 2 || sorted[0]["uuid"].(string) > sorted[1]["uuid"].(string) {
+		t.Fatalf("expected ties in uuid order, got %v", sorted)
+	}
+}
+
+func TestGetRecord_SkipAndLimit(t *testing.T) {
+	memoryStorage := storage.NewMemoryStorage()
+	people := buildCollection(t, memoryStorage, "people", nil, contactDocs())
+	sortByName := []schema.SortField{{Field: "name"}}
+
+	records, err := people.GetRecord(map[string]interface{}{}, memoryStorage, &schema.FindOptions{Sort: sortByName, Skip: 1, Limit: 2})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := []interface{}{"Carol", "Dave"}
+	if got := names(records); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	records, _ = people.GetRecord(map[string]interface{}{}, memoryStorage, &schema.FindOptions{Skip: 10})
+	if len(records) != 0 {
+		t.Fatalf("expected no records, got %v", records)
+	}
+
+	all, _ := people.GetRecord(map[string]interface{}{}, memoryStorage)
+	limited, _ := people.GetRecord(map[string]interface{}{}, memoryStorage, &schema.FindOptions{Skip: 1, Limit: 2})
+	if !reflect.DeepEqual(limited, all[1:3]) {
+		t.Fatalf("expected %v, got %v", all[1:3], limited)
+	}
+
+	if _, err := people.GetRecord(map[string]interface{}{}, memoryStorage, &schema.FindOptions{Limit: -1}); err == nil {
+		t.Fatalf("expected error for negative limit, got none")
+	}
+}
+
+func TestGetRecord_Projection(t *testing.T) {
+	memoryStorage := storage.NewMemoryStorage()
+	people := buildCollection(t, memoryStorage, "people", nil, contactDocs())
+	criteria := map[string]interface{}{"name": "Bob"}
+
+	records, err := people.GetRecord(criteria, memoryStorage, &schema.FindOptions{
+		Projection: map[string]interface{}{"name": 1, "address.city": 1},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	record := records[0]
+	if _, hasUUID := record["uuid"]; !hasUUID || len(record) != 3 {
+		t.Fatalf("expected name, address and uuid, got %v", record)
+	}
+	if !reflect.DeepEqual(record["address"], map[string]interface{}{"city": "Agra"}) {
+		t.Fatalf("expected only the city, got %v", record["address"])
+	}
+
+	records, _ = people.GetRecord(criteria, memoryStorage, &schema.FindOptions{
+		Projection: map[string]interface{}{"password": 0, "address.zip": false, "uuid": 0},
+	})
+	expected := map[string]interface{}{"name": "Bob", "age": float64(30), "address": map[string]interface{}{"city": "Agra"}}
+	if !reflect.DeepEqual(records[0], expected) {
+		t.Fatalf("expected %v, got %v", expected, records[0])
+	}
+
+	invalid := []map[string]interface{}{
+		{"name": 1, "password": 0},
+		{"address": 1, "address.city": 1},
+		{"name": 2},
+	}
+	for _, projection := range invalid {
+		if _, err := people.GetRecord(criteria, memoryStorage, &schema.FindOptions{Projection: projection}); err == nil {
+			t.Fatalf("expected error for projection %v, got none", projection)
+		}
+	}
+}
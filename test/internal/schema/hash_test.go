@@ -0,0 +1,120 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/adityaparmar9813/NAP/internal/schema"
+	"github.com/adityaparmar9813/NAP/internal/storage"
+	"github.com/adityaparmar9813/NAP/internal/types"
+	"github.com/adityaparmar9813/NAP/internal/validator"
+)
+
+var memberFields = []Field{
+	{Name: "email", Type: types.TypeString, Required: true},
+	{Name: "plan", Type: types.TypeString, Required: true},
+}
+
+// memberDocs returns count members split between two plans
+func memberDocs(count int) []map[string]interface{} {
+	docs := make([]map[string]interface{}, count)
+	for i := range docs {
+		docs[i] = map[string]interface{}{"email": fmt.Sprintf("member%d@example.com", i), "plan": []string{"free", "pro"}[i%2]}
+	}
+	return docs
+}
+
+func TestHashIndex_AnswersEquality(t *testing.T) {
+	store := newCountingStorage()
+	members := buildCollection(t, store, "members", memberFields, memberDocs(50))
+	if err := members.CreateIndex(schema.Index{Name: "email", Fields: []string{"email"}, Type: schema.HashIndex}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	store.reset()
+
+	tests := []struct {
+		criteria map[string]interface{}
+		expected int
+	}{
+		{map[string]interface{}{"email": "member7@example.com"}, 1},
+		{map[string]interface{}{"email": map[string]interface{}{"$eq": "member8@example.com"}}, 1},
+		{map[string]interface{}{"email": map[string]interface{}{"$in": []interface{}{"member1@example.com", "member2@example.com", "nobody"}}}, 2},
+		{map[string]interface{}{"email": "member3@example.com", "plan": "free"}, 0},
+	}
+	for _, test := range tests {
+		records, err := members.GetRecord(test.criteria, store)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(records) != test.expected {
+			t.Fatalf("expected %d records for %v, got %d", test.expected, test.criteria, len(records))
+		}
+	}
+	if store.scans["members"] != 0 {
+		t.Fatalf("expected the hash index to answer every query, got %d scans", store.scans["members"])
+	}
+
+	// Ranges cannot be answered from a hash index
+	count, err := members.Count(map[string]interface{}{"email": map[string]interface{}{"$gte": "member4"}}, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if count != 16 || store.scans["members"] != 1 {
+		t.Fatalf("expected 16 records from a scan, got %d from %d scans", count, store.scans["members"])
+	}
+}
+
+func TestHashIndex_Unique(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	members := buildCollection(t, store, "members", memberFields, memberDocs(3))
+	definition := schema.Index{Name: "email", Fields: []string{"email"}, Type: schema.HashIndex, Unique: true}
+	if err := members.CreateIndex(definition, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	err := members.AddRecord(map[string]interface{}{"email": "member1@example.com", "plan": "pro"}, validator.NewValidator(), store)
+	var duplicate *schema.DuplicateKeyError
+	if !errors.As(err, &duplicate) {
+		t.Fatalf("expected a DuplicateKeyError, got %v", err)
+	}
+
+	invalid := schema.Index{Name: "ordered", Fields: []string{"plan"}, Type: schema.HashIndex, Orders: []schema.SortOrder{schema.Descending}}
+	if err := members.CreateIndex(invalid, store); err == nil {
+		t.Fatalf("expected an error for a hash index with orders")
+	}
+}
+
+// benchmarkLookup times finding one member by email among 2000
+func benchmarkLookup(b *testing.B, definition *schema.Index) {
+	store := storage.NewPagedStorage(b.TempDir(), 0)
+	defer store.Close()
+
+	members := buildCollection(b, store, "members", memberFields, memberDocs(2000))
+	if definition != nil {
+		if err := members.CreateIndex(*definition, store); err != nil {
+			b.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		criteria := map[string]interface{}{"email": fmt.Sprintf("member%d@example.com", i%2000)}
+		records, err := members.GetRecord(criteria, store)
+		if err != nil || len(records) != 1 {
+			b.Fatalf("expected 1 record, got %d (%v)", len(records), err)
+		}
+	}
+}
+
+func BenchmarkGetRecord_FullScan(b *testing.B) {
+	benchmarkLookup(b, nil)
+}
+
+func BenchmarkGetRecord_HashIndex(b *testing.B) {
+	benchmarkLookup(b, &schema.Index{Name: "email", Fields: []string{"email"}, Type: schema.HashIndex})
+}
+
+func BenchmarkGetRecord_BTreeIndex(b *testing.B) {
+	benchmarkLookup(b, &schema.Index{Name: "email", Fields: []string{"email"}})
+}
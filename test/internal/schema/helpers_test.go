@@ -0,0 +1,65 @@
+package schema
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/adityaparmar9813/NAP/internal/schema"
+	"github.com/adityaparmar9813/NAP/internal/storage"
+	"github.com/adityaparmar9813/NAP/internal/validator"
+)
+
+// buildCollection builds the schema name with fields and adds docs to it.
+// Each doc gets the uuid it was stored under.
+func buildCollection(tb testing.TB, store storage.StorageInterface, name string, fields []Field, docs []map[string]interface{}) *schema.Schema {
+	tb.Helper()
+
+	collection, err := schema.BuildSchema(name, store, fields...)
+	if err != nil {
+		tb.Fatalf("expected no error, got %v", err)
+	}
+	for _, doc := range docs {
+		if err := collection.AddRecord(doc, validator.NewValidator(), store); err != nil {
+			tb.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	return collection
+}
+
+// countingStorage is a memory store that counts the scans of each
+// collection, the records they hand out and the records read with Get
+type countingStorage struct {
+	storage.StorageInterface
+	scans   map[string]int
+	scanned int64
+	fetched int64
+}
+
+func newCountingStorage() *countingStorage {
+	return &countingStorage{StorageInterface: storage.NewMemoryStorage(), scans: map[string]int{}}
+}
+
+// reset sets every count back to zero
+func (cs *countingStorage) reset() {
+	cs.scans = map[string]int{}
+	atomic.StoreInt64(&cs.scanned, 0)
+	atomic.StoreInt64(&cs.fetched, 0)
+}
+
+func (cs *countingStorage) Scan(collection string, fn func(key string, data []byte) error) error {
+	return cs.ScanFrom(collection, "", fn)
+}
+
+func (cs *countingStorage) ScanFrom(collection, start string, fn func(key string, data []byte) error) error {
+	cs.scans[collection]++
+	return cs.StorageInterface.ScanFrom(collection, start, func(key string, data []byte) error {
+		atomic.AddInt64(&cs.scanned, 1)
+		return fn(key, data)
+	})
+}
+
+func (cs *countingStorage) Get(collection, key string, v interface{}) error {
+	atomic.AddInt64(&cs.fetched, 1)
+	return cs.StorageInterface.Get(collection, key, v)
+}
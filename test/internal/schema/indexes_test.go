@@ -0,0 +1,302 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/adityaparmar9813/NAP/internal/schema"
+	"github.com/adityaparmar9813/NAP/internal/types"
+	"github.com/adityaparmar9813/NAP/internal/validator"
+)
+
+var personFields = []Field{
+	{Name: "name", Type: types.TypeString, Required: true},
+	{Name: "age", Type: types.TypeInt, Required: false},
+}
+
+// personDocs returns 30 people aged 20 to 29, the last one without an age
+func personDocs() []map[string]interface{} {
+	docs := make([]map[string]interface{}, 30)
+	for i := range docs {
+		docs[i] = map[string]interface{}{"name": fmt.Sprintf("person %02d", i), "age": 20 + i%10}
+	}
+	delete(docs[29], "age")
+	return docs
+}
+
+func TestIndex_AnswersQueries(t *testing.T) {
+	store := newCountingStorage()
+	people := buildCollection(t, store, "people", personFields, personDocs())
+	if err := people.CreateIndex(schema.Index{Name: "age", Fields: []string{"age", "name"}}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	store.reset()
+
+	tests := []struct {
+		criteria map[string]interface{}
+		expected int
+	}{
+		{map[string]interface{}{"age": 25}, 3},
+		{map[string]interface{}{"age": map[string]interface{}{"$gte": 27}}, 8},
+		{map[string]interface{}{"age": map[string]interface{}{"$gt": 21, "$lt": 24}}, 6},
+		{map[string]interface{}{"age": map[string]interface{}{"$in": []interface{}{20, 29, 99}}}, 5},
+		{map[string]interface{}{"age": map[string]interface{}{"$lt": "z"}}, 0},
+		{map[string]interface{}{"age": nil}, 1},
+		{map[string]interface{}{"$and": []interface{}{
+			map[string]interface{}{"age": map[string]interface{}{"$gte": 25}},
+			map[string]interface{}{"age": map[string]interface{}{"$lte": 25}},
+		}}, 3},
+		{map[string]interface{}{"age": 22, "name": "person 12"}, 1},
+	}
+
+	for _, test := range tests {
+		records, err := people.GetRecord(test.criteria, store)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(records) != test.expected {
+			t.Fatalf("expected %d records for %v, got %d", test.expected, test.criteria, len(records))
+		}
+
+		count, err := people.Count(test.criteria, store)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if count != test.expected {
+			t.Fatalf("expected a count of %d for %v, got %d", test.expected, test.criteria, count)
+		}
+	}
+
+	if store.scans["people"] != 0 {
+		t.Fatalf("expected every query to use the index, got %d scans", store.scans["people"])
+	}
+
+	// A query the index cannot answer still works by scanning
+	records, err := people.GetRecord(map[string]interface{}{"age": map[string]interface{}{"$ne": 25}}, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(records) != 27 || store.scans["people"] != 1 {
+		t.Fatalf("expected 27 records from one scan, got %d from %d", len(records), store.scans["people"])
+	}
+}
+
+func TestIndex_StaysConsistent(t *testing.T) {
+	store := newCountingStorage()
+	people := buildCollection(t, store, "people", personFields, personDocs())
+	if err := people.CreateIndex(schema.Index{Name: "age", Fields: []string{"age", "name"}}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	store.reset()
+	v := validator.NewValidator()
+
+	if _, err := people.UpdateRecords(map[string]interface{}{"age": 25}, map[string]interface{}{"$inc": map[string]interface{}{"age": 100}}, v, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := people.DeleteRecords(map[string]interface{}{"age": 26}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	records, _ := people.GetRecord(map[string]interface{}{"age": 27}, store)
+	if err := people.DeleteRecordByUUID(records[0]["uuid"].(string), store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := people.ReplaceRecord(records[1]["uuid"].(string), map[string]interface{}{"name": "replaced", "age": 1}, v, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := people.AddRecord(map[string]interface{}{"name": "new", "age": 125}, v, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		criteria map[string]interface{}
+		expected int
+	}{
+		{map[string]interface{}{"age": 25}, 0},
+		{map[string]interface{}{"age": 125}, 4},
+		{map[string]interface{}{"age": 26}, 0},
+		{map[string]interface{}{"age": 27}, 1},
+		{map[string]interface{}{"age": 1}, 1},
+		{map[string]interface{}{"age": map[string]interface{}{"$gte": 0}}, 26},
+	}
+	for _, test := range tests {
+		count, err := people.Count(test.criteria, store)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if count != test.expected {
+			t.Fatalf("expected a count of %d for %v, got %d", test.expected, test.criteria, count)
+		}
+	}
+}
+
+func TestIndex_StateBelongsToCatalog(t *testing.T) {
+	store := newCountingStorage()
+	catalog, err := schema.LoadCatalog(store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	first, err := catalog.Create("people", Field{Name: "name", Type: types.TypeString, Required: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := first.CreateIndex(schema.Index{Name: "name", Fields: []string{"name"}}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Every user of the collection shares its indexes
+	second, err := catalog.Create("people", Field{Name: "name", Type: types.TypeString, Required: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := second.AddRecord(map[string]interface{}{"name": "ada"}, validator.NewValidator(), store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	store.reset()
+	count, err := first.Count(map[string]interface{}{"name": "ada"}, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if count != 1 || store.scans["people"] != 0 {
+		t.Fatalf("expected the index to hold the record, got %d from %d scans", count, store.scans["people"])
+	}
+
+	// A collection defined again after a drop starts without the old indexes
+	if err := catalog.Drop("people"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	recreated, err := catalog.Create("people", Field{Name: "name", Type: types.TypeString, Required: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := recreated.AddRecord(map[string]interface{}{"name": "ada"}, validator.NewValidator(), store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	store.reset()
+	count, err = recreated.Count(map[string]interface{}{"name": "ada"}, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if count != 1 || store.scans["people"] != 1 {
+		t.Fatalf("expected 1 record from a scan, got %d from %d scans", count, store.scans["people"])
+	}
+	if err := recreated.DropIndex("name", store); !errors.Is(err, schema.ErrIndexNotFound) {
+		t.Fatalf("expected ErrIndexNotFound, got %v", err)
+	}
+}
+
+func TestIndex_PersistsWithSchema(t *testing.T) {
+	store := newCountingStorage()
+	people := buildCollection(t, store, "people", personFields, personDocs())
+	if err := people.CreateIndex(schema.Index{Name: "age", Fields: []string{"age", "name"}}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	store.reset()
+
+	catalog, err := schema.LoadCatalog(store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	reloaded, err := catalog.Get(people.Name)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := []schema.Index{{Name: "age", Fields: []string{"age", "name"}}}
+	if !reflect.DeepEqual(reloaded.Indexes, expected) {
+		t.Fatalf("expected %v, got %v", expected, reloaded.Indexes)
+	}
+
+	count, err := reloaded.Count(map[string]interface{}{"age": 20}, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if count != 3 || store.scans["people"] != 0 {
+		t.Fatalf("expected 3 records from the index, got %d from %d scans", count, store.scans["people"])
+	}
+
+	// Building the schema again keeps its indexes
+	rebuilt, err := schema.BuildSchema("people", store,
+		Field{Name: "name", Type: types.TypeString, Required: true},
+		Field{Name: "age", Type: types.TypeInt, Required: false},
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(rebuilt.Indexes, expected) {
+		t.Fatalf("expected %v, got %v", expected, rebuilt.Indexes)
+	}
+
+	if err := catalog.Drop(people.Name); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	nodes := 0
+	store.Scan("_index.people.age", func(key string, data []byte) error {
+		nodes++
+		return nil
+	})
+	if nodes != 0 {
+		t.Fatalf("expected dropping the collection to drop its indexes, got %d nodes", nodes)
+	}
+}
+
+func TestIndex_CreateAndDrop(t *testing.T) {
+	store := newCountingStorage()
+	people := buildCollection(t, store, "people", personFields, personDocs())
+	if err := people.CreateIndex(schema.Index{Name: "age", Fields: []string{"age", "name"}}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	store.reset()
+
+	if err := people.CreateIndex(schema.Index{Name: "age", Fields: []string{"age", "name"}}, store); err != nil {
+		t.Fatalf("expected creating the same index again to succeed, got %v", err)
+	}
+	if err := people.CreateIndex(schema.Index{Name: "age", Fields: []string{"age"}}, store); !errors.Is(err, schema.ErrIndexExists) {
+		t.Fatalf("expected ErrIndexExists, got %v", err)
+	}
+	if err := people.CreateIndex(schema.Index{Name: "bad", Fields: []string{"age", "age"}}, store); err == nil {
+		t.Fatalf("expected an error for a repeated field")
+	}
+
+	if err := people.DropIndex("age", store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := people.DropIndex("age", store); !errors.Is(err, schema.ErrIndexNotFound) {
+		t.Fatalf("expected ErrIndexNotFound, got %v", err)
+	}
+
+	count, err := people.Count(map[string]interface{}{"age": 20}, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if count != 3 || store.scans["people"] != 1 {
+		t.Fatalf("expected 3 records from a scan, got %d from %d scans", count, store.scans["people"])
+	}
+}
+
+func TestIndex_Distinct(t *testing.T) {
+	store := newCountingStorage()
+	people := buildCollection(t, store, "people", personFields, personDocs())
+	if err := people.CreateIndex(schema.Index{Name: "age", Fields: []string{"age", "name"}}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	store.reset()
+
+	values, err := people.Distinct("age", map[string]interface{}{"age": map[string]interface{}{"$lt": 23}}, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := []interface{}{float64(20), float64(21), float64(22)}
+	if !reflect.DeepEqual(values, expected) {
+		t.Fatalf("expected %v, got %v", expected, values)
+	}
+
+	values, err = people.Distinct("age", map[string]interface{}{}, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(values) != 10 || store.scans["people"] != 0 {
+		t.Fatalf("expected 10 values from the index, got %v from %d scans", values, store.scans["people"])
+	}
+}
@@ -0,0 +1,223 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/adityaparmar9813/NAP/internal/schema"
+	"github.com/adityaparmar9813/NAP/internal/storage"
+)
+
+// shopUsers returns the users the orders of shopOrders refer to
+func shopUsers() []map[string]interface{} {
+	return []map[string]interface{}{{"name": "ansh"}, {"name": "arpit"}, {"name": "aditya"}}
+}
+
+// shopOrders returns orders that reference users by uuid, once they have
+// been added
+func shopOrders(users []map[string]interface{}) []map[string]interface{} {
+	ansh, arpit, aditya := users[0]["uuid"], users[1]["uuid"], users[2]["uuid"]
+	return []map[string]interface{}{
+		{"number": 1, "user": ansh, "watchers": []interface{}{arpit, "unknown", aditya}},
+		{"number": 2, "user": arpit},
+		{"number": 3, "user": ansh},
+		{"number": 4, "user": "unknown"},
+	}
+}
+
+func TestAggregate_Lookup(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	users := shopUsers()
+	buildCollection(t, store, "users", nil, users)
+	orders := buildCollection(t, store, "orders", nil, shopOrders(users))
+
+	results, err := orders.Aggregate(context.Background(), []map[string]interface{}{
+		{"$lookup": map[string]interface{}{"from": "users", "localField": "user", "foreignField": "uuid", "as": "buyer"}},
+		{"$project": map[string]interface{}{"uuid": 0, "number": 1, "buyer": "$buyer.name"}},
+		{"$sort": map[string]interface{}{"number": 1}},
+	}, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := []map[string]interface{}{
+		{"number": float64(1), "buyer": []interface{}{"ansh"}},
+		{"number": float64(2), "buyer": []interface{}{"arpit"}},
+		{"number": float64(3), "buyer": []interface{}{"ansh"}},
+		{"number": float64(4), "buyer": []interface{}{}},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("expected %v, got %v", expected, results)
+	}
+}
+
+func TestAggregate_LookupReverse(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	buyers := shopUsers()
+	users := buildCollection(t, store, "users", nil, buyers)
+	orders := buildCollection(t, store, "orders", nil, shopOrders(buyers))
+
+	results, err := users.Aggregate(context.Background(), []map[string]interface{}{
+		{"$match": map[string]interface{}{"name": "ansh"}},
+		{"$lookup": map[string]interface{}{"from": orders.Name, "localField": "uuid", "foreignField": "user", "as": "orders"}},
+		{"$unwind": "$orders"},
+		{"$group": map[string]interface{}{"_id": nil, "numbers": map[string]interface{}{"$sum": "$orders.number"}}},
+	}, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := []map[string]interface{}{{"_id": nil, "numbers": float64(4)}}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("expected %v, got %v", expected, results)
+	}
+}
+
+func TestAggregate_LookupThroughArray(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	users := shopUsers()
+	buildCollection(t, store, "users", nil, users)
+	carts := buildCollection(t, store, "carts", nil, []map[string]interface{}{
+		{"number": 1, "items": []interface{}{
+			map[string]interface{}{"user": users[2]["uuid"]},
+			map[string]interface{}{"user": users[0]["uuid"]},
+		}},
+		{"number": 2, "items": []interface{}{map[string]interface{}{"sku": "a"}}},
+		{"number": 3},
+	})
+
+	// The local field reaches into each item, as it does in a query
+	results, err := carts.Aggregate(context.Background(), []map[string]interface{}{
+		{"$lookup": map[string]interface{}{"from": "users", "localField": "items.user", "foreignField": "uuid", "as": "buyers"}},
+		{"$project": map[string]interface{}{"uuid": 0, "number": 1, "buyers": "$buyers.name"}},
+		{"$sort": map[string]interface{}{"number": 1}},
+	}, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Matches come in the order of the users collection, which is by uuid
+	buyers := results[0]["buyers"].([]interface{})
+	sort.Slice(buyers, func(i, j int) bool { return buyers[i].(string) < buyers[j].(string) })
+
+	expected := []map[string]interface{}{
+		{"number": float64(1), "buyers": []interface{}{"aditya", "ansh"}},
+		{"number": float64(2), "buyers": []interface{}{}},
+		{"number": float64(3), "buyers": []interface{}{}},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("expected %v, got %v", expected, results)
+	}
+}
+
+func TestAggregate_LookupErrors(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	users := shopUsers()
+	buildCollection(t, store, "users", nil, users)
+	orders := buildCollection(t, store, "orders", nil, shopOrders(users))
+
+	_, err := orders.Aggregate(context.Background(), []map[string]interface{}{
+		{"$lookup": map[string]interface{}{"from": "missing", "localField": "user", "foreignField": "uuid", "as": "buyer"}},
+	}, store)
+	if !errors.Is(err, schema.ErrCollectionNotFound) {
+		t.Fatalf("expected ErrCollectionNotFound, got %v", err)
+	}
+
+	_, err = orders.Aggregate(context.Background(), []map[string]interface{}{
+		{"$lookup": map[string]interface{}{"from": "users", "localField": "user", "as": "buyer"}},
+	}, store)
+	if err == nil {
+		t.Fatalf("expected an error for a lookup without foreignField")
+	}
+}
+
+func TestGetRecord_Populate(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	users := shopUsers()
+	buildCollection(t, store, "users", nil, users)
+	orders := buildCollection(t, store, "orders", nil, shopOrders(users))
+
+	records, err := orders.GetRecord(map[string]interface{}{}, store, &schema.FindOptions{
+		Sort: []schema.SortField{{Field: "number"}},
+		Populate: []schema.Populate{
+			{Field: "user", From: "users"},
+			{Field: "watchers", From: "users", As: "watching"},
+		},
+		Projection: map[string]interface{}{"uuid": 0, "user.name": 1, "watching.name": 1},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := []map[string]interface{}{
+		{"user": map[string]interface{}{"name": "ansh"}, "watching": []interface{}{
+			map[string]interface{}{"name": "arpit"},
+			map[string]interface{}{"name": "aditya"},
+		}},
+		{"user": map[string]interface{}{"name": "arpit"}},
+		{"user": map[string]interface{}{"name": "ansh"}},
+		{},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Fatalf("expected %v, got %v", expected, records)
+	}
+}
+
+func TestFind_PopulateJoinsWithoutScanning(t *testing.T) {
+	store := newCountingStorage()
+	users := shopUsers()
+	buildCollection(t, store, "users", nil, users)
+	orders := buildCollection(t, store, "orders", nil, shopOrders(users))
+	store.reset()
+
+	records, err := orders.GetRecord(map[string]interface{}{}, store, &schema.FindOptions{
+		BatchSize: 2,
+		Populate:  []schema.Populate{{Field: "user", From: "users"}},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("expected 4 records, got %d", len(records))
+	}
+	// References by uuid are read directly
+	if store.scans["users"] != 0 {
+		t.Fatalf("expected users not to be scanned, got %d scans", store.scans["users"])
+	}
+
+	// Other foreign fields are read once per batch, or through an index
+	records, err = orders.GetRecord(map[string]interface{}{}, store, &schema.FindOptions{
+		BatchSize: 2,
+		Populate:  []schema.Populate{{Field: "number", From: orders.Name, ForeignField: "number", As: "self"}},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	// One scan for the query of each call and one for each batch
+	if len(records) != 4 || store.scans[orders.Name] != 4 {
+		t.Fatalf("expected 4 records and 4 scans, got %d and %d", len(records), store.scans[orders.Name])
+	}
+
+	if err := orders.CreateIndex(schema.Index{Name: "number", Fields: []string{"number"}}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	store.reset()
+	records, err = orders.GetRecord(map[string]interface{}{}, store, &schema.FindOptions{
+		BatchSize: 2,
+		Populate:  []schema.Populate{{Field: "number", From: orders.Name, ForeignField: "number", As: "self"}},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(records) != 4 || store.scans[orders.Name] != 1 {
+		t.Fatalf("expected 4 records and 1 scan, got %d and %d", len(records), store.scans[orders.Name])
+	}
+	for _, record := range records {
+		if self, ok := record["self"].(map[string]interface{}); !ok || self["uuid"] != record["uuid"] {
+			t.Fatalf("expected each order to be joined with itself, got %v", record)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/adityaparmar9813/NAP/internal/schema"
+	"github.com/adityaparmar9813/NAP/internal/storage"
+)
+
+func TestGetPage_WalksAllPages(t *testing.T) {
+	memoryStorage := storage.NewMemoryStorage()
+	users, _ := schema.BuildSchema("users", memoryStorage)
+	for _, name := range []string{"erin", "bob", "dave", "alice", "carol", "bob"} {
+		users.AddRecord(map[string]interface{}{"name": name}, MockValidator{}, memoryStorage)
+	}
+
+	options := &schema.FindOptions{Sort: []schema.SortField{{Field: "name"}}, Limit: 2}
+	var got []interface{}
+	seen := make(map[string]bool)
+	pages := 0
+
+	for {
+		records, next, err := users.GetPage(map[string]interface{}{}, memoryStorage, options)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		pages++
+		for _, record := range records {
+			got = append(got, record["name"])
+			seen[record["uuid"].(string)] = true
+		}
+		if next == "" {
+			break
+		}
+		options = &schema.FindOptions{Sort: options.Sort, Limit: 2, After: next}
+	}
+
+	expected := []interface{}{"alice", "bob", "bob", "carol", "dave", "erin"}
+	if !reflect.DeepEqual(got, expected) || len(seen) != 6 {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	if pages != 3 {
+		t.Fatalf("expected 3 pages, got %d", pages)
+	}
+}
+
+func TestGetPage_StableUnderWrites(t *testing.T) {
+	memoryStorage := storage.NewMemoryStorage()
+	users, _ := schema.BuildSchema("users", memoryStorage)
+	for i := 1; i <= 6; i++ {
+		users.AddRecord(map[string]interface{}{"n": i * 10}, MockValidator{}, memoryStorage)
+	}
+
+	sortByN := []schema.SortField{{Field: "n", Order: schema.Descending}}
+	first, next, err := users.GetPage(map[string]interface{}{}, memoryStorage, &schema.FindOptions{Sort: sortByN, Limit: 3})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fmt.Sprint(first[0]["n"], first[2]["n"]) != "60 40" {
+		t.Fatalf("expected 60 to 40 on the first page, got %v", first)
+	}
+
+	// A record before the token, one after it, and the token's own record
+	// deleted: the next page starts right after 40 regardless
+	users.AddRecord(map[string]interface{}{"n": 55}, MockValidator{}, memoryStorage)
+	users.AddRecord(map[string]interface{}{"n": 25}, MockValidator{}, memoryStorage)
+	users.DeleteRecords(map[string]interface{}{"n": 40}, memoryStorage)
+
+	second, next, err := users.GetPage(map[string]interface{}{}, memoryStorage, &schema.FindOptions{Sort: sortByN, Limit: 3, After: next})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var got []interface{}
+	for _, record := range second {
+		got = append(got, record["n"])
+	}
+	expected := []interface{}{float64(30), float64(25), float64(20)}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	last, next, _ := users.GetPage(map[string]interface{}{}, memoryStorage, &schema.FindOptions{Sort: sortByN, Limit: 3, After: next})
+	if len(last) != 1 || next != "" {
+		t.Fatalf("expected a final page of one record and no token, got %v, %q", last, next)
+	}
+}
+
+func TestGetPage_SeeksToToken(t *testing.T) {
+	store := newCountingStorage()
+	numbers := buildCollection(t, store, "numbers", nil, numberDocs(200))
+	if err := numbers.CreateIndex(schema.Index{Name: "n", Fields: []string{"n"}}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Each page reads about a page of records, however far in it starts:
+	// unsorted pages start the collection scan at the token's uuid, and
+	// pages sorted by an index start the index range at its key
+	for _, sortFields := range [][]schema.SortField{nil, {{Field: "n"}}} {
+		options := &schema.FindOptions{Sort: sortFields, Limit: 10}
+		pages := 0
+		for {
+			store.reset()
+
+			records, next, err := numbers.GetPage(map[string]interface{}{}, store, options)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			pages++
+			if len(records) != 10 {
+				t.Fatalf("expected pages of 10 records, got %d", len(records))
+			}
+			if read := atomic.LoadInt64(&store.scanned) + atomic.LoadInt64(&store.fetched); read > 12 {
+				t.Fatalf("expected page %d sorted by %v to read at most 12 records, got %d", pages, sortFields, read)
+			}
+
+			if next == "" {
+				break
+			}
+			options = &schema.FindOptions{Sort: sortFields, Limit: 10, After: next}
+		}
+		if pages != 20 {
+			t.Fatalf("expected 20 pages, got %d", pages)
+		}
+	}
+}
+
+func TestGetPage_Projection(t *testing.T) {
+	memoryStorage := storage.NewMemoryStorage()
+	users, _ := schema.BuildSchema("users", memoryStorage)
+	for _, name := range []string{"a", "b", "c"} {
+		users.AddRecord(map[string]interface{}{"name": name, "secret": "x"}, MockValidator{}, memoryStorage)
+	}
+
+	// The sort field is projected away, but the token still carries it
+	options := &schema.FindOptions{Sort: []schema.SortField{{Field: "name"}}, Limit: 2, Projection: map[string]interface{}{"secret": 1}}
+	records, next, err := users.GetPage(map[string]interface{}{}, memoryStorage, options)
+	if err != nil || len(records) != 2 || next == "" {
+		t.Fatalf("expected a full page and a token, got %v, %q, %v", records, next, err)
+	}
+	if _, hasName := records[0]["name"]; hasName {
+		t.Fatalf("expected name to be projected away, got %v", records[0])
+	}
+
+	options.After = next
+	records, _, _ = users.GetPage(map[string]interface{}{}, memoryStorage, options)
+	var saved map[string]interface{}
+	memoryStorage.Get("users", records[0]["uuid"].(string), &saved)
+	if len(records) != 1 || saved["name"] != "c" {
+		t.Fatalf("expected c on the second page, got %v", records)
+	}
+}
+
+func TestGetPage_InvalidTokens(t *testing.T) {
+	memoryStorage := storage.NewMemoryStorage()
+	users, _ := schema.BuildSchema("users", memoryStorage)
+	for i := 0; i < 3; i++ {
+		users.AddRecord(map[string]interface{}{"n": i}, MockValidator{}, memoryStorage)
+	}
+
+	sortByN := []schema.SortField{{Field: "n"}}
+	_, next, _ := users.GetPage(map[string]interface{}{}, memoryStorage, &schema.FindOptions{Sort: sortByN, Limit: 1})
+
+	tests := []struct {
+		name     string
+		criteria map[string]interface{}
+		options  *schema.FindOptions
+	}{
+		{"garbage", map[string]interface{}{}, &schema.FindOptions{Sort: sortByN, Limit: 1, After: "not a token!"}},
+		{"different sort", map[string]interface{}{}, &schema.FindOptions{Sort: []schema.SortField{{Field: "n", Order: schema.Descending}}, Limit: 1, After: next}},
+		{"different criteria", map[string]interface{}{"n": 1}, &schema.FindOptions{Sort: sortByN, Limit: 1, After: next}},
+	}
+	for _, test := range tests {
+		_, _, err := users.GetPage(test.criteria, memoryStorage, test.options)
+		if !errors.Is(err, schema.ErrInvalidPageToken) {
+			t.Fatalf("%s: expected invalid page token, got %v", test.name, err)
+		}
+	}
+
+	// An explicit ascending order is the same sort as the default
+	explicit := &schema.FindOptions{Sort: []schema.SortField{{Field: "n", Order: schema.Ascending}}, Limit: 1, After: next}
+	if _, _, err := users.GetPage(map[string]interface{}{}, memoryStorage, explicit); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, _, err := users.GetPage(map[string]interface{}{}, memoryStorage); err == nil {
+		t.Fatalf("expected error without a page size, got none")
+	}
+}
@@ -0,0 +1,130 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/adityaparmar9813/NAP/internal/schema"
+	"github.com/adityaparmar9813/NAP/internal/storage"
+)
+
+// invoiceDocs returns 20 invoices, a quarter of them pending
+func invoiceDocs() []map[string]interface{} {
+	docs := make([]map[string]interface{}, 20)
+	for i := range docs {
+		docs[i] = map[string]interface{}{"status": []string{"pending", "paid", "paid", "void"}[i%4], "dueAt": i}
+	}
+	return docs
+}
+
+// pendingDue indexes only the invoices that are pending
+var pendingDue = schema.Index{
+	Name:   "pending_due",
+	Fields: []string{"dueAt"},
+	Filter: map[string]interface{}{"status": "pending"},
+}
+
+func TestPartialIndex_UsedWhenQueryImpliesFilter(t *testing.T) {
+	store := newCountingStorage()
+	invoices := buildCollection(t, store, "invoices", nil, invoiceDocs())
+	if err := invoices.CreateIndex(pendingDue, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	// Creating it again is recognized as the same index
+	if err := invoices.CreateIndex(pendingDue, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		criteria map[string]interface{}
+		expected int
+		scans    int
+	}{
+		{map[string]interface{}{"status": "pending", "dueAt": map[string]interface{}{"$lt": 10}}, 3, 0},
+		{map[string]interface{}{"status": map[string]interface{}{"$in": []interface{}{"pending"}}, "dueAt": 8}, 1, 0},
+		// Paid invoices are not in the index
+		{map[string]interface{}{"dueAt": map[string]interface{}{"$lt": 10}}, 10, 1},
+		{map[string]interface{}{"status": map[string]interface{}{"$in": []interface{}{"pending", "paid"}}, "dueAt": 1}, 1, 1},
+	}
+
+	for _, test := range tests {
+		store.reset()
+		records, err := invoices.GetRecord(test.criteria, store)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(records) != test.expected {
+			t.Fatalf("expected %d records for %v, got %d", test.expected, test.criteria, len(records))
+		}
+		if store.scans["invoices"] != test.scans {
+			t.Fatalf("expected %d scans for %v, got %d", test.scans, test.criteria, store.scans["invoices"])
+		}
+	}
+}
+
+func TestPartialIndex_FollowsUpdates(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	invoices := buildCollection(t, store, "invoices", nil, invoiceDocs())
+	if err := invoices.CreateIndex(pendingDue, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := invoices.UpdateRecords(map[string]interface{}{"dueAt": 4}, map[string]interface{}{"status": "paid"}, MockValidator{}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := invoices.UpdateRecords(map[string]interface{}{"dueAt": 5}, map[string]interface{}{"status": "pending"}, MockValidator{}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	criteria := map[string]interface{}{"status": "pending", "dueAt": map[string]interface{}{"$lte": 5}}
+	count, err := invoices.Count(criteria, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("expected invoices 0 and 5 to be pending, got %d", count)
+	}
+}
+
+func TestSparseIndex(t *testing.T) {
+	store := newCountingStorage()
+	users, _ := schema.BuildSchema("users", store)
+	definition := schema.Index{Name: "nickname", Fields: []string{"nickname"}, Sparse: true, Unique: true}
+	if err := users.CreateIndex(definition, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Any number of records may leave a sparse unique field out
+	for _, doc := range []map[string]interface{}{{"nickname": "ace"}, {"nickname": "bee"}, {}, {}} {
+		if err := users.AddRecord(doc, MockValidator{}, store); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	store.reset()
+
+	count, err := users.Count(map[string]interface{}{"nickname": "ace"}, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if count != 1 || store.scans["users"] != 0 {
+		t.Fatalf("expected 1 record from the index, got %d from %d scans", count, store.scans["users"])
+	}
+
+	// Records without a nickname are only found by a scan
+	count, err = users.Count(map[string]interface{}{"nickname": nil}, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if count != 2 || store.scans["users"] != 1 {
+		t.Fatalf("expected 2 records from a scan, got %d from %d scans", count, store.scans["users"])
+	}
+}
+
+func TestPartialIndex_RejectsInvalidFilter(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	invoices := buildCollection(t, store, "invoices", nil, invoiceDocs())
+
+	definition := schema.Index{Name: "bad", Fields: []string{"dueAt"}, Filter: map[string]interface{}{"status": map[string]interface{}{"$bogus": 1}}}
+	if err := invoices.CreateIndex(definition, store); err == nil {
+		t.Fatalf("expected an error for an invalid filter")
+	}
+}
@@ -0,0 +1,211 @@
+package schema
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/adityaparmar9813/NAP/internal/schema"
+	"github.com/adityaparmar9813/NAP/internal/storage"
+	"github.com/adityaparmar9813/NAP/internal/types"
+	"github.com/adityaparmar9813/NAP/internal/validator"
+)
+
+var userFields = []Field{
+	{Name: "name", Type: types.TypeString, Required: true},
+	{Name: "age", Type: types.TypeInt, Required: true},
+}
+
+// userDocs returns three users, two of them the same age
+func userDocs() []map[string]interface{} {
+	return []map[string]interface{}{
+		{"name": "John Doe", "age": 30},
+		{"name": "Jane Doe", "age": 25},
+		{"name": "Jim Doe", "age": 25},
+	}
+}
+
+func TestUpdateRecords(t *testing.T) {
+	memoryStorage := storage.NewMemoryStorage()
+	users := buildCollection(t, memoryStorage, "users", userFields, userDocs())
+
+	result, err := users.UpdateRecords(
+		map[string]interface{}{"age": 25},
+		map[string]interface{}{"age": 26},
+		validator.NewValidator(), memoryStorage,
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.MatchedCount != 2 || result.ModifiedCount != 2 {
+		t.Fatalf("expected 2 matched and 2 modified, got %+v", result)
+	}
+
+	records, _ := users.GetRecord(map[string]interface{}{"age": 26}, memoryStorage)
+	if len(records) != 2 {
+		t.Fatalf("expected 2 updated records, got %v", records)
+	}
+}
+
+func TestUpdateRecords_UnchangedNotModified(t *testing.T) {
+	memoryStorage := storage.NewMemoryStorage()
+	users := buildCollection(t, memoryStorage, "users", userFields, userDocs())
+
+	result, err := users.UpdateRecords(
+		map[string]interface{}{"age": 25},
+		map[string]interface{}{"age": 25},
+		validator.NewValidator(), memoryStorage,
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.MatchedCount != 2 || result.ModifiedCount != 0 {
+		t.Fatalf("expected 2 matched and 0 modified, got %+v", result)
+	}
+}
+
+func TestUpdateRecords_InvalidUpdateLeavesRecords(t *testing.T) {
+	memoryStorage := storage.NewMemoryStorage()
+	users := buildCollection(t, memoryStorage, "users", userFields, userDocs())
+
+	_, err := users.UpdateRecords(
+		map[string]interface{}{},
+		map[string]interface{}{"age": "old"},
+		validator.NewValidator(), memoryStorage,
+	)
+	if err == nil {
+		t.Fatalf("expected validation error, got none")
+	}
+
+	records, _ := users.GetRecord(map[string]interface{}{"age": 25}, memoryStorage)
+	if len(records) != 2 {
+		t.Fatalf("expected records to be unchanged, got %v", records)
+	}
+
+	_, err = users.UpdateRecords(
+		map[string]interface{}{},
+		map[string]interface{}{"uuid": "other"},
+		validator.NewValidator(), memoryStorage,
+	)
+	if err == nil {
+		t.Fatalf("expected error when changing uuid, got none")
+	}
+}
+
+func TestUpdateRecordByUUID(t *testing.T) {
+	memoryStorage := storage.NewMemoryStorage()
+	users := buildCollection(t, memoryStorage, "users", userFields, userDocs())
+	records, _ := users.GetRecord(map[string]interface{}{"name": "John Doe"}, memoryStorage)
+	recordID := records[0]["uuid"].(string)
+
+	result, err := users.UpdateRecordByUUID(recordID, map[string]interface{}{"name": "John Smith"}, validator.NewValidator(), memoryStorage)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.MatchedCount != 1 || result.ModifiedCount != 1 {
+		t.Fatalf("expected 1 matched and 1 modified, got %+v", result)
+	}
+
+	var saved map[string]interface{}
+	memoryStorage.Get("users", recordID, &saved)
+	if saved["name"] != "John Smith" || saved["age"] != float64(30) {
+		t.Fatalf("expected updated record, got %v", saved)
+	}
+
+	_, err = users.UpdateRecordByUUID("missing", map[string]interface{}{"name": "x"}, validator.NewValidator(), memoryStorage)
+	if !errors.Is(err, schema.ErrRecordNotFound) {
+		t.Fatalf("expected record not found, got %v", err)
+	}
+}
+
+func TestReplaceRecord(t *testing.T) {
+	memoryStorage := storage.NewMemoryStorage()
+	users := buildCollection(t, memoryStorage, "users", userFields, userDocs())
+	records, _ := users.GetRecord(map[string]interface{}{"name": "John Doe"}, memoryStorage)
+	recordID := records[0]["uuid"].(string)
+
+	// Required fields are checked against the replacement, not the old document
+	_, err := users.ReplaceRecord(recordID, map[string]interface{}{"name": "John"}, validator.NewValidator(), memoryStorage)
+	if err == nil {
+		t.Fatalf("expected validation error, got none")
+	}
+
+	result, err := users.ReplaceRecord(recordID, map[string]interface{}{"name": "John", "age": 31}, validator.NewValidator(), memoryStorage)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.MatchedCount != 1 || result.ModifiedCount != 1 {
+		t.Fatalf("expected 1 matched and 1 modified, got %+v", result)
+	}
+
+	var saved map[string]interface{}
+	memoryStorage.Get("users", recordID, &saved)
+	if saved["uuid"] != recordID || saved["name"] != "John" || len(saved) != 3 {
+		t.Fatalf("expected replaced record keeping its uuid, got %v", saved)
+	}
+}
+
+func TestDeleteRecords(t *testing.T) {
+	memoryStorage := storage.NewMemoryStorage()
+	users := buildCollection(t, memoryStorage, "users", userFields, userDocs())
+
+	deleted, err := users.DeleteRecords(map[string]interface{}{"age": 25}, memoryStorage)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if deleted != 2 {
+		t.Fatalf("expected 2 deleted, got %d", deleted)
+	}
+
+	records, _ := users.GetRecord(map[string]interface{}{}, memoryStorage)
+	if len(records) != 1 || records[0]["name"] != "John Doe" {
+		t.Fatalf("expected only John Doe to remain, got %v", records)
+	}
+
+	recordID := records[0]["uuid"].(string)
+	if err := users.DeleteRecordByUUID(recordID, memoryStorage); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := users.DeleteRecordByUUID(recordID, memoryStorage); !errors.Is(err, schema.ErrRecordNotFound) {
+		t.Fatalf("expected record not found, got %v", err)
+	}
+}
+
+func TestUpdateAndDelete_LSMStorage(t *testing.T) {
+	lsmStorage, err := storage.NewLSMStorage(t.TempDir(), storage.LSMOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer lsmStorage.Close()
+	users := buildCollection(t, lsmStorage, "users", userFields, userDocs())
+
+	result, err := users.UpdateRecords(map[string]interface{}{"name": "Jim Doe"}, map[string]interface{}{"age": 40}, validator.NewValidator(), lsmStorage)
+	if err != nil || result.ModifiedCount != 1 {
+		t.Fatalf("expected 1 modified, got %+v, %v", result, err)
+	}
+
+	deleted, err := users.DeleteRecords(map[string]interface{}{"age": 40}, lsmStorage)
+	if err != nil || deleted != 1 {
+		t.Fatalf("expected 1 deleted, got %d, %v", deleted, err)
+	}
+}
+
+func TestGetRecord_QueryOperators(t *testing.T) {
+	memoryStorage := storage.NewMemoryStorage()
+	users := buildCollection(t, memoryStorage, "users", userFields, userDocs())
+
+	records, err := users.GetRecord(map[string]interface{}{
+		"age":  map[string]interface{}{"$lt": 30},
+		"name": map[string]interface{}{"$in": []interface{}{"Jane Doe", "John Doe"}},
+	}, memoryStorage)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(records) != 1 || records[0]["name"] != "Jane Doe" {
+		t.Fatalf("expected to get Jane Doe, got %v", records)
+	}
+
+	_, err = users.GetRecord(map[string]interface{}{"age": map[string]interface{}{"$near": 5}}, memoryStorage)
+	if err == nil {
+		t.Fatalf("expected error for unknown operator, got none")
+	}
+}
@@ -0,0 +1,252 @@
+package schema
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/adityaparmar9813/NAP/internal/index"
+	"github.com/adityaparmar9813/NAP/internal/schema"
+	"github.com/adityaparmar9813/NAP/internal/storage"
+	"github.com/adityaparmar9813/NAP/internal/types"
+	"github.com/adityaparmar9813/NAP/internal/validator"
+)
+
+var articleFields = []Field{
+	{Name: "title", Type: types.TypeString, Required: true},
+	{Name: "body", Type: types.TypeString},
+	{Name: "views", Type: types.TypeInt},
+}
+
+// articleDocs returns four articles, two of them about databases
+func articleDocs() []map[string]interface{} {
+	return []map[string]interface{}{
+		{"title": "Indexing databases", "body": "A database index makes database queries fast", "views": 10},
+		{"title": "Cooking at home", "body": "Pasta and other quick dinners", "views": 50},
+		{"title": "Key value stores", "body": "Storing a key value pair in a database", "views": 30},
+		{"title": "Gardening", "body": "Growing tomatoes", "views": 5},
+	}
+}
+
+// contentIndex searches the title and body of articles
+var contentIndex = schema.Index{Name: "content", Fields: []string{"title", "body"}, Type: schema.TextIndex}
+
+func titles(records []map[string]interface{}) []string {
+	found := make([]string, len(records))
+	for i, record := range records {
+		found[i] = record["title"].(string)
+	}
+	return found
+}
+
+func search(text string) map[string]interface{} {
+	return map[string]interface{}{"$text": map[string]interface{}{"$search": text}}
+}
+
+func TestTextIndex_SortsByScore(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	articles := buildCollection(t, store, "articles", articleFields, articleDocs())
+	if err := articles.CreateIndex(contentIndex, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	records, err := articles.GetRecord(search("databases"), store, &schema.FindOptions{
+		Sort:       []schema.SortField{{Field: schema.TextScore, Order: schema.Descending}},
+		Projection: map[string]interface{}{"title": 1, "score": map[string]interface{}{"$meta": "textScore"}},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if found := strings.Join(titles(records), ", "); found != "Indexing databases, Key value stores" {
+		t.Fatalf("expected the best match first, got %s", found)
+	}
+	first, _ := records[0]["score"].(float64)
+	second, _ := records[1]["score"].(float64)
+	if first <= second || second <= 0 {
+		t.Fatalf("expected decreasing positive scores, got %v and %v", first, second)
+	}
+	if _, exists := records[0][schema.TextScore]; exists {
+		t.Fatalf("expected the score field to be hidden, got %v", records[0])
+	}
+	if _, exists := records[0]["body"]; exists {
+		t.Fatalf("expected only the projected fields, got %v", records[0])
+	}
+}
+
+func TestTextIndex_Queries(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	articles := buildCollection(t, store, "articles", articleFields, articleDocs())
+	if err := articles.CreateIndex(contentIndex, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		criteria map[string]interface{}
+		expected int
+	}{
+		{search("cooking"), 1},
+		{search("the"), 0},
+		{search("tomato pasta"), 2},
+		{search(`"key value"`), 1},
+		{search("garden*"), 1},
+		{search("database"), 2},
+		{map[string]interface{}{"$text": map[string]interface{}{"$search": "database"}, "views": map[string]interface{}{"$gt": 20}}, 1},
+	}
+	for _, test := range tests {
+		count, err := articles.Count(test.criteria, store)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if count != test.expected {
+			t.Fatalf("expected %d records for %v, got %d", test.expected, test.criteria, count)
+		}
+	}
+
+	// Nested $text cannot be answered by the index
+	nested := map[string]interface{}{"$or": []interface{}{search("database"), map[string]interface{}{"views": 5}}}
+	if _, err := articles.GetRecord(nested, store); err == nil {
+		t.Fatalf("expected an error for a nested $text")
+	}
+}
+
+func TestTextIndex_FollowsUpdates(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	articles := buildCollection(t, store, "articles", articleFields, articleDocs())
+	if err := articles.CreateIndex(contentIndex, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	update := map[string]interface{}{"body": "Soups and salads"}
+	if _, err := articles.UpdateRecords(map[string]interface{}{"title": "Cooking at home"}, update, validator.NewValidator(), store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := articles.DeleteRecords(search("tomatoes"), store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for text, expected := range map[string]int{"pasta": 0, "salad": 1, "tomatoes": 0, "cooking": 1} {
+		count, err := articles.Count(search(text), store)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if count != expected {
+			t.Fatalf("expected %d records for %s, got %d", expected, text, count)
+		}
+	}
+}
+
+func TestTextIndex_Definitions(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	articles := buildCollection(t, store, "articles", articleFields, articleDocs())
+	if err := articles.CreateIndex(contentIndex, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := articles.GetRecord(map[string]interface{}{"views": 5}, store, &schema.FindOptions{
+		Sort: []schema.SortField{{Field: schema.TextScore}},
+	}); err == nil {
+		t.Fatalf("expected an error sorting on the score without $text")
+	}
+
+	second := schema.Index{Name: "title", Fields: []string{"title"}, Type: schema.TextIndex}
+	if err := articles.CreateIndex(second, store); !errors.Is(err, schema.ErrIndexExists) {
+		t.Fatalf("expected ErrIndexExists for a second text index, got %v", err)
+	}
+	if err := articles.DropIndex("content", store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := articles.GetRecord(search("database"), store); !errors.Is(err, schema.ErrNoTextIndex) {
+		t.Fatalf("expected ErrNoTextIndex, got %v", err)
+	}
+
+	invalid := []schema.Index{
+		{Name: "unique", Fields: []string{"title"}, Type: schema.TextIndex, Unique: true},
+		{Name: "tokenizer", Fields: []string{"title"}, Type: schema.TextIndex, Tokenizer: "missing"},
+		{Name: "language", Fields: []string{"title"}, Type: schema.TextIndex, Language: "klingon"},
+	}
+	for _, definition := range invalid {
+		if err := articles.CreateIndex(definition, store); err == nil {
+			t.Fatalf("expected an error for index '%s'", definition.Name)
+		}
+	}
+
+	// Split titles into letters instead of words, keeping stop words
+	index.RegisterTokenizer("letters", index.TokenizerFunc(func(text string) []string {
+		return strings.Split(strings.ReplaceAll(text, " ", ""), "")
+	}))
+	letters := schema.Index{Name: "letters", Fields: []string{"title"}, Type: schema.TextIndex, Tokenizer: "letters", Language: index.LanguageNone}
+	if err := articles.CreateIndex(letters, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	count, err := articles.Count(search("z"), store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("expected no title with a z, got %d", count)
+	}
+	count, err = articles.Count(search("k"), store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("expected two titles with a k, got %d", count)
+	}
+}
+
+func TestTextIndex_Pages(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	articles := buildCollection(t, store, "articles", articleFields, articleDocs())
+	if err := articles.CreateIndex(contentIndex, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	options := &schema.FindOptions{
+		Sort:       []schema.SortField{{Field: schema.TextScore, Order: schema.Descending}},
+		Projection: map[string]interface{}{"title": 1, "score": map[string]interface{}{"$meta": "textScore"}},
+		Limit:      1,
+	}
+	first, token, err := articles.GetPage(search("database"), store, options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(first) != 1 || token == "" {
+		t.Fatalf("expected one record and a token, got %v and %q", first, token)
+	}
+
+	options.After = token
+	second, token, err := articles.GetPage(search("database"), store, options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(second) != 1 || token != "" {
+		t.Fatalf("expected the last record without a token, got %v and %q", second, token)
+	}
+	if found := strings.Join(titles(append(first, second...)), ", "); found != "Indexing databases, Key value stores" {
+		t.Fatalf("expected the matches in score order, got %s", found)
+	}
+	if _, exists := second[0][schema.TextScore]; exists || second[0]["score"] == nil {
+		t.Fatalf("expected only the projected score, got %v", second[0])
+	}
+}
+
+func TestTextIndex_ProjectsScoreWithUUID(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	articles := buildCollection(t, store, "articles", articleFields, articleDocs())
+	if err := articles.CreateIndex(contentIndex, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// The score field sorts before and after the uuid
+	for _, field := range []string{"ascore", "zscore"} {
+		records, err := articles.GetRecord(search("cooking"), store, &schema.FindOptions{
+			Projection: map[string]interface{}{"uuid": 1, field: map[string]interface{}{"$meta": "textScore"}},
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(records) != 1 || len(records[0]) != 2 || records[0]["uuid"] == nil || records[0][field] == nil {
+			t.Fatalf("expected only the uuid and %s, got %v", field, records)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/adityaparmar9813/NAP/internal/schema"
+	"github.com/adityaparmar9813/NAP/internal/storage"
+)
+
+func TestExpireRecords(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	sessions, _ := schema.BuildSchema("sessions", store)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// Sessions created 0 to 49 minutes ago, half with RFC 3339 dates and
+	// half with milliseconds since the epoch
+	for i := 0; i < 50; i++ {
+		createdAt := now.Add(-time.Duration(i) * time.Minute)
+		var date interface{} = createdAt.Format(time.RFC3339Nano)
+		if i%2 == 1 {
+			date = createdAt.UnixMilli()
+		}
+		doc := map[string]interface{}{"user": fmt.Sprint("user", i%5), "createdAt": date}
+		if err := sessions.AddRecord(doc, MockValidator{}, store); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	// A record without a date never expires
+	if err := sessions.AddRecord(map[string]interface{}{"user": "user0", "createdAt": "never"}, MockValidator{}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	ttl := schema.Index{Name: "expiry", Fields: []string{"createdAt"}, ExpireAfter: 30 * time.Minute}
+	if err := sessions.CreateIndex(ttl, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := sessions.CreateIndex(schema.Index{Name: "user", Fields: []string{"user"}}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	removed, err := sessions.ExpireRecords(context.Background(), now, 7, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if removed != 20 {
+		t.Fatalf("expected sessions 30 to 49 minutes old to expire, got %d", removed)
+	}
+
+	remaining, err := sessions.Count(map[string]interface{}{}, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if remaining != 31 {
+		t.Fatalf("expected 31 sessions to remain, got %d", remaining)
+	}
+	// The other indexes no longer point at the deleted records
+	count, err := sessions.Count(map[string]interface{}{"user": "user0"}, store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if count != 7 {
+		t.Fatalf("expected 7 sessions of user0, got %d", count)
+	}
+
+	removed, err = sessions.ExpireRecords(context.Background(), now, 7, store)
+	if err != nil || removed != 0 {
+		t.Fatalf("expected nothing left to expire, got %d (%v)", removed, err)
+	}
+}
+
+func TestExpireRecords_RejectsInvalidIndexes(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	sessions, _ := schema.BuildSchema("sessions", store)
+
+	invalid := []schema.Index{
+		{Name: "a", Fields: []string{"createdAt", "user"}, ExpireAfter: time.Hour},
+		{Name: "b", Fields: []string{"createdAt"}, ExpireAfter: time.Hour, Type: schema.HashIndex},
+		{Name: "c", Fields: []string{"createdAt"}, ExpireAfter: -time.Hour},
+	}
+	for _, definition := range invalid {
+		if err := sessions.CreateIndex(definition, store); err == nil {
+			t.Fatalf("expected an error for index %s", definition.Name)
+		}
+	}
+}
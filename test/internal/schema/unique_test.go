@@ -0,0 +1,247 @@
+package schema
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/adityaparmar9813/NAP/internal/index"
+	"github.com/adityaparmar9813/NAP/internal/schema"
+	"github.com/adityaparmar9813/NAP/internal/storage"
+	"github.com/adityaparmar9813/NAP/internal/types"
+	"github.com/adityaparmar9813/NAP/internal/validator"
+)
+
+var accountFields = []Field{
+	{Name: "name", Type: types.TypeString, Required: true},
+	{Name: "email", Type: types.TypeString, Required: false, Unique: true},
+}
+
+func TestUniqueField_RejectsDuplicates(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	accounts := buildCollection(t, store, "accounts", accountFields, nil)
+	v := validator.NewValidator()
+
+	if err := accounts.AddRecord(map[string]interface{}{"name": "ansh", "email": "ansh@example.com"}, v, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	err := accounts.AddRecord(map[string]interface{}{"name": "other", "email": "ansh@example.com"}, v, store)
+	var duplicate *schema.DuplicateKeyError
+	if !errors.As(err, &duplicate) {
+		t.Fatalf("expected a DuplicateKeyError, got %v", err)
+	}
+	if duplicate.Index != "unique_email" || !reflect.DeepEqual(duplicate.Values, []interface{}{"ansh@example.com"}) {
+		t.Fatalf("expected the index and value to be named, got %+v", duplicate)
+	}
+	if expected := `duplicate key in unique index 'unique_email': {email: "ansh@example.com"}`; err.Error() != expected {
+		t.Fatalf("expected %q, got %q", expected, err.Error())
+	}
+
+	count, _ := accounts.Count(map[string]interface{}{}, store)
+	if count != 1 {
+		t.Fatalf("expected the duplicate not to be saved, got %d records", count)
+	}
+
+	// A record without the field counts as null, which is unique too
+	if err := accounts.AddRecord(map[string]interface{}{"name": "no email"}, v, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := accounts.AddRecord(map[string]interface{}{"name": "no email either"}, v, store); !errors.As(err, &duplicate) {
+		t.Fatalf("expected a DuplicateKeyError, got %v", err)
+	}
+
+	// Deleting a record frees its key
+	if _, err := accounts.DeleteRecords(map[string]interface{}{"email": "ansh@example.com"}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := accounts.AddRecord(map[string]interface{}{"name": "other", "email": "ansh@example.com"}, v, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestUniqueField_Updates(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	accounts := buildCollection(t, store, "accounts", accountFields, nil)
+	v := validator.NewValidator()
+
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		if err := accounts.AddRecord(map[string]interface{}{"name": email, "email": email}, v, store); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	_, err := accounts.UpdateRecords(map[string]interface{}{"email": "a@example.com"}, map[string]interface{}{"email": "b@example.com"}, v, store)
+	var duplicate *schema.DuplicateKeyError
+	if !errors.As(err, &duplicate) {
+		t.Fatalf("expected a DuplicateKeyError, got %v", err)
+	}
+
+	// Two records cannot take the same new value, and neither is changed
+	_, err = accounts.UpdateRecords(map[string]interface{}{"email": map[string]interface{}{"$in": []interface{}{"a@example.com", "b@example.com"}}},
+		map[string]interface{}{"email": "new@example.com"}, v, store)
+	if !errors.As(err, &duplicate) {
+		t.Fatalf("expected a DuplicateKeyError, got %v", err)
+	}
+	if exists, _ := accounts.Exists(map[string]interface{}{"email": "new@example.com"}, store); exists {
+		t.Fatalf("expected a rejected update to leave the records untouched")
+	}
+
+	// Moving a record to a free value, or keeping its own, is allowed
+	result, err := accounts.UpdateRecords(map[string]interface{}{"email": "c@example.com"}, map[string]interface{}{"email": "d@example.com"}, v, store)
+	if err != nil || result.ModifiedCount != 1 {
+		t.Fatalf("expected one modified record, got %+v and %v", result, err)
+	}
+	if _, err := accounts.UpdateRecords(map[string]interface{}{}, map[string]interface{}{"$set": map[string]interface{}{"name": "same"}}, v, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestUniqueIndex_Compound(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	people, _ := schema.BuildSchema("people", store)
+	if err := people.CreateIndex(schema.Index{Name: "full_name", Fields: []string{"first", "last"}, Unique: true}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	docs := []map[string]interface{}{
+		{"first": "Ansh", "last": "Bajaj"},
+		{"first": "Ansh", "last": "Dubey"},
+		{"first": "Arpit", "last": "Bajaj"},
+	}
+	for _, doc := range docs {
+		if err := people.AddRecord(doc, MockValidator{}, store); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	err := people.AddRecord(map[string]interface{}{"first": "Ansh", "last": "Bajaj", "age": 1}, MockValidator{}, store)
+	var duplicate *schema.DuplicateKeyError
+	if !errors.As(err, &duplicate) {
+		t.Fatalf("expected a DuplicateKeyError, got %v", err)
+	}
+	if !reflect.DeepEqual(duplicate.Fields, []string{"first", "last"}) || !reflect.DeepEqual(duplicate.Values, []interface{}{"Ansh", "Bajaj"}) {
+		t.Fatalf("expected the compound key to be named, got %+v", duplicate)
+	}
+}
+
+func TestUniqueIndex_CreateOverDuplicates(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	people, _ := schema.BuildSchema("people", store)
+	for _, name := range []string{"ansh", "arpit", "ansh"} {
+		if err := people.AddRecord(map[string]interface{}{"name": name}, MockValidator{}, store); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	err := people.CreateIndex(schema.Index{Name: "name", Fields: []string{"name"}, Unique: true}, store)
+	var duplicate *schema.DuplicateKeyError
+	if !errors.As(err, &duplicate) {
+		t.Fatalf("expected a DuplicateKeyError, got %v", err)
+	}
+	if len(people.Indexes) != 0 {
+		t.Fatalf("expected no index to be created, got %v", people.Indexes)
+	}
+	if err := people.AddRecord(map[string]interface{}{"name": "ansh"}, MockValidator{}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestUniqueField_ConcurrentInserts(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	catalog, err := schema.LoadCatalog(store)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	fields := []Field{
+		{Name: "name", Type: types.TypeString, Required: true},
+		{Name: "email", Type: types.TypeString, Required: false, Unique: true},
+	}
+	// Every handle on the collection shares its lock and unique index
+	var handles []*schema.Schema
+	for i := 0; i < 2; i++ {
+		accounts, err := catalog.Create("accounts", fields...)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		handles = append(handles, accounts)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	inserted, duplicates := 0, 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(accounts *schema.Schema) {
+			defer wg.Done()
+
+			err := accounts.AddRecord(map[string]interface{}{"name": "racer", "email": "race@example.com"}, validator.NewValidator(), store)
+			var duplicate *schema.DuplicateKeyError
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				inserted++
+			case errors.As(err, &duplicate):
+				duplicates++
+			default:
+				t.Errorf("expected no error or a DuplicateKeyError, got %v", err)
+			}
+		}(handles[i%2])
+	}
+	wg.Wait()
+
+	if inserted != 1 || duplicates != 19 {
+		t.Fatalf("expected 1 insert and 19 duplicates, got %d and %d", inserted, duplicates)
+	}
+	if count, _ := handles[0].Count(map[string]interface{}{"email": "race@example.com"}, store); count != 1 {
+		t.Fatalf("expected 1 stored record, got %d", count)
+	}
+}
+
+// failingStorage fails every write to one collection
+type failingStorage struct {
+	storage.StorageInterface
+	collection string
+}
+
+func (fs *failingStorage) Put(collection, key string, v interface{}) error {
+	if collection == fs.collection {
+		return errors.New("disk full")
+	}
+	return fs.StorageInterface.Put(collection, key, v)
+}
+
+func TestUniqueField_FailedUpdateRestoresIndexes(t *testing.T) {
+	store := &failingStorage{StorageInterface: storage.NewMemoryStorage()}
+	accounts := buildCollection(t, store, "accounts", accountFields, nil)
+	v := validator.NewValidator()
+
+	if err := accounts.CreateIndex(schema.Index{Name: "name", Fields: []string{"name"}}, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := accounts.AddRecord(map[string]interface{}{"name": "ansh", "email": "old@example.com"}, v, store); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// The email index changes before the name index fails
+	store.collection = index.Collection("accounts", "name")
+	_, err := accounts.UpdateRecords(map[string]interface{}{"name": "ansh"},
+		map[string]interface{}{"name": "other", "email": "new@example.com"}, v, store)
+	if err == nil {
+		t.Fatalf("expected the update to fail")
+	}
+	store.collection = ""
+
+	// The email index still points at the record's old email
+	err = accounts.AddRecord(map[string]interface{}{"name": "copy", "email": "old@example.com"}, v, store)
+	var duplicate *schema.DuplicateKeyError
+	if !errors.As(err, &duplicate) {
+		t.Fatalf("expected a DuplicateKeyError, got %v", err)
+	}
+	if err := accounts.AddRecord(map[string]interface{}{"name": "new", "email": "new@example.com"}, v, store); err != nil {
+		t.Fatalf("expected the new email to be free, got %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adityaparmar9813/NAP/internal/schema"
+	"github.com/adityaparmar9813/NAP/internal/storage"
+	"github.com/adityaparmar9813/NAP/internal/types"
+	"github.com/adityaparmar9813/NAP/internal/validator"
+)
+
+// updateOne adds doc to a fresh collection, applies update to it and returns
+// the stored result
+func updateOne(t *testing.T, doc, update map[string]interface{}) (map[string]interface{}, error) {
+	t.Helper()
+
+	memoryStorage := storage.NewMemoryStorage()
+	users, _ := schema.BuildSchema("users", memoryStorage,
+		Field{Name: "name", Type: types.TypeString, Required: true},
+		Field{Name: "age", Type: types.TypeInt},
+	)
+	if err := users.AddRecord(doc, validator.NewValidator(), memoryStorage); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	recordID := doc["uuid"].(string)
+
+	if _, err := users.UpdateRecordByUUID(recordID, update, validator.NewValidator(), memoryStorage); err != nil {
+		return nil, err
+	}
+
+	var saved map[string]interface{}
+	if err := memoryStorage.Get("users", recordID, &saved); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	delete(saved, "uuid")
+
+	return saved, nil
+}
+
+func TestUpdateOperators(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      map[string]interface{}
+		update   map[string]interface{}
+		expected map[string]interface{}
+	}{
+		{
+			name:     "set nested path",
+			doc:      map[string]interface{}{"name": "Ansh"},
+			update:   map[string]interface{}{"$set": map[string]interface{}{"address.city": "Pune"}},
+			expected: map[string]interface{}{"name": "Ansh", "address": map[string]interface{}{"city": "Pune"}},
+		},
+		{
+			name:     "set array element",
+			doc:      map[string]interface{}{"name": "Ansh", "items": []interface{}{"a", "b"}},
+			update:   map[string]interface{}{"$set": map[string]interface{}{"items.1": "c"}},
+			expected: map[string]interface{}{"name": "Ansh", "items": []interface{}{"a", "c"}},
+		},
+		{
+			name:     "unset",
+			doc:      map[string]interface{}{"name": "Ansh", "age": 20, "address": map[string]interface{}{"city": "Pune", "zip": "411001"}},
+			update:   map[string]interface{}{"$unset": map[string]interface{}{"age": "", "address.zip": "", "missing": ""}},
+			expected: map[string]interface{}{"name": "Ansh", "address": map[string]interface{}{"city": "Pune"}},
+		},
+		{
+			name:     "inc and mul",
+			doc:      map[string]interface{}{"name": "Ansh", "age": 20, "score": 1.5},
+			update:   map[string]interface{}{"$inc": map[string]interface{}{"age": 2, "visits": 1}, "$mul": map[string]interface{}{"score": 2, "missing": 3}},
+			expected: map[string]interface{}{"name": "Ansh", "age": float64(22), "visits": float64(1), "score": float64(3), "missing": float64(0)},
+		},
+		{
+			name:     "push and pop",
+			doc:      map[string]interface{}{"name": "Ansh", "tags": []interface{}{"a"}, "queue": []interface{}{1, 2, 3}},
+			update:   map[string]interface{}{"$push": map[string]interface{}{"tags": map[string]interface{}{"$each": []interface{}{"b", "c"}}, "new": "x"}, "$pop": map[string]interface{}{"queue": -1}},
+			expected: map[string]interface{}{"name": "Ansh", "tags": []interface{}{"a", "b", "c"}, "new": []interface{}{"x"}, "queue": []interface{}{float64(2), float64(3)}},
+		},
+		{
+			name:     "addToSet skips existing values",
+			doc:      map[string]interface{}{"name": "Ansh", "tags": []interface{}{"a", 1}},
+			update:   map[string]interface{}{"$addToSet": map[string]interface{}{"tags": map[string]interface{}{"$each": []interface{}{"a", 1.0, "b"}}}},
+			expected: map[string]interface{}{"name": "Ansh", "tags": []interface{}{"a", float64(1), "b"}},
+		},
+		{
+			name: "pull values and matching documents",
+			doc: map[string]interface{}{"name": "Ansh", "tags": []interface{}{"a", "b", "a"}, "items": []interface{}{
+				map[string]interface{}{"sku": "x", "qty": 1},
+				map[string]interface{}{"sku": "y", "qty": 2},
+			}},
+			update: map[string]interface{}{"$pull": map[string]interface{}{"tags": "a", "items": map[string]interface{}{"sku": "x"}}},
+			expected: map[string]interface{}{"name": "Ansh", "tags": []interface{}{"b"}, "items": []interface{}{
+				map[string]interface{}{"sku": "y", "qty": float64(2)},
+			}},
+		},
+		{
+			name:     "pull with operator expression",
+			doc:      map[string]interface{}{"name": "Ansh", "scores": []interface{}{4, 6, 8}},
+			update:   map[string]interface{}{"$pull": map[string]interface{}{"scores": map[string]interface{}{"$gte": 6}}},
+			expected: map[string]interface{}{"name": "Ansh", "scores": []interface{}{float64(4)}},
+		},
+		{
+			name:     "rename",
+			doc:      map[string]interface{}{"name": "Ansh", "mail": "a@b.c"},
+			update:   map[string]interface{}{"$rename": map[string]interface{}{"mail": "contact.email", "missing": "other"}},
+			expected: map[string]interface{}{"name": "Ansh", "contact": map[string]interface{}{"email": "a@b.c"}},
+		},
+		{
+			name:     "min and max",
+			doc:      map[string]interface{}{"name": "Ansh", "low": 5, "high": 5, "first": "m"},
+			update:   map[string]interface{}{"$min": map[string]interface{}{"low": 3, "first": "z"}, "$max": map[string]interface{}{"high": 3, "top": 7}},
+			expected: map[string]interface{}{"name": "Ansh", "low": float64(3), "high": float64(5), "first": "m", "top": float64(7)},
+		},
+		{
+			name:     "plain fields are a shorthand for set",
+			doc:      map[string]interface{}{"name": "Ansh", "age": 20},
+			update:   map[string]interface{}{"age": 21},
+			expected: map[string]interface{}{"name": "Ansh", "age": float64(21)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			saved, err := updateOne(t, test.doc, test.update)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(saved, test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, saved)
+			}
+		})
+	}
+}
+
+func TestUpdateOperators_CurrentDate(t *testing.T) {
+	before := time.Now().UTC().UnixMilli()
+	saved, err := updateOne(t, map[string]interface{}{"name": "Ansh"}, map[string]interface{}{
+		"$currentDate": map[string]interface{}{"updatedAt": true, "seenAt": map[string]interface{}{"$type": "timestamp"}},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	updatedAt, err := time.Parse(time.RFC3339Nano, saved["updatedAt"].(string))
+	if err != nil || updatedAt.UnixMilli() < before {
+		t.Fatalf("expected a current date, got %v", saved["updatedAt"])
+	}
+	if seenAt, ok := saved["seenAt"].(float64); !ok || int64(seenAt) < before {
+		t.Fatalf("expected a current timestamp, got %v", saved["seenAt"])
+	}
+}
+
+func TestUpdateOperators_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		update map[string]interface{}
+		err    string
+	}{
+		{"unknown operator", map[string]interface{}{"$frob": map[string]interface{}{"age": 1}}, "unknown update operator"},
+		{"mixed operators and fields", map[string]interface{}{"$set": map[string]interface{}{"age": 1}, "name": "x"}, "cannot mix"},
+		{"conflicting paths", map[string]interface{}{"$set": map[string]interface{}{"address": "x"}, "$unset": map[string]interface{}{"address.city": ""}}, "conflicts"},
+		{"uuid", map[string]interface{}{"$unset": map[string]interface{}{"uuid": ""}}, "uuid"},
+		{"inc on string", map[string]interface{}{"$inc": map[string]interface{}{"name": 1}}, "non-numeric"},
+		{"push on non-array", map[string]interface{}{"$push": map[string]interface{}{"name": "x"}}, "not an array"},
+		{"result fails validation", map[string]interface{}{"$inc": map[string]interface{}{"age": 0.5}}, "expected int"},
+		{"required field removed", map[string]interface{}{"$rename": map[string]interface{}{"name": "fullName"}}, "required field 'name'"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := updateOne(t, map[string]interface{}{"name": "Ansh", "age": 20}, test.update)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
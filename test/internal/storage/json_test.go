@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -171,3 +172,134 @@ func TestFileStorage_LoadStructFromFile_InvalidJSON(t *testing.T) {
 		t.Fatalf("expected error due to invalid JSON, got none")
 	}
 }
+
+func TestFileStorage_SaveStructToFile_LeavesNoTempFiles(t *testing.T) {
+	fs := storage.NewFileStorage()
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "record.json")
+
+	for i := 0; i < 3; i++ {
+		if err := fs.SaveStructToFile(&TestStruct{Name: "Test", Value: i}, filename); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read directory: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "record.json" {
+		t.Fatalf("expected only record.json, got %v", entries)
+	}
+
+	var loadedData TestStruct
+	if err := fs.LoadStructFromFile(filename, &loadedData); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if loadedData.Value != 2 {
+		t.Fatalf("expected last write to win, got %v", loadedData)
+	}
+}
+
+func TestFileStorage_LoadStructFromFile_ChecksumMismatch(t *testing.T) {
+	fs := storage.NewFileStorage()
+	filename := filepath.Join(t.TempDir(), "record.json")
+
+	if err := fs.SaveStructToFile(&TestStruct{Name: "Test", Value: 42}, filename); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Corrupt the document without touching its checksum header
+	data, _ := os.ReadFile(filename)
+	data[len(data)-3] = '9'
+	os.WriteFile(filename, data, 0644)
+
+	var loadedData TestStruct
+	err := fs.LoadStructFromFile(filename, &loadedData)
+
+	if !errors.Is(err, storage.ErrCorrupt) {
+		t.Fatalf("expected corruption error, got %v", err)
+	}
+
+	var corruptErr *storage.CorruptionError
+	if !errors.As(err, &corruptErr) || corruptErr.Path != filename {
+		t.Fatalf("expected corruption error naming %s, got %v", filename, err)
+	}
+}
+
+func TestFileStorage_LoadStructFromFile_InvalidJSONIsCorruption(t *testing.T) {
+	fs := storage.NewFileStorage()
+	filename := filepath.Join(t.TempDir(), "record.json")
+
+	// A torn write from before checksums were introduced
+	os.WriteFile(filename, []byte(`{"name": "Te`), 0644)
+
+	var loadedData TestStruct
+	err := fs.LoadStructFromFile(filename, &loadedData)
+
+	if !errors.Is(err, storage.ErrCorrupt) {
+		t.Fatalf("expected corruption error, got %v", err)
+	}
+}
+
+func TestFileStorage_LoadStructFromFile_LegacyDocument(t *testing.T) {
+	fs := storage.NewFileStorage()
+	filename := filepath.Join(t.TempDir(), "record.json")
+
+	// Documents written before checksums have no header
+	os.WriteFile(filename, []byte(`{"name": "Legacy", "value": 1}`), 0644)
+
+	var loadedData TestStruct
+	if err := fs.LoadStructFromFile(filename, &loadedData); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if loadedData.Name != "Legacy" {
+		t.Fatalf("expected legacy document to load, got %v", loadedData)
+	}
+}
+
+func TestFileStorage_PutGetDeleteScan(t *testing.T) {
+	fs := storage.NewFileStorage()
+
+	wd, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	defer os.Chdir(wd)
+
+	fs.Put("users", "b", &TestStruct{Name: "b"})
+	fs.Put("users", "a-b", &TestStruct{Name: "a-b"})
+	fs.Put("users", "a", &TestStruct{Name: "a"})
+	fs.Put(storage.SchemaCollection, "users", &TestStruct{Name: "schema"})
+
+	// The on-disk layout is one file per document
+	if _, err := os.Stat(filepath.Join("collections", "users", "a.json")); err != nil {
+		t.Fatalf("expected record file, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join("schemas", "users.json")); err != nil {
+		t.Fatalf("expected schema file, got %v", err)
+	}
+
+	var keys []string
+	err := fs.Scan("users", func(key string, data []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	// Keys sort as keys, not as file names, where "a-b.json" comes first
+	if !reflect.DeepEqual(keys, []string{"a", "a-b", "b"}) {
+		t.Fatalf("expected sorted keys, got %v", keys)
+	}
+
+	if err := fs.Delete("users", "a"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var loadedData TestStruct
+	if err := fs.Get("users", "a", &loadedData); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	if err := fs.Delete("users", "a"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
@@ -0,0 +1,304 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/adityaparmar9813/NAP/internal/storage"
+)
+
+func TestLSMStorage_PutAndGet(t *testing.T) {
+	ls, err := storage.NewLSMStorage(t.TempDir(), storage.LSMOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer ls.Close()
+
+	testData := TestStruct{Name: "Test", Value: 42}
+
+	if err := ls.Put("users", "1", &testData); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var loadedData TestStruct
+	if err := ls.Get("users", "1", &loadedData); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(testData, loadedData) {
+		t.Fatalf("expected %v, got %v", testData, loadedData)
+	}
+
+	if err := ls.Get("users", "2", &loadedData); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestLSMStorage_Delete(t *testing.T) {
+	ls, err := storage.NewLSMStorage(t.TempDir(), storage.LSMOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer ls.Close()
+
+	ls.Put("users", "1", &TestStruct{Name: "Test"})
+	ls.Flush()
+
+	// The tombstone in the memtable hides the flushed value
+	if err := ls.Delete("users", "1"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var loadedData TestStruct
+	if err := ls.Get("users", "1", &loadedData); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	if err := ls.Delete("users", "1"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestLSMStorage_ReplaysMemtableAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	ls, err := storage.NewLSMStorage(dir, storage.LSMOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer ls.Close()
+
+	ls.Put("users", "1", &TestStruct{Name: "unflushed", Value: 1})
+
+	// Copy the directory while the memtable only lives in the WAL
+	crashed := t.TempDir()
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		data, _ := os.ReadFile(filepath.Join(dir, entry.Name()))
+		os.WriteFile(filepath.Join(crashed, entry.Name()), data, 0644)
+	}
+
+	recovered, err := storage.NewLSMStorage(crashed, storage.LSMOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer recovered.Close()
+
+	var loadedData TestStruct
+	if err := recovered.Get("users", "1", &loadedData); err != nil {
+		t.Fatalf("expected recovered record, got %v", err)
+	}
+	if loadedData.Name != "unflushed" {
+		t.Fatalf("expected recovered record, got %v", loadedData)
+	}
+}
+
+func TestLSMStorage_FlushCompactAndReopen(t *testing.T) {
+	dir := t.TempDir()
+	options := storage.LSMOptions{MemtableSize: 512, CompactionThreshold: 3}
+
+	ls, err := storage.NewLSMStorage(dir, options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for round := 0; round < 4; round++ {
+		for i := 0; i < 50; i++ {
+			record := TestStruct{Name: fmt.Sprintf("round-%d", round), Value: i}
+			if err := ls.Put("users", fmt.Sprintf("%03d", i), &record); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+	}
+
+	// Give the background compactor a chance to merge the flushed tables
+	deadline := time.Now().Add(5 * time.Second)
+	for ls.TableCount() >= 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ls.TableCount() >= 3 {
+		t.Fatalf("expected compaction to reduce table count, got %d", ls.TableCount())
+	}
+
+	if err := ls.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	ls, err = storage.NewLSMStorage(dir, options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer ls.Close()
+
+	var keys []string
+	err = ls.Scan("users", func(key string, data []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(keys) != 50 || keys[0] != "000" {
+		t.Fatalf("expected 50 sorted keys, got %v", keys)
+	}
+
+	for i := 0; i < 50; i++ {
+		var loadedData TestStruct
+		if err := ls.Get("users", fmt.Sprintf("%03d", i), &loadedData); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if loadedData.Name != "round-3" || loadedData.Value != i {
+			t.Fatalf("expected latest write for record %d, got %v", i, loadedData)
+		}
+	}
+}
+
+func TestLSMStorage_ScanOnlyReturnsOneCollection(t *testing.T) {
+	ls, err := storage.NewLSMStorage(t.TempDir(), storage.LSMOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer ls.Close()
+
+	ls.Put("users", "1", &TestStruct{})
+	ls.Put("users_archive", "1", &TestStruct{})
+	ls.Put("user", "2", &TestStruct{})
+
+	var keys []string
+	ls.Scan("users", func(key string, data []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if !reflect.DeepEqual(keys, []string{"1"}) {
+		t.Fatalf("expected only users/1, got %v", keys)
+	}
+}
+
+func TestLSMStorage_ScanFrom(t *testing.T) {
+	ls, err := storage.NewLSMStorage(t.TempDir(), storage.LSMOptions{MemtableSize: 512})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer ls.Close()
+
+	// Spread the keys over the memtable and several tables
+	for i := 0; i < 60; i++ {
+		if err := ls.Put("users", fmt.Sprintf("%03d", i), &TestStruct{Value: i}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	ls.Put("users_archive", "000", &TestStruct{})
+	if ls.TableCount() == 0 {
+		t.Fatalf("expected some keys to be flushed to tables")
+	}
+
+	var keys []string
+	err = ls.ScanFrom("users", "045", func(key string, data []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(keys) != 15 || keys[0] != "045" || keys[14] != "059" {
+		t.Fatalf("expected keys 045 to 059, got %v", keys)
+	}
+}
+
+func TestLSMStorage_ScanDuringCompaction(t *testing.T) {
+	options := storage.LSMOptions{MemtableSize: 512, CompactionThreshold: 2}
+	ls, err := storage.NewLSMStorage(t.TempDir(), options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer ls.Close()
+
+	for i := 0; i < 100; i++ {
+		if err := ls.Put("users", fmt.Sprintf("%03d", i), &TestStruct{Name: "before", Value: i}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	// Tables merged away while the scan reads them stay readable until it ends
+	var keys []string
+	err = ls.Scan("users", func(key string, data []byte) error {
+		if len(keys) == 0 {
+			tables := ls.TableCount()
+			for i := 0; i < 100; i++ {
+				if err := ls.Put("users", fmt.Sprintf("%03d", i), &TestStruct{Name: "during", Value: i}); err != nil {
+					return err
+				}
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for ls.TableCount() >= tables && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+
+		var record TestStruct
+		if err := storage.JSONToStruct(data, &record); err != nil {
+			return err
+		}
+		if record.Name != "before" {
+			t.Fatalf("expected the scan to read the records as they were, got %v", record)
+		}
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(keys) != 100 || keys[0] != "000" || keys[99] != "099" {
+		t.Fatalf("expected 100 sorted keys, got %v", keys)
+	}
+}
+
+func TestLSMStorage_FailedFlushKeepsWrites(t *testing.T) {
+	dir := t.TempDir()
+	options := storage.LSMOptions{MemtableSize: 512}
+	ls, err := storage.NewLSMStorage(dir, options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Stand in the way of the first table the memtable is flushed to
+	blocker := filepath.Join(dir, "00000001.sst")
+	if err := os.Mkdir(blocker, 0755); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for i := 0; i < 20; i++ {
+		if err := ls.Put("users", fmt.Sprintf("%03d", i), &TestStruct{Name: "logged", Value: i}); err != nil {
+			t.Fatalf("expected the logged write to succeed, got %v", err)
+		}
+	}
+	// The next write retried the flush under a new table
+	if ls.TableCount() != 1 {
+		t.Fatalf("expected a later write to flush the memtable, got %d tables", ls.TableCount())
+	}
+	if err := ls.Sync(); err == nil {
+		t.Fatalf("expected Sync to report the failed flush")
+	}
+	if err := ls.Sync(); err != nil {
+		t.Fatalf("expected the failure to be reported once, got %v", err)
+	}
+
+	if err := ls.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	ls, err = storage.NewLSMStorage(dir, options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer ls.Close()
+
+	for i := 0; i < 20; i++ {
+		var loadedData TestStruct
+		if err := ls.Get("users", fmt.Sprintf("%03d", i), &loadedData); err != nil {
+			t.Fatalf("expected record %d, got %v", i, err)
+		}
+	}
+}
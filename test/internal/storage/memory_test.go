@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/adityaparmar9813/NAP/internal/storage"
+)
+
+func TestMemoryStorage_PutAndGet(t *testing.T) {
+	ms := storage.NewMemoryStorage()
+	testData := TestStruct{Name: "Test", Value: 42}
+
+	if err := ms.Put("users", "1", &testData); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var loadedData TestStruct
+	if err := ms.Get("users", "1", &loadedData); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(testData, loadedData) {
+		t.Fatalf("expected %v, got %v", testData, loadedData)
+	}
+
+	// Changing the original value doesn't change the stored document
+	testData.Value = 7
+	ms.Get("users", "1", &loadedData)
+	if loadedData.Value != 42 {
+		t.Fatalf("expected stored copy to be unchanged, got %v", loadedData)
+	}
+}
+
+func TestMemoryStorage_NotFound(t *testing.T) {
+	ms := storage.NewMemoryStorage()
+
+	var loadedData TestStruct
+	err := ms.Get("users", "missing", &loadedData)
+	if !errors.Is(err, storage.ErrNotFound) || !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+
+	if err := ms.Delete("users", "missing"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestMemoryStorage_ScanAndDelete(t *testing.T) {
+	ms := storage.NewMemoryStorage()
+	ms.Put("users", "b", &TestStruct{Name: "b"})
+	ms.Put("users", "a", &TestStruct{Name: "a"})
+	ms.Put("users", "c", &TestStruct{Name: "c"})
+	ms.Put("archive", "d", &TestStruct{Name: "d"})
+
+	// Deleting while scanning works on a snapshot
+	var keys []string
+	err := ms.Scan("users", func(key string, data []byte) error {
+		keys = append(keys, key)
+		return ms.Delete("users", key)
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(keys, []string{"a", "b", "c"}) {
+		t.Fatalf("expected sorted keys, got %v", keys)
+	}
+
+	keys = nil
+	ms.Scan("users", func(key string, data []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if len(keys) != 0 {
+		t.Fatalf("expected empty collection, got %v", keys)
+	}
+}
+
+func TestMemoryStorage_ScanFrom(t *testing.T) {
+	ms := storage.NewMemoryStorage()
+	for _, key := range []string{"a", "b", "c", "d"} {
+		ms.Put("users", key, &TestStruct{Name: key})
+	}
+
+	var keys []string
+	err := ms.ScanFrom("users", "bb", func(key string, data []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(keys, []string{"c", "d"}) {
+		t.Fatalf("expected the keys from bb onwards, got %v", keys)
+	}
+}
+
+func TestMemoryStorage_ScanStop(t *testing.T) {
+	ms := storage.NewMemoryStorage()
+	ms.Put("users", "a", &TestStruct{})
+	ms.Put("users", "b", &TestStruct{})
+
+	count := 0
+	err := ms.Scan("users", func(key string, data []byte) error {
+		count++
+		return storage.ErrStopScan
+	})
+	if err != nil || count != 1 {
+		t.Fatalf("expected scan to stop after one document, got %d (%v)", count, err)
+	}
+}
+
+func TestMemoryStorage_RejectsInvalidNames(t *testing.T) {
+	ms := storage.NewMemoryStorage()
+
+	if err := ms.Put("users/../x", "1", &TestStruct{}); err == nil {
+		t.Fatalf("expected error for invalid collection name, got none")
+	}
+	if err := ms.Put("users", "", &TestStruct{}); err == nil {
+		t.Fatalf("expected error for empty key, got none")
+	}
+}
@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/adityaparmar9813/NAP/internal/storage"
+)
+
+func TestPagedStorage_PutAndGet(t *testing.T) {
+	root := t.TempDir()
+	ps := storage.NewPagedStorage(root, 0)
+	defer ps.Close()
+
+	testData := TestStruct{Name: "Test", Value: 42}
+
+	if err := ps.Put("users", "1", &testData); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var loadedData TestStruct
+	if err := ps.Get("users", "1", &loadedData); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(testData, loadedData) {
+		t.Fatalf("expected %v, got %v", testData, loadedData)
+	}
+
+	// Everything lives in a single data file
+	if _, err := os.Stat(filepath.Join(root, "collections", "users", storage.PagedDataFile)); err != nil {
+		t.Fatalf("expected data file to exist, got %v", err)
+	}
+}
+
+func TestPagedStorage_NotFound(t *testing.T) {
+	ps := storage.NewPagedStorage(t.TempDir(), 0)
+	defer ps.Close()
+
+	var loadedData TestStruct
+
+	if err := ps.Get("users", "missing", &loadedData); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+
+	ps.Put("users", "a", &TestStruct{Name: "a"})
+	if err := ps.Get("users", "missing", &loadedData); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	if err := ps.Delete("users", "missing"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestPagedStorage_ManyRecordsPersistAcrossReopen(t *testing.T) {
+	root := t.TempDir()
+	ps := storage.NewPagedStorage(root, 4)
+
+	for i := 0; i < 500; i++ {
+		record := TestStruct{Name: fmt.Sprintf("record-%d", i), Value: i}
+		if err := ps.Put("users", fmt.Sprintf("%03d", i), &record); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	// Overwrite a few records with larger values and delete a few others
+	for i := 0; i < 500; i += 50 {
+		record := TestStruct{Name: strings.Repeat("x", 300), Value: -i}
+		if err := ps.Put("users", fmt.Sprintf("%03d", i), &record); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := ps.Delete("users", fmt.Sprintf("%03d", i+1)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	ps.Close()
+
+	ps = storage.NewPagedStorage(root, 4)
+	defer ps.Close()
+
+	var keys []string
+	err := ps.Scan("users", func(key string, data []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(keys) != 490 || keys[0] != "000" || keys[1] != "002" {
+		t.Fatalf("expected 490 sorted keys, got %d", len(keys))
+	}
+
+	for i := 0; i < 500; i++ {
+		var loadedData TestStruct
+		err := ps.Get("users", fmt.Sprintf("%03d", i), &loadedData)
+		if i%50 == 1 {
+			if !errors.Is(err, storage.ErrNotFound) {
+				t.Fatalf("expected record %d to be deleted, got %v", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("expected no error for record %d, got %v", i, err)
+		}
+
+		expected := TestStruct{Name: fmt.Sprintf("record-%d", i), Value: i}
+		if i%50 == 0 {
+			expected = TestStruct{Name: strings.Repeat("x", 300), Value: -i}
+		}
+		if !reflect.DeepEqual(expected, loadedData) {
+			t.Fatalf("expected %v, got %v", expected, loadedData)
+		}
+	}
+}
+
+func TestPagedStorage_LargeDocumentUsesOverflowPages(t *testing.T) {
+	root := t.TempDir()
+	ps := storage.NewPagedStorage(root, 0)
+
+	large := TestStruct{Name: strings.Repeat("large document ", 2000), Value: 1}
+	if err := ps.Put("docs", "large", &large); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Shrinking the document frees its overflow pages for reuse
+	small := TestStruct{Name: "small", Value: 2}
+	if err := ps.Put("docs", "large", &small); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := ps.Put("docs", "other", &large); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	ps.Close()
+
+	info, _ := os.Stat(filepath.Join(root, "collections", "docs", storage.PagedDataFile))
+	if info.Size() > 14*4096 {
+		t.Fatalf("expected freed overflow pages to be reused, data file is %d bytes", info.Size())
+	}
+
+	ps = storage.NewPagedStorage(root, 0)
+	defer ps.Close()
+
+	var loadedData TestStruct
+	if err := ps.Get("docs", "other", &loadedData); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(large, loadedData) {
+		t.Fatalf("large document did not round trip")
+	}
+	if err := ps.Get("docs", "large", &loadedData); err != nil || loadedData != small {
+		t.Fatalf("expected %v, got %v (%v)", small, loadedData, err)
+	}
+}
+
+func TestPagedStorage_DetectsCorruptPage(t *testing.T) {
+	root := t.TempDir()
+	ps := storage.NewPagedStorage(root, 0)
+	ps.Put("users", "1", &TestStruct{Name: "Test", Value: 42})
+	ps.Close()
+
+	path := filepath.Join(root, "collections", "users", storage.PagedDataFile)
+	data, _ := os.ReadFile(path)
+	data[len(data)-10] ^= 0xff
+	os.WriteFile(path, data, 0644)
+
+	ps = storage.NewPagedStorage(root, 0)
+	defer ps.Close()
+
+	var loadedData TestStruct
+	err := ps.Get("users", "1", &loadedData)
+	if !errors.Is(err, storage.ErrCorrupt) {
+		t.Fatalf("expected corruption error, got %v", err)
+	}
+}
+
+func TestPagedStorage_FailsWhenRollbackCannotReload(t *testing.T) {
+	root := t.TempDir()
+	ps := storage.NewPagedStorage(root, 1)
+	defer ps.Close()
+
+	// Fill several pages; with one cached page the first is read from disk
+	for i := 0; i < 100; i++ {
+		if err := ps.Put("users", fmt.Sprintf("%03d", i), &TestStruct{Name: strings.Repeat("x", 100), Value: i}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	path := filepath.Join(root, "collections", "users", storage.PagedDataFile)
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	file.WriteAt([]byte{0xff, 0xff}, 2*4096-10)
+	file.Close()
+
+	var loadedData TestStruct
+	if err := ps.Delete("users", "000"); !errors.Is(err, storage.ErrCorrupt) {
+		t.Fatalf("expected corruption error, got %v", err)
+	}
+
+	// The reload after the failed delete hit the same page, so nothing is
+	// served from a half-loaded state
+	if err := ps.Get("users", "099", &loadedData); err == nil {
+		t.Fatalf("expected the storage to fail until reopened")
+	}
+	if err := ps.Put("users", "100", &TestStruct{Name: "new"}); err == nil {
+		t.Fatalf("expected the storage to fail until reopened")
+	}
+}
+
+func TestPagedStorage_RecoversCommittedPagesFromWAL(t *testing.T) {
+	root := t.TempDir()
+	dataPath := filepath.Join(root, "collections", "users", storage.PagedDataFile)
+
+	ps := storage.NewPagedStorage(root, 0)
+	ps.Put("users", "1", &TestStruct{Name: "first", Value: 1})
+	ps.Close()
+	before, _ := os.ReadFile(dataPath)
+
+	ps = storage.NewPagedStorage(root, 0)
+	ps.Put("users", "2", &TestStruct{Name: "second", Value: 2})
+	wal, _ := os.ReadFile(dataPath + ".wal")
+	ps.Close()
+
+	// Simulate a crash after the WAL was synced but before the pages reached
+	// the data file
+	os.WriteFile(dataPath, before, 0644)
+	os.WriteFile(dataPath+".wal", wal, 0644)
+
+	ps = storage.NewPagedStorage(root, 0)
+	defer ps.Close()
+
+	var loadedData TestStruct
+	if err := ps.Get("users", "2", &loadedData); err != nil {
+		t.Fatalf("expected recovered record, got %v", err)
+	}
+	if loadedData.Name != "second" {
+		t.Fatalf("expected recovered record, got %v", loadedData)
+	}
+}
+
+func TestMigrateDirectory(t *testing.T) {
+	dir := t.TempDir()
+	fs := storage.NewFileStorage()
+	for i := 0; i < 3; i++ {
+		fs.SaveStructToFile(&TestStruct{Name: "migrated", Value: i}, filepath.Join(dir, fmt.Sprintf("%d.json", i)))
+	}
+
+	ps := storage.NewPagedStorage(t.TempDir(), 0)
+	defer ps.Close()
+
+	count, err := storage.MigrateDirectory(dir, ps, "users")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if count != 3 {
+		t.Fatalf("expected 3 migrated documents, got %d", count)
+	}
+
+	var loadedData TestStruct
+	if err := ps.Get("users", "2", &loadedData); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if loadedData.Value != 2 {
+		t.Fatalf("expected migrated value 2, got %v", loadedData)
+	}
+}
@@ -1 +1,281 @@
 package storage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/adityaparmar9813/NAP/internal/storage"
+)
+
+func TestWAL_AppendAndReplay(t *testing.T) {
+	walPath := filepath.Join(t.TempDir(), "test.wal")
+
+	wal, err := storage.OpenWAL(walPath)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := wal.Append(storage.WALOpPut, "a.json", []byte(`{"name":"a"}`)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := wal.Append(storage.WALOpDelete, "b.json", nil); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	wal.Close()
+
+	wal, err = storage.OpenWAL(walPath)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer wal.Close()
+
+	var entries []storage.WALEntry
+	err = wal.Replay(func(entry storage.WALEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Op != storage.WALOpPut || entries[0].Key != "a.json" || string(entries[0].Data) != `{"name":"a"}` {
+		t.Fatalf("unexpected first entry %+v", entries[0])
+	}
+	if entries[1].Op != storage.WALOpDelete || entries[1].Key != "b.json" || entries[1].Seq != 2 {
+		t.Fatalf("unexpected second entry %+v", entries[1])
+	}
+}
+
+func TestWAL_ReplayDiscardsTornEntry(t *testing.T) {
+	walPath := filepath.Join(t.TempDir(), "test.wal")
+
+	wal, err := storage.OpenWAL(walPath)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	wal.Append(storage.WALOpPut, "a.json", []byte(`{"name":"a"}`))
+	wal.Append(storage.WALOpPut, "b.json", []byte(`{"name":"b"}`))
+	validSize := wal.Size()
+	wal.Close()
+
+	// Simulate a crash in the middle of writing a third entry
+	file, err := os.OpenFile(walPath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("failed to open WAL: %v", err)
+	}
+	file.Write([]byte{42, 0, 0, 0, 1, 2, 3, 4, 5})
+	file.Close()
+
+	wal, err = storage.OpenWAL(walPath)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer wal.Close()
+
+	count := 0
+	err = wal.Replay(func(entry storage.WALEntry) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if count != 2 {
+		t.Fatalf("expected 2 complete entries, got %d", count)
+	}
+	if wal.Size() != validSize {
+		t.Fatalf("expected torn entry to be truncated to %d bytes, got %d", validSize, wal.Size())
+	}
+
+	// New entries continue after the last valid one
+	seq, err := wal.Append(storage.WALOpPut, "c.json", []byte(`{}`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if seq != 3 {
+		t.Fatalf("expected sequence 3, got %d", seq)
+	}
+}
+
+func TestWAL_ReplayDiscardsCorruptEntry(t *testing.T) {
+	walPath := filepath.Join(t.TempDir(), "test.wal")
+
+	wal, _ := storage.OpenWAL(walPath)
+	wal.Append(storage.WALOpPut, "a.json", []byte(`{"name":"a"}`))
+	wal.Close()
+
+	// Flip a byte inside the payload
+	data, _ := os.ReadFile(walPath)
+	data[len(data)-2] ^= 0xff
+	os.WriteFile(walPath, data, 0644)
+
+	wal, _ = storage.OpenWAL(walPath)
+	defer wal.Close()
+
+	count := 0
+	wal.Replay(func(entry storage.WALEntry) error {
+		count++
+		return nil
+	})
+
+	if count != 0 {
+		t.Fatalf("expected corrupt entry to be discarded, got %d entries", count)
+	}
+}
+
+func TestFileStorageWithWAL_RecoversUnappliedWrite(t *testing.T) {
+	dir := t.TempDir()
+	walPath := filepath.Join(dir, "napdb.wal")
+	filename := filepath.Join(dir, "collections", "users", "1.json")
+
+	// Log a write but crash before applying it
+	wal, err := storage.OpenWAL(walPath)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	wal.Append(storage.WALOpPut, filename, []byte(`{"name":"Recovered","value":7}`))
+	wal.Close()
+
+	fs, err := storage.NewFileStorageWithWAL(walPath)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer fs.Close()
+
+	var loadedData TestStruct
+	if err := fs.LoadStructFromFile(filename, &loadedData); err != nil {
+		t.Fatalf("expected recovered record, got %v", err)
+	}
+
+	expected := TestStruct{Name: "Recovered", Value: 7}
+	if !reflect.DeepEqual(expected, loadedData) {
+		t.Fatalf("expected %v, got %v", expected, loadedData)
+	}
+}
+
+func TestFileStorageWithWAL_SaveAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	walPath := filepath.Join(dir, "napdb.wal")
+	filename := filepath.Join(dir, "record.json")
+
+	fs, err := storage.NewFileStorageWithWAL(walPath)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	testData := TestStruct{Name: "Test", Value: 42}
+	if err := fs.SaveStructToFile(&testData, filename); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// A clean close leaves nothing to replay
+	if info, err := os.Stat(walPath); err != nil || info.Size() != 0 {
+		t.Fatalf("expected empty WAL after close, got %v (%v)", info, err)
+	}
+
+	fs, err = storage.NewFileStorageWithWAL(walPath)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer fs.Close()
+
+	var loadedData TestStruct
+	if err := fs.LoadStructFromFile(filename, &loadedData); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(testData, loadedData) {
+		t.Fatalf("expected %v, got %v", testData, loadedData)
+	}
+}
+
+func TestFileStorage_ReplaysFromAnotherDirectory(t *testing.T) {
+	parent := t.TempDir()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer os.Chdir(cwd)
+
+	// Open the storage through a path relative to the working directory
+	if err := os.Chdir(parent); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	fs, err := storage.OpenFileStorage("data")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := fs.Put("users", "1", &TestStruct{Name: "Logged", Value: 1}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Crash before the write reached its file, and restart elsewhere
+	root := filepath.Join(parent, "data")
+	if err := os.Remove(filepath.Join(root, "collections", "users", "1.json")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	fs, err = storage.OpenFileStorage(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer fs.Close()
+
+	var loadedData TestStruct
+	if err := fs.Get("users", "1", &loadedData); err != nil {
+		t.Fatalf("expected the write to be replayed under the root, got %v", err)
+	}
+}
+
+func TestFileStorage_RemovesTempFilesOnOpen(t *testing.T) {
+	root := t.TempDir()
+	fs, err := storage.OpenFileStorage(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := fs.Put("users", "1", &TestStruct{Name: "Kept", Value: 1}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := fs.Put(storage.SchemaCollection, "users", &TestStruct{Name: "Schema"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	fs.Close()
+
+	// Crash in the middle of writing a record and a schema
+	leftovers := []string{
+		filepath.Join(root, "collections", "users", "2.json.123456.tmp"),
+		filepath.Join(root, "schemas", "users.json.654321.tmp"),
+	}
+	for _, leftover := range leftovers {
+		if err := os.WriteFile(leftover, []byte("partial"), 0644); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	fs, err = storage.OpenFileStorage(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer fs.Close()
+
+	for _, leftover := range leftovers {
+		if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be removed, got %v", leftover, err)
+		}
+	}
+	var loadedData TestStruct
+	if err := fs.Get("users", "1", &loadedData); err != nil {
+		t.Fatalf("expected the record to survive, got %v", err)
+	}
+}
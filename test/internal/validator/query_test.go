@@ -0,0 +1,232 @@
+package validator
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/adityaparmar9813/NAP/internal/validator"
+)
+
+func TestMatchesCriteria_Operators(t *testing.T) {
+	record := map[string]interface{}{
+		"name":   "Ansh Bajaj",
+		"age":    float64(20),
+		"score":  7.5,
+		"active": true,
+		"email":  nil,
+		"tags":   []interface{}{"a", "b"},
+	}
+
+	tests := []struct {
+		name     string
+		criteria map[string]interface{}
+		expected bool
+	}{
+		{"plain equality across int and float", map[string]interface{}{"age": 20}, true},
+		{"eq", map[string]interface{}{"name": map[string]interface{}{"$eq": "Ansh Bajaj"}}, true},
+		{"ne", map[string]interface{}{"age": map[string]interface{}{"$ne": 20}}, false},
+		{"ne matches missing field", map[string]interface{}{"city": map[string]interface{}{"$ne": "Pune"}}, true},
+		{"gt int against float", map[string]interface{}{"score": map[string]interface{}{"$gt": 7}}, true},
+		{"range", map[string]interface{}{"age": map[string]interface{}{"$gte": 18, "$lt": 20}}, false},
+		{"range inclusive", map[string]interface{}{"age": map[string]interface{}{"$gte": 18, "$lte": 20}}, true},
+		{"string ordering", map[string]interface{}{"name": map[string]interface{}{"$gt": "Anna", "$lt": "B"}}, true},
+		{"no ordering across types", map[string]interface{}{"name": map[string]interface{}{"$gt": 5}}, false},
+		{"range on missing field", map[string]interface{}{"city": map[string]interface{}{"$lt": "Z"}}, false},
+		{"in", map[string]interface{}{"age": map[string]interface{}{"$in": []interface{}{19, 20}}}, true},
+		{"in with regex", map[string]interface{}{"name": map[string]interface{}{"$in": []interface{}{regexp.MustCompile("^Ans")}}}, true},
+		{"nin", map[string]interface{}{"age": map[string]interface{}{"$nin": []interface{}{19, 20}}}, false},
+		{"exists", map[string]interface{}{"email": map[string]interface{}{"$exists": true}}, true},
+		{"not exists", map[string]interface{}{"city": map[string]interface{}{"$exists": false}}, true},
+		{"null matches missing", map[string]interface{}{"city": nil}, true},
+		{"type int", map[string]interface{}{"age": map[string]interface{}{"$type": "int"}}, true},
+		{"type int rejects fraction", map[string]interface{}{"score": map[string]interface{}{"$type": "int"}}, false},
+		{"type list", map[string]interface{}{"tags": map[string]interface{}{"$type": []interface{}{"string", "array"}}}, true},
+		{"type null", map[string]interface{}{"email": map[string]interface{}{"$type": "null"}}, true},
+		{"regex", map[string]interface{}{"name": map[string]interface{}{"$regex": "bajaj$", "$options": "i"}}, true},
+		{"regex is case sensitive", map[string]interface{}{"name": map[string]interface{}{"$regex": "bajaj$"}}, false},
+		{"regex only matches strings", map[string]interface{}{"age": map[string]interface{}{"$regex": "20"}}, false},
+		{"compiled regex", map[string]interface{}{"name": regexp.MustCompile("^Ansh")}, true},
+		{"not", map[string]interface{}{"age": map[string]interface{}{"$not": map[string]interface{}{"$gt": 30}}}, true},
+		{"not matches missing", map[string]interface{}{"city": map[string]interface{}{"$not": map[string]interface{}{"$eq": "Pune"}}}, true},
+		{"and", map[string]interface{}{"$and": []interface{}{
+			map[string]interface{}{"age": map[string]interface{}{"$gt": 18}},
+			map[string]interface{}{"active": true},
+		}}, true},
+		{"or", map[string]interface{}{"$or": []interface{}{
+			map[string]interface{}{"age": 30},
+			map[string]interface{}{"name": map[string]interface{}{"$regex": "^Ansh"}},
+		}}, true},
+		{"nor", map[string]interface{}{"$nor": []interface{}{
+			map[string]interface{}{"age": 30},
+			map[string]interface{}{"active": true},
+		}}, false},
+		{"or with field", map[string]interface{}{
+			"active": false,
+			"$or":    []map[string]interface{}{{"age": 20}},
+		}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if matched := validator.MatchesCriteria(record, test.criteria); matched != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected, matched)
+			}
+		})
+	}
+}
+
+func TestCompile_InvalidCriteria(t *testing.T) {
+	invalid := []map[string]interface{}{
+		{"age": map[string]interface{}{"$between": []interface{}{1, 2}}},
+		{"age": map[string]interface{}{"$gt": 1, "plain": 2}},
+		{"age": map[string]interface{}{"$in": 5}},
+		{"age": map[string]interface{}{"$exists": "yes"}},
+		{"age": map[string]interface{}{"$type": "date"}},
+		{"age": map[string]interface{}{"$gt": []interface{}{1}}},
+		{"age": map[string]interface{}{"$not": 5}},
+		{"name": map[string]interface{}{"$regex": "("}},
+		{"name": map[string]interface{}{"$options": "i"}},
+		{"$or": []interface{}{}},
+		{"$or": []interface{}{"age"}},
+		{"$where": "true"},
+	}
+
+	for _, criteria := range invalid {
+		if _, err := validator.Compile(criteria); err == nil {
+			t.Fatalf("expected error for %v, got none", criteria)
+		}
+		if validator.MatchesCriteria(map[string]interface{}{"age": 1, "name": "x"}, criteria) {
+			t.Fatalf("expected invalid criteria %v to match nothing", criteria)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b     interface{}
+		expected int
+		ok       bool
+	}{
+		{1, 2.5, -1, true},
+		{float64(3), 3, 0, true},
+		{int64(5), uint8(4), 1, true},
+		{"apple", "banana", -1, true},
+		{false, true, -1, true},
+		{"1", 1, 0, false},
+		{nil, nil, 0, false},
+	}
+
+	for _, test := range tests {
+		result, ok := validator.Compare(test.a, test.b)
+		if ok != test.ok || result != test.expected {
+			t.Fatalf("Compare(%v, %v): expected %d, %v, got %d, %v", test.a, test.b, test.expected, test.ok, result, ok)
+		}
+	}
+}
+
+func TestMatchesCriteria_EqualityByKind(t *testing.T) {
+	record := map[string]interface{}{
+		"age":    float64(20),
+		"zip":    "411001",
+		"active": true,
+		"tags":   []interface{}{"a", "b"},
+		"owner":  map[string]interface{}{"id": float64(7)},
+	}
+
+	tests := []struct {
+		name     string
+		criteria map[string]interface{}
+		expected bool
+	}{
+		{"number across Go types", map[string]interface{}{"age": int64(20)}, true},
+		{"string never equals a number", map[string]interface{}{"age": "20"}, false},
+		{"number never equals a string", map[string]interface{}{"zip": 411001}, false},
+		{"bool never equals a string", map[string]interface{}{"active": "true"}, false},
+		{"in across kinds", map[string]interface{}{"age": map[string]interface{}{"$in": []interface{}{"20", "21"}}}, false},
+		{"ne across kinds", map[string]interface{}{"age": map[string]interface{}{"$ne": "20"}}, true},
+		{"array across Go types", map[string]interface{}{"tags": []string{"a", "b"}}, true},
+		{"document across Go types", map[string]interface{}{"owner": map[string]int{"id": 7}}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if matched := validator.MatchesCriteria(record, test.criteria); matched != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected, matched)
+			}
+		})
+	}
+}
+
+func TestMatchesCriteria_NestedPathsAndArrays(t *testing.T) {
+	record := map[string]interface{}{
+		"address": map[string]interface{}{"city": "Pune", "geo": map[string]interface{}{"zip": "411001"}},
+		"tags":    []interface{}{"red", "blue"},
+		"scores":  []interface{}{float64(72), float64(85)},
+		"items": []interface{}{
+			map[string]interface{}{"sku": "a1", "qty": float64(2)},
+			map[string]interface{}{"sku": "b2", "qty": float64(5)},
+		},
+		"matrix": []interface{}{[]interface{}{"x"}},
+	}
+
+	tests := []struct {
+		name     string
+		criteria map[string]interface{}
+		expected bool
+	}{
+		{"nested document", map[string]interface{}{"address.city": "Pune"}, true},
+		{"deeply nested", map[string]interface{}{"address.geo.zip": map[string]interface{}{"$regex": "^41"}}, true},
+		{"missing nested field", map[string]interface{}{"address.state": map[string]interface{}{"$exists": false}}, true},
+		{"path through scalar", map[string]interface{}{"address.city.name": map[string]interface{}{"$exists": true}}, false},
+		{"array index", map[string]interface{}{"items.0.sku": "a1"}, true},
+		{"array index out of range", map[string]interface{}{"items.5.sku": map[string]interface{}{"$exists": true}}, false},
+		{"field of array elements", map[string]interface{}{"items.sku": "b2"}, true},
+		{"scalar matches any element", map[string]interface{}{"tags": "blue"}, true},
+		{"whole array equality", map[string]interface{}{"tags": []interface{}{"red", "blue"}}, true},
+		{"range over elements", map[string]interface{}{"scores": map[string]interface{}{"$gt": 80}}, true},
+		{"ne rejects any matching element", map[string]interface{}{"tags": map[string]interface{}{"$ne": "red"}}, false},
+		{"nin over elements", map[string]interface{}{"tags": map[string]interface{}{"$nin": []interface{}{"green"}}}, true},
+		{"in over elements", map[string]interface{}{"items.qty": map[string]interface{}{"$in": []interface{}{5, 9}}}, true},
+		{"size", map[string]interface{}{"tags": map[string]interface{}{"$size": 2}}, true},
+		{"size mismatch", map[string]interface{}{"items": map[string]interface{}{"$size": 3}}, false},
+		{"all", map[string]interface{}{"tags": map[string]interface{}{"$all": []interface{}{"blue", "red"}}}, true},
+		{"all missing one", map[string]interface{}{"tags": map[string]interface{}{"$all": []interface{}{"blue", "green"}}}, false},
+		{"all empty", map[string]interface{}{"tags": map[string]interface{}{"$all": []interface{}{}}}, false},
+		{"elemMatch documents", map[string]interface{}{"items": map[string]interface{}{"$elemMatch": map[string]interface{}{
+			"sku": "b2", "qty": map[string]interface{}{"$gte": 5},
+		}}}, true},
+		{"elemMatch needs one element for all conditions", map[string]interface{}{"items": map[string]interface{}{"$elemMatch": map[string]interface{}{
+			"sku": "a1", "qty": map[string]interface{}{"$gte": 5},
+		}}}, false},
+		{"without elemMatch conditions may use different elements", map[string]interface{}{
+			"items.sku": "a1", "items.qty": map[string]interface{}{"$gte": 5},
+		}, true},
+		{"elemMatch scalars", map[string]interface{}{"scores": map[string]interface{}{"$elemMatch": map[string]interface{}{"$gte": 80, "$lt": 90}}}, true},
+		{"elemMatch scalars no element in range", map[string]interface{}{"scores": map[string]interface{}{"$elemMatch": map[string]interface{}{"$gt": 72, "$lt": 85}}}, false},
+		{"all with elemMatch", map[string]interface{}{"items": map[string]interface{}{"$all": []interface{}{
+			map[string]interface{}{"$elemMatch": map[string]interface{}{"sku": "a1"}},
+			map[string]interface{}{"$elemMatch": map[string]interface{}{"qty": 5}},
+		}}}, true},
+		{"type array", map[string]interface{}{"matrix": map[string]interface{}{"$type": "array"}}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if matched := validator.MatchesCriteria(record, test.criteria); matched != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected, matched)
+			}
+		})
+	}
+
+	invalid := []map[string]interface{}{
+		{"tags": map[string]interface{}{"$size": -1}},
+		{"tags": map[string]interface{}{"$size": 1.5}},
+		{"tags": map[string]interface{}{"$all": "red"}},
+		{"items": map[string]interface{}{"$elemMatch": "a1"}},
+	}
+	for _, criteria := range invalid {
+		if _, err := validator.Compile(criteria); err == nil {
+			t.Fatalf("expected error for %v, got none", criteria)
+		}
+	}
+}